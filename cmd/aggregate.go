@@ -0,0 +1,505 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/database-from-zero-to-one/lexer"
+	"github.com/database-from-zero-to-one/parser"
+)
+
+// 聚合函数, GROUP BY 和 HAVING
+// 聚合用的是哈希聚合: 每一行按分组的值算出一个key, 相同key的行累加到同一个分组里
+
+// 支持的聚合函数
+const (
+	countFunction = "count"
+	sumFunction   = "sum"
+	avgFunction   = "avg"
+	minFunction   = "min"
+	maxFunction   = "max"
+)
+
+func isAggregateFunction(fn *parser.FunctionCall) bool {
+	switch fn.Name.Value {
+	case countFunction, sumFunction, avgFunction, minFunction, maxFunction:
+		return true
+	}
+	return false
+}
+
+// 表达式里有没有用到聚合函数
+func containsAggregate(exp *parser.Expression) bool {
+	switch exp.Kind {
+	case parser.FunctionKind:
+		if isAggregateFunction(exp.Function) {
+			return true
+		}
+		for _, arg := range exp.Function.Args {
+			if containsAggregate(arg) {
+				return true
+			}
+		}
+	case parser.UnaryKind:
+		return containsAggregate(&exp.Unary.Operand)
+	case parser.BinaryKind:
+		return containsAggregate(&exp.Binary.A) || containsAggregate(&exp.Binary.B)
+	case parser.InKind:
+		if containsAggregate(&exp.In.Left) {
+			return true
+		}
+		for _, value := range exp.In.List {
+			if containsAggregate(value) {
+				return true
+			}
+		}
+	case parser.IsNullKind:
+		return containsAggregate(&exp.IsNull.Operand)
+	}
+	// 子查询里的聚合函数属于子查询自己
+	return false
+}
+
+// SELECT 是否需要聚合: 有GROUP BY, 或者SELECT, HAVING, ORDER BY 里用到了聚合函数
+func isAggregateSelect(slct *parser.SelectStatement) bool {
+	if len(slct.GroupBy) > 0 || slct.Having != nil {
+		return true
+	}
+	for _, item := range slct.Item {
+		if !item.Asterisk && containsAggregate(item.Exp) {
+			return true
+		}
+	}
+	for _, item := range slct.OrderBy {
+		if containsAggregate(item.Exp) {
+			return true
+		}
+	}
+	return false
+}
+
+// 判断两个表达式是否相同, 不比较token的位置
+func expressionsEqual(a, b *parser.Expression) bool {
+	if a.Kind != b.Kind {
+		return false
+	}
+
+	switch a.Kind {
+	case parser.LiteralKind:
+		if (a.Table == nil) != (b.Table == nil) || (a.Table != nil && !a.Table.Equals(b.Table)) {
+			return false
+		}
+		return a.Literal.Equals(b.Literal)
+	case parser.UnaryKind:
+		return a.Unary.Op.Equals(&b.Unary.Op) && expressionsEqual(&a.Unary.Operand, &b.Unary.Operand)
+	case parser.BinaryKind:
+		return a.Binary.Op.Equals(&b.Binary.Op) &&
+			expressionsEqual(&a.Binary.A, &b.Binary.A) &&
+			expressionsEqual(&a.Binary.B, &b.Binary.B)
+	case parser.FunctionKind:
+		if !a.Function.Name.Equals(&b.Function.Name) || a.Function.Star != b.Function.Star || len(a.Function.Args) != len(b.Function.Args) {
+			return false
+		}
+		for i := range a.Function.Args {
+			if !expressionsEqual(a.Function.Args[i], b.Function.Args[i]) {
+				return false
+			}
+		}
+		return true
+	case parser.SubqueryKind, parser.ExistsKind:
+		// 子查询只有是同一个的时候才算相同
+		return a.Select == b.Select
+	case parser.InKind:
+		if a.In.Not != b.In.Not || a.In.Select != b.In.Select || len(a.In.List) != len(b.In.List) || !expressionsEqual(&a.In.Left, &b.In.Left) {
+			return false
+		}
+		for i := range a.In.List {
+			if !expressionsEqual(a.In.List[i], b.In.List[i]) {
+				return false
+			}
+		}
+		return true
+	case parser.IsNullKind:
+		return a.IsNull.Not == b.IsNull.Not && expressionsEqual(&a.IsNull.Operand, &b.IsNull.Operand)
+	}
+	return false
+}
+
+// 聚合之后的一行里, 第i个值对应的列名
+// 名字里带#, 所以不会和用户写的标识符冲突
+func aggregateSlotName(i int) string {
+	return "#" + strconv.Itoa(i)
+}
+
+// 引用聚合之后某一列的表达式
+func aggregateSlot(i int) *parser.Expression {
+	return &parser.Expression{
+		Literal: &lexer.Token{
+			Value: aggregateSlotName(i),
+			Kind:  lexer.IdentifierKind,
+		},
+		Kind: parser.LiteralKind,
+	}
+}
+
+// 一次聚合函数调用
+type aggregateCall struct {
+	fn      *parser.FunctionCall
+	argType ColumnType
+	Type    ColumnType // 聚合结果的类型
+}
+
+// 聚合函数在一个分组里的中间状态
+type aggregateState struct {
+	count int64
+	sum   int64
+	value MemoryCell // MIN和MAX目前为止的值
+}
+
+// 一个分组, keys是GROUP BY里每个表达式的值
+type group struct {
+	keys   []MemoryCell
+	states []aggregateState
+}
+
+// 按某一列分组, slot是这一列的值在聚合之后的位置
+type groupedColumn struct {
+	slot   int
+	column contextColumn
+}
+
+// 哈希聚合
+type aggregation struct {
+	input   []contextColumn // 聚合之前每一行的列
+	groupBy []*parser.Expression
+	calls   []*aggregateCall
+	columns []contextColumn // 聚合之后每一行的列: 先是GROUP BY的值, 然后是每个聚合函数的值
+	grouped []groupedColumn // 直接按某一列分组时, 这一列在聚合之后也能用原来的名字引用, 比如在子查询里
+	groups  map[string]*group
+	order   []*group // 按分组第一次出现的顺序输出
+}
+
+// 检查GROUP BY的表达式并准备开始聚合
+func (mb *MemoryBackend) newAggregation(input []contextColumn, groupBy []*parser.Expression) (*aggregation, error) {
+	agg := aggregation{
+		input:   input,
+		groupBy: groupBy,
+		groups:  map[string]*group{},
+	}
+
+	for i, exp := range groupBy {
+		typ, err := mb.expressionType(input, exp)
+		if err != nil {
+			return nil, fmt.Errorf("GROUP BY: %w", err)
+		}
+		agg.columns = append(agg.columns, contextColumn{
+			Name: aggregateSlotName(i),
+			Type: typ,
+		})
+
+		if exp.Kind == parser.LiteralKind && exp.Literal.Kind == lexer.IdentifierKind {
+			j, err := lookupIdentifier(input, exp)
+			if err == nil && input[j].Outer == 0 {
+				agg.grouped = append(agg.grouped, groupedColumn{
+					slot:   i,
+					column: input[j],
+				})
+			}
+		}
+	}
+	return &agg, nil
+}
+
+// 聚合之后每一行的列, 最后是可以用原来的名字引用的分组的列
+func (agg *aggregation) outputColumns() []contextColumn {
+	columns := append([]contextColumn{}, agg.columns...)
+	for _, g := range agg.grouped {
+		columns = append(columns, g.column)
+	}
+	return columns
+}
+
+// 把聚合之后才计算的表达式(SELECT, HAVING, ORDER BY)改写成引用聚合结果的表达式
+// GROUP BY里出现过的表达式和聚合函数调用会被替换成对应的列,
+// 其余地方直接引用的列都是错误的, 因为一个分组里有很多行
+func (mb *MemoryBackend) rewriteAggregate(agg *aggregation, exp *parser.Expression) (*parser.Expression, error) {
+	for i, g := range agg.groupBy {
+		if expressionsEqual(exp, g) {
+			return aggregateSlot(i), nil
+		}
+	}
+
+	switch exp.Kind {
+	case parser.LiteralKind:
+		if exp.Literal.Kind != lexer.IdentifierKind {
+			return exp, nil
+		}
+
+		// 写法不同但是指向同一列的也算, 比如 GROUP BY u.name 和 SELECT name
+		column, err := lookupIdentifier(agg.input, exp)
+		if err != nil {
+			return nil, err
+		}
+		// 子查询里引用外层查询的列, 对每个分组来说都是同一个值
+		if agg.input[column].Outer > 0 {
+			return exp, nil
+		}
+		for i, g := range agg.groupBy {
+			if g.Kind != parser.LiteralKind || g.Literal.Kind != lexer.IdentifierKind {
+				continue
+			}
+			if j, err := lookupIdentifier(agg.input, g); err == nil && j == column {
+				return aggregateSlot(i), nil
+			}
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNotGrouped, qualifiedName(agg.input[column].Table, exp.Literal.Value))
+	case parser.UnaryKind:
+		operand, err := mb.rewriteAggregate(agg, &exp.Unary.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return &parser.Expression{
+			Unary: &parser.UnaryExpression{
+				Operand: *operand,
+				Op:      exp.Unary.Op,
+			},
+			Kind: parser.UnaryKind,
+		}, nil
+	case parser.BinaryKind:
+		a, err := mb.rewriteAggregate(agg, &exp.Binary.A)
+		if err != nil {
+			return nil, err
+		}
+		b, err := mb.rewriteAggregate(agg, &exp.Binary.B)
+		if err != nil {
+			return nil, err
+		}
+		return &parser.Expression{
+			Binary: &parser.BinaryExpression{
+				A:  *a,
+				B:  *b,
+				Op: exp.Binary.Op,
+			},
+			Kind: parser.BinaryKind,
+		}, nil
+	case parser.InKind:
+		left, err := mb.rewriteAggregate(agg, &exp.In.Left)
+		if err != nil {
+			return nil, err
+		}
+		list := []*parser.Expression{}
+		for _, value := range exp.In.List {
+			v, err := mb.rewriteAggregate(agg, value)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return &parser.Expression{
+			In: &parser.InExpression{
+				Left:   *left,
+				List:   list,
+				Select: exp.In.Select,
+				Not:    exp.In.Not,
+			},
+			Kind: parser.InKind,
+		}, nil
+	case parser.IsNullKind:
+		operand, err := mb.rewriteAggregate(agg, &exp.IsNull.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return &parser.Expression{
+			IsNull: &parser.IsNullExpression{
+				Operand: *operand,
+				Not:     exp.IsNull.Not,
+			},
+			Kind: parser.IsNullKind,
+		}, nil
+	case parser.SubqueryKind, parser.ExistsKind:
+		// 子查询在聚合之后的每一行上执行, 所以子查询里只能引用更外层的查询的列
+		return exp, nil
+	case parser.FunctionKind:
+		call, err := mb.aggregateCall(agg.input, exp.Function)
+		if err != nil {
+			return nil, err
+		}
+
+		// 同样的聚合函数只需要计算一次
+		for i, c := range agg.calls {
+			if expressionsEqual(&parser.Expression{Function: c.fn, Kind: parser.FunctionKind}, exp) {
+				return aggregateSlot(len(agg.groupBy) + i), nil
+			}
+		}
+
+		agg.calls = append(agg.calls, call)
+		agg.columns = append(agg.columns, contextColumn{
+			Name: aggregateSlotName(len(agg.columns)),
+			Type: call.Type,
+		})
+		return aggregateSlot(len(agg.columns) - 1), nil
+	}
+	return nil, ErrInvalidOperator
+}
+
+// 检查聚合函数的参数并确定结果的类型
+func (mb *MemoryBackend) aggregateCall(input []contextColumn, fn *parser.FunctionCall) (*aggregateCall, error) {
+	if !isAggregateFunction(fn) {
+		return nil, fmt.Errorf("%w: %s", ErrFunctionDoesNotExist, fn.Name.Value)
+	}
+
+	call := aggregateCall{fn: fn}
+	if fn.Star {
+		if fn.Name.Value != countFunction {
+			return nil, fmt.Errorf("%w: %s(*)", ErrInvalidAggregate, fn.Name.Value)
+		}
+		call.Type = IntType
+		return &call, nil
+	}
+
+	if len(fn.Args) != 1 {
+		return nil, fmt.Errorf("%w: %s expects 1 argument, got %d", ErrInvalidAggregate, fn.Name.Value, len(fn.Args))
+	}
+	// 聚合函数不能嵌套, 参数里出现聚合函数的时候expressionType会报错
+	argType, err := mb.expressionType(input, fn.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	call.argType = argType
+
+	switch fn.Name.Value {
+	case countFunction:
+		call.Type = IntType
+	case sumFunction, avgFunction:
+		if !isType(argType, IntType) {
+			return nil, fmt.Errorf("%w: %s expects int, got %s", ErrTypeMismatch, fn.Name.Value, argType)
+		}
+		// 没有小数类型, 所以AVG的结果也是int(向零取整)
+		call.Type = IntType
+	case minFunction, maxFunction:
+		call.Type = argType
+	}
+	return &call, nil
+}
+
+// 把分组的值编码成哈希表的key, 每个值前面加上长度, 这样不同的值不会拼出相同的key
+// 和PostgreSQL一样, 分组和去重的时候所有的NULL都算同一个值, NULL的长度写成一个不可能出现的长度
+func groupKey(keys []MemoryCell) string {
+	buf := new(bytes.Buffer)
+	for _, key := range keys {
+		length := uint32(len(key))
+		if key.IsNull() {
+			length = math.MaxUint32
+		}
+		err := binary.Write(buf, binary.BigEndian, length)
+		if err != nil {
+			panic(err)
+		}
+		buf.Write(key)
+	}
+	return buf.String()
+}
+
+// 把一行累加到它所在的分组
+func (mb *MemoryBackend) accumulate(agg *aggregation, ctx *rowContext) error {
+	keys := []MemoryCell{}
+	for _, exp := range agg.groupBy {
+		cell, _, err := mb.evaluateCell(ctx, exp)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, cell)
+	}
+
+	key := groupKey(keys)
+	g, ok := agg.groups[key]
+	if !ok {
+		g = &group{
+			keys:   keys,
+			states: make([]aggregateState, len(agg.calls)),
+		}
+		agg.groups[key] = g
+		agg.order = append(agg.order, g)
+	}
+
+	for i, call := range agg.calls {
+		state := &g.states[i]
+		if call.fn.Star {
+			state.count++
+			continue
+		}
+
+		// 除了COUNT(*)以外, 聚合函数都忽略NULL
+		cell, _, err := mb.evaluateCell(ctx, call.fn.Args[0])
+		if err != nil {
+			return err
+		}
+		if cell.IsNull() {
+			continue
+		}
+		state.count++
+
+		switch call.fn.Name.Value {
+		case sumFunction, avgFunction:
+			state.sum += int64(cell.AsInt())
+		case minFunction:
+			if state.value == nil || compareCells(cell, state.value, call.argType) < 0 {
+				state.value = cell
+			}
+		case maxFunction:
+			if state.value == nil || compareCells(cell, state.value, call.argType) > 0 {
+				state.value = cell
+			}
+		}
+	}
+	return nil
+}
+
+// 所有的行都累加完之后, 每个分组生成一行: GROUP BY的值加上每个聚合函数的结果, 以及分组的列的值
+// SUM 的结果超出int的范围时报错
+func (agg *aggregation) rows() ([][]MemoryCell, error) {
+	groups := agg.order
+	// 没有GROUP BY的时候就算一行都没有也要输出一行, 比如 COUNT(*) 是0
+	if len(agg.groupBy) == 0 && len(groups) == 0 {
+		groups = []*group{{states: make([]aggregateState, len(agg.calls))}}
+	}
+
+	rows := [][]MemoryCell{}
+	for _, g := range groups {
+		row := append([]MemoryCell{}, g.keys...)
+		for i, call := range agg.calls {
+			state := g.states[i]
+			switch call.fn.Name.Value {
+			case countFunction:
+				row = append(row, intCell(int32(state.count)))
+			case sumFunction:
+				if state.count == 0 {
+					row = append(row, nullCell())
+					continue
+				}
+				sum, err := intResult(state.sum)
+				if err != nil {
+					return nil, fmt.Errorf("%w: sum", err)
+				}
+				row = append(row, sum)
+			case avgFunction:
+				if state.count == 0 {
+					row = append(row, nullCell())
+					continue
+				}
+				row = append(row, intCell(int32(state.sum/state.count)))
+			case minFunction, maxFunction:
+				// 一个值都没有的时候state.value就是nil, 也就是NULL
+				row = append(row, state.value)
+			}
+		}
+		for _, g := range agg.grouped {
+			row = append(row, row[g.slot])
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/database-from-zero-to-one/parser"
+)
+
+// 统计信息
+// ANALYZE 扫描整张表, 记下行数以及每一列的NULL的比例, 不同的值的个数和直方图, 保存在表上
+// 查询计划用统计信息估算每一步会产生多少行, 从而选择代价最小的索引和连接顺序, 见cost.go
+// 统计信息只在ANALYZE的时候更新, 之后修改了表要再ANALYZE一次, 不过估算行数的时候总是用表现在的行数
+
+// 直方图最多有几个桶
+const histogramBuckets = 10
+
+// 一张表的统计信息
+type tableStats struct {
+	RowCount int            // ANALYZE时的行数, 估算的时候用表现在的行数
+	Columns  []*columnStats // 每一列的统计信息, ANALYZE之后新加的列没有统计信息
+}
+
+// 一列的统计信息
+type columnStats struct {
+	NullFraction float64 // NULL占所有行的比例
+	Distinct     int     // 不同的非NULL值的个数
+	// 等深直方图: 非NULL的值排好序之后平均分成几个桶, 这里是每个桶两端的值
+	// 第一个是最小值, 最后一个是最大值, 每个桶里的值大约一样多, 只有一个非NULL的值时就只有这个值
+	Histogram []MemoryCell
+}
+
+// 第i列的统计信息, 没有时为nil
+func (s *tableStats) column(i int) *columnStats {
+	if s == nil || i >= len(s.Columns) {
+		return nil
+	}
+	return s.Columns[i]
+}
+
+func (mb *MemoryBackend) Analyze(analyze *parser.AnalyzeStatement) error {
+	if analyze.Table == nil {
+		for _, name := range sortedTableNames(mb.tables) {
+			mb.tables[name].analyze()
+		}
+		return nil
+	}
+
+	t, ok := mb.tables[analyze.Table.Value]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableDoesNotExist, analyze.Table.Value)
+	}
+	t.analyze()
+	return nil
+}
+
+// 重新收集表的统计信息
+func (t *table) analyze() {
+	stats := &tableStats{RowCount: len(t.rows)}
+	for i, typ := range t.ColumnTypes {
+		stats.Columns = append(stats.Columns, collectColumnStats(t.rows, i, typ))
+	}
+	t.Stats = stats
+}
+
+func collectColumnStats(rows [][]MemoryCell, column int, typ ColumnType) *columnStats {
+	stats := &columnStats{}
+	nulls := 0
+	values := []MemoryCell{}
+	seen := map[string]bool{}
+	for _, row := range rows {
+		cell := row[column]
+		if cell.IsNull() {
+			nulls++
+			continue
+		}
+		values = append(values, cell)
+
+		key := groupKey([]MemoryCell{cell})
+		if !seen[key] {
+			seen[key] = true
+			stats.Distinct++
+		}
+	}
+	if len(rows) > 0 {
+		stats.NullFraction = float64(nulls) / float64(len(rows))
+	}
+	if len(values) == 0 {
+		return stats
+	}
+
+	sort.SliceStable(values, func(i, j int) bool {
+		return compareCells(values[i], values[j], typ) < 0
+	})
+	buckets := histogramBuckets
+	if len(values)-1 < buckets {
+		buckets = len(values) - 1
+	}
+	stats.Histogram = []MemoryCell{values[0]}
+	for k := 1; k <= buckets; k++ {
+		stats.Histogram = append(stats.Histogram, values[k*(len(values)-1)/buckets])
+	}
+	return stats
+}
+
+// 删除一列之后, 这一列的统计信息也一起删除
+func (t *table) dropColumnStats(column int) {
+	if t.Stats == nil || column >= len(t.Stats.Columns) {
+		return
+	}
+	t.Stats.Columns = append(t.Stats.Columns[:column:column], t.Stats.Columns[column+1:]...)
+}
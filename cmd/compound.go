@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/database-from-zero-to-one/lexer"
+	"github.com/database-from-zero-to-one/parser"
+)
+
+// DISTINCT 和集合操作(UNION, INTERSECT, EXCEPT)
+// 判断两行是否相同时用的是每一列的值拼起来的key, 和哈希聚合一样
+
+var setOperatorNames = map[parser.SetOperator]string{
+	parser.UnionOperator:     "UNION",
+	parser.IntersectOperator: "INTERSECT",
+	parser.ExceptOperator:    "EXCEPT",
+}
+
+// 结果中一行的key, 每一列的值都相同的两行key相同
+func rowKey(row []Cell) string {
+	cells := []MemoryCell{}
+	for _, cell := range row {
+		cells = append(cells, cell.(MemoryCell))
+	}
+	return groupKey(cells)
+}
+
+// 计算两个查询的结果再按集合操作组合起来, 最后再排序和LIMIT
+func (mb *MemoryBackend) selectCompound(slct *parser.SelectStatement, outer *rowContext, columnsOnly bool) (*Results, error) {
+	compound := slct.Compound
+	left, err := mb.query(compound.Left, outer, columnsOnly)
+	if err != nil {
+		return nil, err
+	}
+	right, err := mb.query(compound.Right, outer, columnsOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	// 两边的列数和每一列的类型都要一样, 一边是NULL字面量时用另一边的类型
+	op := setOperatorNames[compound.Operator]
+	if len(left.Columns) != len(right.Columns) {
+		return nil, fmt.Errorf("%w: %s has %d and %d columns", ErrColumnCountMismatch, op, len(left.Columns), len(right.Columns))
+	}
+	results := []ResultColumn{}
+	for i, col := range left.Columns {
+		typ, ok := commonType(col.Type, right.Columns[i].Type)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s column %d is %s and %s", ErrTypeMismatch, op, i+1, col.Type, right.Columns[i].Type)
+		}
+		results = append(results, ResultColumn{
+			Type: typ,
+			Name: col.Name,
+		})
+	}
+
+	// 结果的列名用左边的, ORDER BY 只能用这些列名或者列的位置
+	columns := []contextColumn{}
+	exps := []*parser.Expression{}
+	for _, col := range results {
+		columns = append(columns, contextColumn{
+			Name: col.Name,
+			Type: col.Type,
+		})
+		exps = append(exps, &parser.Expression{
+			Literal: &lexer.Token{
+				Value: col.Name,
+				Kind:  lexer.IdentifierKind,
+			},
+			Kind: parser.LiteralKind,
+		})
+	}
+	orderBy, err := resolveOrderBy(nil, exps, slct.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := mb.orderByKeys(columns, orderBy)
+	if err != nil {
+		return nil, err
+	}
+	limit, offset, err := mb.limitAndOffset(slct)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []sortRow{}
+	for _, result := range combineRows(compound, left.Rows, right.Rows) {
+		row := []MemoryCell{}
+		for _, cell := range result {
+			row = append(row, cell.(MemoryCell))
+		}
+
+		values, err := mb.evaluateSortKeys(&rowContext{
+			columns: columns,
+			row:     row,
+		}, orderBy)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, sortRow{
+			keys:   values,
+			result: result,
+		})
+	}
+
+	return &Results{
+		Columns: results,
+		Rows:    sortAndLimit(keys, rows, limit, offset),
+	}, nil
+}
+
+// 按集合操作组合两边的行, 没有ALL的时候结果里没有重复的行
+func combineRows(compound *parser.CompoundSelect, left, right [][]Cell) [][]Cell {
+	if compound.Operator == parser.UnionOperator {
+		rows := append(append([][]Cell{}, left...), right...)
+		if compound.All {
+			return rows
+		}
+		return distinctRows(rows)
+	}
+
+	// INTERSECT 和 EXCEPT 都要知道右边的每一行出现了几次
+	counts := map[string]int{}
+	for _, row := range right {
+		counts[rowKey(row)]++
+	}
+
+	rows := [][]Cell{}
+	seen := map[string]bool{}
+	for _, row := range left {
+		key := rowKey(row)
+		inRight := counts[key] > 0
+		if compound.All {
+			// 有ALL的时候右边的一行只能和左边的一行抵消
+			// 比如左边有3行a, 右边有1行a, INTERSECT ALL 有1行a, EXCEPT ALL 有2行a
+			if inRight {
+				counts[key]--
+			}
+		} else {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+
+		if inRight == (compound.Operator == parser.IntersectOperator) {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// 去掉重复的行, 保留每种行第一次出现的那一行
+func distinctRows(rows [][]Cell) [][]Cell {
+	distinct := [][]Cell{}
+	seen := map[string]bool{}
+	for _, row := range rows {
+		key := rowKey(row)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		distinct = append(distinct, row)
+	}
+	return distinct
+}
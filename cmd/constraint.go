@@ -0,0 +1,361 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/database-from-zero-to-one/lexer"
+	"github.com/database-from-zero-to-one/parser"
+)
+
+// 约束
+// 每次INSERT和UPDATE都会检查修改之后的行是否满足表的所有约束, 只要有一行不满足就一行都不修改
+// NOT NULL: 值不能是NULL
+// UNIQUE: 约束的列的值不能和其他的行重复, 和PostgreSQL一样, 有NULL的行不算重复
+// CHECK: 条件不能是false, 和WHERE不一样, 条件是NULL时也算满足
+// PRIMARY KEY: 相当于UNIQUE加上每一列都NOT NULL, 一张表最多只有一个主键
+// FOREIGN KEY: 引用的列不是NULL时, 被引用的表里必须有一行的值和它相同, 见foreignkey.go
+
+// 表上的一个约束
+type constraint struct {
+	Name    string
+	Kind    parser.ConstraintKind
+	Columns []int              // 约束的列在表里的位置, CHECK 的时候是条件里引用的列
+	Check   *parser.Expression // CHECK 的条件, 里面的列名都没有表名
+
+	// 外键引用的表和列, 以及被引用的行被删除或修改时要执行的动作
+	RefTable   string
+	RefColumns []int
+	OnDelete   parser.ReferentialAction
+	OnUpdate   parser.ReferentialAction
+}
+
+// 没有给约束起名字时, 和PostgreSQL一样用 表名_列名_后缀 作为名字, 重名的时候在后面加上数字
+// 主键的名字里没有列名
+func constraintName(t *table, tableName string, kind parser.ConstraintKind, columns []int) string {
+	parts := []string{tableName}
+	for _, i := range columns {
+		if kind == parser.PrimaryKeyConstraint {
+			break
+		}
+		parts = append(parts, t.Columns[i])
+		// CHECK 的名字只用第一列
+		if kind == parser.CheckConstraint {
+			break
+		}
+	}
+	switch kind {
+	case parser.NotNullConstraint:
+		parts = append(parts, "not_null")
+	case parser.UniqueConstraint:
+		parts = append(parts, "key")
+	case parser.CheckConstraint:
+		parts = append(parts, "check")
+	case parser.PrimaryKeyConstraint:
+		parts = append(parts, "pkey")
+	case parser.ForeignKeyConstraint:
+		parts = append(parts, "fkey")
+	}
+
+	name := strings.Join(parts, "_")
+	for n := 1; t.constraint(name) != nil; n++ {
+		name = strings.Join(parts, "_") + strconv.Itoa(n)
+	}
+	return name
+}
+
+// 按名字找约束, 没有时返回nil
+func (t *table) constraint(name string) *constraint {
+	for _, c := range t.Constraints {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// 表的主键, 没有主键时返回nil
+func (t *table) primaryKey() *constraint {
+	for _, c := range t.Constraints {
+		if c.Kind == parser.PrimaryKeyConstraint {
+			return c
+		}
+	}
+	return nil
+}
+
+// 找到约束里写的每一列在表里的位置, 同一列不能写两次
+func constraintColumns(t *table, tableName string, names []*lexer.Token) ([]int, error) {
+	columns := []int{}
+	for _, name := range names {
+		i, err := lookupColumn(t.contextColumns(tableName), "", name.Value)
+		if err != nil {
+			return nil, err
+		}
+		if containsColumn(columns, i) {
+			return nil, fmt.Errorf("%w: %s appears twice", ErrDuplicateColumn, name.Value)
+		}
+		columns = append(columns, i)
+	}
+	return columns, nil
+}
+
+// 检查约束的定义并把它加到表上, column是列约束所在的列, 表约束时为-1
+func (mb *MemoryBackend) addConstraint(t *table, tableName string, def *parser.Constraint, column int) error {
+	c := constraint{Kind: def.Kind}
+	if column >= 0 {
+		c.Columns = []int{column}
+	}
+
+	switch def.Kind {
+	case parser.UniqueConstraint, parser.PrimaryKeyConstraint, parser.ForeignKeyConstraint:
+		if len(def.Columns) > 0 {
+			columns, err := constraintColumns(t, tableName, def.Columns)
+			if err != nil {
+				return err
+			}
+			c.Columns = columns
+		}
+
+		if def.Kind == parser.PrimaryKeyConstraint && t.primaryKey() != nil {
+			return fmt.Errorf("%w: multiple primary keys for table %s are not allowed", ErrDuplicateConstraint, tableName)
+		}
+		if def.Kind == parser.ForeignKeyConstraint {
+			if err := mb.checkForeignKey(t, tableName, def.References, &c); err != nil {
+				return err
+			}
+		}
+	case parser.CheckConstraint:
+		// 条件只能引用这张表的列, 不能有子查询和聚合函数
+		columns := t.contextColumns(tableName)
+		if err := mb.checkCondition(columns, def.Check, "CHECK"); err != nil {
+			return err
+		}
+		refs, err := referencedColumns(def.Check, columns)
+		if err != nil {
+			return err
+		}
+		c.Columns = nil
+		for _, i := range refs {
+			if !containsColumn(c.Columns, i) {
+				c.Columns = append(c.Columns, i)
+			}
+		}
+
+		// 去掉列名前面的表名, 这样表重命名之后也能找到这些列
+		c.Check = mapColumnReferences(def.Check, func(exp *parser.Expression) *parser.Expression {
+			return &parser.Expression{
+				Literal: exp.Literal,
+				Kind:    parser.LiteralKind,
+			}
+		})
+	}
+
+	if def.Name != nil {
+		if t.constraint(def.Name.Value) != nil {
+			return fmt.Errorf("%w: %s", ErrDuplicateConstraint, def.Name.Value)
+		}
+		c.Name = def.Name.Value
+	} else {
+		c.Name = constraintName(t, tableName, c.Kind, c.Columns)
+	}
+
+	t.Constraints = append(t.Constraints, &c)
+	return nil
+}
+
+func containsColumn(columns []int, column int) bool {
+	for _, i := range columns {
+		if i == column {
+			return true
+		}
+	}
+	return false
+}
+
+// 检查修改之后表里的所有行是否满足所有的约束, 外键引用的表的行在cs里找
+// changed是被插入或者被修改的行, 只有这些行需要检查NOT NULL, CHECK 和外键
+// 修改之前的行本来就没有重复, 所以UNIQUE重复的时候至少有一行是被修改的行
+func (mb *MemoryBackend) checkConstraints(cs *changeSet, t *table, rows [][]MemoryCell, changed []int) error {
+	columns := t.contextColumns("")
+	for _, c := range t.Constraints {
+		switch c.Kind {
+		case parser.NotNullConstraint, parser.PrimaryKeyConstraint:
+			for _, i := range changed {
+				for _, column := range c.Columns {
+					if rows[i][column].IsNull() {
+						return fmt.Errorf("%w: column %s", ErrNotNullViolation, t.Columns[column])
+					}
+				}
+			}
+		case parser.CheckConstraint:
+			for _, i := range changed {
+				cell, _, err := mb.evaluateCell(&rowContext{columns: columns, row: rows[i]}, c.Check)
+				if err != nil {
+					return err
+				}
+				if !cell.IsNull() && !cell.AsBool() {
+					return fmt.Errorf("%w: %s", ErrCheckViolation, c.Name)
+				}
+			}
+		case parser.ForeignKeyConstraint:
+			if err := mb.checkReferencedRows(cs, t, c, rows, changed); err != nil {
+				return err
+			}
+		}
+
+		if c.Kind == parser.UniqueConstraint || c.Kind == parser.PrimaryKeyConstraint {
+			if err := checkUnique(t, c.Name, c.Columns, rows); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 唯一索引和UNIQUE约束一样检查
+	for _, idx := range t.Indexes {
+		if idx.Unique {
+			if err := checkUnique(t, idx.Name, idx.Columns, rows); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 检查所有的行在columns上没有重复的值, name是报错时用的约束或者索引的名字
+func checkUnique(t *table, name string, columns []int, rows [][]MemoryCell) error {
+	seen := map[string]bool{}
+	for _, row := range rows {
+		keys := rowKeys(row, columns)
+		if hasNull(keys) {
+			continue
+		}
+
+		key := groupKey(keys)
+		if seen[key] {
+			return fmt.Errorf("%w: %s, %s already exists", ErrUniqueViolation, name, keyString(t, columns, keys))
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// 一行里约束的那几列的值
+func rowKeys(row []MemoryCell, columns []int) []MemoryCell {
+	keys := []MemoryCell{}
+	for _, i := range columns {
+		keys = append(keys, row[i])
+	}
+	return keys
+}
+
+// 错误信息里的 key (a, b)=(1, 2)
+func keyString(t *table, columns []int, keys []MemoryCell) string {
+	names, values := []string{}, []string{}
+	for k, i := range columns {
+		names = append(names, t.Columns[i])
+		values = append(values, cellString(keys[k], t.ColumnTypes[i]))
+	}
+	return fmt.Sprintf("key (%s)=(%s)", strings.Join(names, ", "), strings.Join(values, ", "))
+}
+
+// 按顺序返回map里所有的key, 出错时总是报告最前面的一行
+func sortedRowIndexes(rows map[int][]MemoryCell) []int {
+	indexes := []int{}
+	for i := range rows {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// 删除一列之后, 引用了这一列的约束也一起删除, 其他约束里的列的位置要往前移
+func (t *table) dropColumnConstraints(column int) {
+	kept := []*constraint{}
+	for _, c := range t.Constraints {
+		if containsColumn(c.Columns, column) {
+			continue
+		}
+		for k, i := range c.Columns {
+			if i > column {
+				c.Columns[k] = i - 1
+			}
+		}
+		kept = append(kept, c)
+	}
+	t.Constraints = kept
+}
+
+// 重命名一列之后, CHECK 里引用这一列的地方也要改成新的名字
+func (t *table) renameColumnConstraints(oldName, newName string) {
+	for _, c := range t.Constraints {
+		if c.Check == nil {
+			continue
+		}
+		c.Check = mapColumnReferences(c.Check, func(exp *parser.Expression) *parser.Expression {
+			if exp.Literal.Value != oldName {
+				return exp
+			}
+			literal := *exp.Literal
+			literal.Value = newName
+			return &parser.Expression{
+				Literal: &literal,
+				Table:   exp.Table,
+				Kind:    parser.LiteralKind,
+			}
+		})
+	}
+}
+
+// 把表达式里的每一个列引用换成f返回的表达式, 原来的表达式不会被修改
+// 只处理CHECK里能出现的表达式, 子查询和函数调用原样返回
+func mapColumnReferences(exp *parser.Expression, f func(*parser.Expression) *parser.Expression) *parser.Expression {
+	switch exp.Kind {
+	case parser.LiteralKind:
+		if exp.Literal.Kind == lexer.IdentifierKind {
+			return f(exp)
+		}
+	case parser.UnaryKind:
+		return &parser.Expression{
+			Unary: &parser.UnaryExpression{
+				Operand: *mapColumnReferences(&exp.Unary.Operand, f),
+				Op:      exp.Unary.Op,
+			},
+			Kind: parser.UnaryKind,
+		}
+	case parser.BinaryKind:
+		return &parser.Expression{
+			Binary: &parser.BinaryExpression{
+				A:  *mapColumnReferences(&exp.Binary.A, f),
+				B:  *mapColumnReferences(&exp.Binary.B, f),
+				Op: exp.Binary.Op,
+			},
+			Kind: parser.BinaryKind,
+		}
+	case parser.InKind:
+		list := []*parser.Expression{}
+		for _, value := range exp.In.List {
+			list = append(list, mapColumnReferences(value, f))
+		}
+		return &parser.Expression{
+			In: &parser.InExpression{
+				Left:   *mapColumnReferences(&exp.In.Left, f),
+				List:   list,
+				Select: exp.In.Select,
+				Not:    exp.In.Not,
+			},
+			Kind: parser.InKind,
+		}
+	case parser.IsNullKind:
+		return &parser.Expression{
+			IsNull: &parser.IsNullExpression{
+				Operand: *mapColumnReferences(&exp.IsNull.Operand, f),
+				Not:     exp.IsNull.Not,
+			},
+			Kind: parser.IsNullKind,
+		}
+	}
+	return exp
+}
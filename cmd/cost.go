@@ -0,0 +1,459 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+
+	"github.com/database-from-zero-to-one/lexer"
+	"github.com/database-from-zero-to-one/parser"
+)
+
+// 代价估算
+// 用ANALYZE收集的统计信息估算条件的选择率(满足条件的行占所有行的比例), 从而估算每一步会产生多少行
+// 行数总是用表现在的行数, ANALYZE之后表里的行可能已经变了很多, 比例一般变化不大
+// 扫描一行的代价算作1, 用索引找到一行要跳到表里的任意位置, 代价算作indexRowCost
+// 用来选择用哪个索引或者不用索引, 以及一组内连接按什么顺序连接
+// 没有统计信息的表还是按规则选择, 见index.go和join.go
+
+const (
+	defaultEqualSelectivity = 0.1     // 没有统计信息时等值条件的选择率
+	defaultRangeSelectivity = 1.0 / 3 // 没有统计信息时范围条件的选择率
+	defaultSelectivity      = 0.5     // 其他条件的选择率
+	indexRowCost            = 4.0     // 用索引找到一行的代价
+)
+
+// 把选择率限制在0到1之间
+func clampSelectivity(s float64) float64 {
+	return math.Max(0, math.Min(1, s))
+}
+
+// 非NULL的值里等于value的比例, 不在最小值和最大值之间时一定没有
+func (s *columnStats) equalFraction(value MemoryCell, typ ColumnType) float64 {
+	if s.Distinct == 0 {
+		return 0
+	}
+	if compareCells(value, s.Histogram[0], typ) < 0 || compareCells(value, s.Histogram[len(s.Histogram)-1], typ) > 0 {
+		return 0
+	}
+	return 1 / float64(s.Distinct)
+}
+
+// 非NULL的值里比value小的比例
+// 每个桶里的值一样多, 所以整个桶都比value小时算1, value落在桶里时int按位置插值, 其他类型算一半
+func (s *columnStats) lessFraction(value MemoryCell, typ ColumnType) float64 {
+	buckets := len(s.Histogram) - 1
+	if buckets <= 0 {
+		if s.Distinct > 0 && compareCells(value, s.Histogram[0], typ) > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	fraction := 0.0
+	for i := 0; i < buckets; i++ {
+		low, high := s.Histogram[i], s.Histogram[i+1]
+		switch {
+		case compareCells(value, high, typ) > 0:
+			fraction++
+		case compareCells(value, low, typ) > 0:
+			if typ == IntType {
+				fraction += float64(value.AsInt()-low.AsInt()) / float64(high.AsInt()-low.AsInt())
+			} else {
+				fraction += 0.5
+			}
+		}
+	}
+	return fraction / float64(buckets)
+}
+
+// 列 op 常量 的选择率, 和NULL比较的结果都是NULL, 列是NULL的行也都不满足条件
+func (s *columnStats) comparisonSelectivity(op lexer.Symbol, value MemoryCell, typ ColumnType) float64 {
+	if value.IsNull() {
+		return 0
+	}
+
+	eq := s.equalFraction(value, typ)
+	less := s.lessFraction(value, typ)
+	fraction := eq
+	switch op {
+	case lexer.NotEqualSymbol:
+		fraction = 1 - eq
+	case lexer.LessSymbol:
+		fraction = less
+	case lexer.LessEqualSymbol:
+		fraction = less + eq
+	case lexer.GreaterSymbol:
+		fraction = 1 - less - eq
+	case lexer.GreaterEqualSymbol:
+		fraction = 1 - less
+	}
+	return clampSelectivity(fraction) * (1 - s.NullFraction)
+}
+
+// 估算条件的选择率, stats[i]是columns里第i列的统计信息, 没有时为nil
+// 没有条件时选择率是1, AND 连起来的条件当作互相独立
+func (mb *MemoryBackend) selectivity(cond *parser.Expression, columns []contextColumn, stats []*columnStats) float64 {
+	if cond == nil {
+		return 1
+	}
+
+	switch cond.Kind {
+	case parser.BinaryKind:
+		op := cond.Binary.Op
+		if op.Kind == lexer.KeywordKind {
+			a := mb.selectivity(&cond.Binary.A, columns, stats)
+			b := mb.selectivity(&cond.Binary.B, columns, stats)
+			switch lexer.Keyword(op.Value) {
+			case lexer.AndKeyword:
+				return a * b
+			case lexer.OrKeyword:
+				return a + b - a*b
+			}
+			break
+		}
+		return mb.comparisonSelectivity(cond, columns, stats)
+	case parser.UnaryKind:
+		if cond.Unary.Op.Kind == lexer.KeywordKind && lexer.Keyword(cond.Unary.Op.Value) == lexer.NotKeyword {
+			return 1 - mb.selectivity(&cond.Unary.Operand, columns, stats)
+		}
+	case parser.IsNullKind:
+		s := defaultEqualSelectivity
+		if column, ok := statsColumn(&cond.IsNull.Operand, columns, stats); ok {
+			s = stats[column].NullFraction
+		}
+		if cond.IsNull.Not {
+			return 1 - s
+		}
+		return s
+	case parser.InKind:
+		if cond.In.Select != nil {
+			break
+		}
+		// 相当于用OR连起来的几个等值条件, 列表里的值一般都不一样, 所以直接相加
+		s := 0.0
+		for _, value := range cond.In.List {
+			s += mb.selectivity(equalExpression(&cond.In.Left, value), columns, stats)
+		}
+		s = clampSelectivity(s)
+		if cond.In.Not {
+			return 1 - s
+		}
+		return s
+	}
+	return defaultSelectivity
+}
+
+// 比较条件的选择率
+func (mb *MemoryBackend) comparisonSelectivity(cond *parser.Expression, columns []contextColumn, stats []*columnStats) float64 {
+	op := lexer.Symbol(cond.Binary.Op.Value)
+	if _, ok := flippedSymbols[op]; !ok && op != lexer.NotEqualSymbol {
+		return defaultSelectivity
+	}
+
+	// 列 op 常量, 有直方图时可以估算范围条件
+	if c, ok := mb.indexCondition(columns, cond); ok && stats[c.column] != nil {
+		value, _, err := mb.evaluateCell(&rowContext{}, c.value)
+		if err == nil {
+			return stats[c.column].comparisonSelectivity(c.op, value, columns[c.column].Type)
+		}
+	}
+
+	// 列 = 列, 比如连接条件: 值少的那一列里的每个值大概都能在另一列里找到
+	if op == lexer.EqualSymbol || op == lexer.NotEqualSymbol {
+		a, okA := statsColumn(&cond.Binary.A, columns, stats)
+		b, okB := statsColumn(&cond.Binary.B, columns, stats)
+		if okA && okB {
+			s := 0.0
+			if distinct := math.Max(float64(stats[a].Distinct), float64(stats[b].Distinct)); distinct > 0 {
+				s = 1 / distinct
+			}
+			if op == lexer.NotEqualSymbol {
+				s = 1 - s
+			}
+			return s * (1 - stats[a].NullFraction) * (1 - stats[b].NullFraction)
+		}
+	}
+
+	switch op {
+	case lexer.EqualSymbol:
+		return defaultEqualSelectivity
+	case lexer.NotEqualSymbol:
+		return 1 - defaultEqualSelectivity
+	}
+	return defaultRangeSelectivity
+}
+
+// 表达式直接引用一列并且这一列有统计信息时, 返回列的位置
+func statsColumn(exp *parser.Expression, columns []contextColumn, stats []*columnStats) (int, bool) {
+	if exp.Kind != parser.LiteralKind || exp.Literal.Kind != lexer.IdentifierKind {
+		return 0, false
+	}
+	i, err := lookupIdentifier(columns, exp)
+	if err != nil || i >= len(stats) || stats[i] == nil {
+		return 0, false
+	}
+	return i, true
+}
+
+// 扫描出来的每一列的统计信息, 扫描有统计信息的表时才有
+func (plan *fromPlan) scanStats() []*columnStats {
+	stats := make([]*columnStats, len(plan.scanColumns))
+	if plan.kind != scanPlanKind || plan.table.Stats == nil {
+		return stats
+	}
+	for i := range stats {
+		stats[i] = plan.table.Stats.column(i)
+	}
+	return stats
+}
+
+// 投影裁剪之后输出的每一列的统计信息
+func (plan *fromPlan) columnStats() []*columnStats {
+	stats := plan.scanStats()
+	if plan.output == nil {
+		return stats
+	}
+	output := []*columnStats{}
+	for _, i := range plan.output {
+		output = append(output, stats[i])
+	}
+	return output
+}
+
+// 估算扫描表之后剩下的行数, 没有统计信息时返回false
+func (mb *MemoryBackend) estimateScan(plan *fromPlan) (float64, bool) {
+	if plan.kind != scanPlanKind || plan.table.Stats == nil {
+		return 0, false
+	}
+	cond := joinConjuncts(plan.filters)
+	s := mb.selectivity(cond, plan.scanColumns, plan.scanStats())
+	return float64(len(plan.table.rows)) * s, true
+}
+
+// 选择代价最小的索引扫描, 都不如扫描整张表时返回nil
+// 有序索引要先从上往下找到第一项, 哈希索引直接就能找到
+func (mb *MemoryBackend) cheapestIndexScan(plan *fromPlan, scans []*indexScan) *indexScan {
+	rows := float64(len(plan.table.rows))
+	stats := plan.scanStats()
+
+	var best *indexScan
+	bestCost := rows
+	for _, scan := range scans {
+		matched := rows * mb.selectivity(joinConjuncts(scan.conds), plan.scanColumns, stats)
+		cost := matched * indexRowCost
+		if scan.index.Method == parser.HashIndex {
+			cost++
+		} else {
+			cost += math.Log2(rows + 1)
+		}
+		if cost < bestCost {
+			best, bestCost = scan, cost
+		}
+	}
+	return best
+}
+
+// 一组可以任意调整顺序的内连接: 所有的叶子节点和所有的连接条件
+type joinGroup struct {
+	leaves  []*fromPlan
+	rows    []float64 // 每个叶子节点估算的行数
+	conds   []*parser.Expression
+	masks   []uint    // 每个连接条件引用了哪些叶子节点
+	factors []float64 // 每个连接条件的选择率
+}
+
+// 调整连接的顺序
+// 连续的内连接(包括逗号和CROSS JOIN)按任何顺序连接结果都一样, 只是行和列的顺序不同, 列都是按名字找的, 所以没有影响
+// 一组内连接的代价是所有中间结果的行数之和, 最后的结果不管什么顺序都一样
+// 先连接估算的结果最小的两个叶子节点, 然后每次再连上让中间结果最小的一个
+// 叶子节点都是扫描有统计信息的表, 并且新的顺序的代价比原来的小时才换成新的顺序
+func (mb *MemoryBackend) orderJoins(plan *fromPlan) *fromPlan {
+	if plan.kind != joinPlanKind {
+		return plan
+	}
+	if !plan.reorderable() {
+		plan.left = mb.orderJoins(plan.left)
+		plan.right = mb.orderJoins(plan.right)
+		plan.columns = append(append([]contextColumn{}, plan.left.columns...), plan.right.columns...)
+		return plan
+	}
+
+	// 叶子节点不是内连接, 所以调整了里面的顺序之后还是原来的节点
+	group := &joinGroup{}
+	plan.collectJoinGroup(group)
+	for _, leaf := range group.leaves {
+		mb.orderJoins(leaf)
+	}
+	order, ok := mb.chooseJoinOrder(plan, group)
+	if !ok {
+		plan.rebuildColumns()
+		return plan
+	}
+	return group.build(order)
+}
+
+// 内连接和CROSS JOIN可以和相邻的内连接一起调整顺序
+func (plan *fromPlan) reorderable() bool {
+	return plan.kind == joinPlanKind && (plan.joinType == parser.InnerJoin || plan.joinType == parser.CrossJoin)
+}
+
+// 找出一组内连接的叶子节点和连接条件, 叶子节点按原来从左到右的顺序
+func (plan *fromPlan) collectJoinGroup(group *joinGroup) {
+	if !plan.reorderable() {
+		group.leaves = append(group.leaves, plan)
+		return
+	}
+	plan.left.collectJoinGroup(group)
+	plan.right.collectJoinGroup(group)
+	if plan.on != nil {
+		group.conds = append(group.conds, splitConjuncts(plan.on)...)
+	}
+}
+
+// 叶子节点的列顺序变了之后, 重新计算一组内连接里每个连接的列
+func (plan *fromPlan) rebuildColumns() {
+	if !plan.reorderable() {
+		return
+	}
+	plan.left.rebuildColumns()
+	plan.right.rebuildColumns()
+	plan.columns = append(append([]contextColumn{}, plan.left.columns...), plan.right.columns...)
+}
+
+// 估算连接了mask里的叶子节点之后的行数
+func (group *joinGroup) estimate(mask uint) float64 {
+	rows := 1.0
+	for i, r := range group.rows {
+		if mask&(1<<i) != 0 {
+			rows *= r
+		}
+	}
+	for k, m := range group.masks {
+		if m&mask == m {
+			rows *= group.factors[k]
+		}
+	}
+	return rows
+}
+
+// 估算每个叶子节点的行数和每个连接条件的选择率, 然后按代价选择叶子节点的顺序
+// 返回false时保持原来的顺序
+func (mb *MemoryBackend) chooseJoinOrder(plan *fromPlan, group *joinGroup) ([]int, bool) {
+	// 只有两个叶子节点时没有中间结果, 叶子节点太多时mask放不下
+	if len(group.leaves) < 3 || len(group.leaves) > bits.UintSize {
+		return nil, false
+	}
+
+	columns := []contextColumn{}
+	stats := []*columnStats{}
+	owners := []int{} // 每一列属于哪个叶子节点
+	for i, leaf := range group.leaves {
+		rows, ok := mb.estimateScan(leaf)
+		if !ok {
+			return nil, false
+		}
+		group.rows = append(group.rows, rows)
+		columns = append(columns, leaf.columns...)
+		stats = append(stats, leaf.columnStats()...)
+		for range leaf.columns {
+			owners = append(owners, i)
+		}
+	}
+
+	// 有子查询或者列名在整组里有歧义的条件不知道该放到哪个连接上, 这时不调整顺序
+	for _, cond := range group.conds {
+		refs, err := referencedColumns(cond, columns)
+		if err != nil {
+			return nil, false
+		}
+		mask := uint(0)
+		for _, i := range refs {
+			mask |= 1 << owners[i]
+		}
+		group.masks = append(group.masks, mask)
+		group.factors = append(group.factors, mb.selectivity(cond, columns, stats))
+	}
+
+	// 从两个叶子节点开始, 每次加上让中间结果最小的一个, 一样小的时候选原来在前面的
+	var order []int
+	cost := math.Inf(1)
+	for i := range group.leaves {
+		for j := i + 1; j < len(group.leaves); j++ {
+			if rows := group.estimate(1<<i | 1<<j); rows < cost {
+				order, cost = []int{i, j}, rows
+			}
+		}
+	}
+	mask := uint(1)<<order[0] | 1<<order[1]
+	for len(order) < len(group.leaves)-1 {
+		next, rows := -1, math.Inf(1)
+		for k := range group.leaves {
+			if mask&(1<<k) == 0 && group.estimate(mask|1<<k) < rows {
+				next, rows = k, group.estimate(mask|1<<k)
+			}
+		}
+		order = append(order, next)
+		mask |= 1 << next
+		cost += rows
+	}
+	for k := range group.leaves {
+		if mask&(1<<k) == 0 {
+			order = append(order, k)
+		}
+	}
+
+	if cost >= group.originalCost(plan) {
+		return nil, false
+	}
+	return order, true
+}
+
+// 原来的顺序的代价: 除了最上面的连接, 每个连接估算的行数之和
+func (group *joinGroup) originalCost(plan *fromPlan) float64 {
+	leaf := 0
+	cost := 0.0
+	var walk func(plan *fromPlan) uint
+	walk = func(plan *fromPlan) uint {
+		if !plan.reorderable() {
+			leaf++
+			return 1 << (leaf - 1)
+		}
+		mask := walk(plan.left) | walk(plan.right)
+		cost += group.estimate(mask)
+		return mask
+	}
+	return cost - group.estimate(walk(plan))
+}
+
+// 按顺序把叶子节点连成一棵往左边长的树, 每个连接条件放在第一个包含它引用的所有叶子节点的连接上
+func (group *joinGroup) build(order []int) *fromPlan {
+	plan := group.leaves[order[0]]
+	mask := uint(1) << order[0]
+	used := make([]bool, len(group.conds))
+	for _, k := range order[1:] {
+		right := group.leaves[k]
+		mask |= 1 << k
+
+		conds := []*parser.Expression{}
+		for c, m := range group.masks {
+			if !used[c] && m&mask == m {
+				used[c] = true
+				conds = append(conds, group.conds[c])
+			}
+		}
+		typ := parser.InnerJoin
+		if len(conds) == 0 {
+			typ = parser.CrossJoin
+		}
+
+		plan = &fromPlan{
+			columns:  append(append([]contextColumn{}, plan.columns...), right.columns...),
+			left:     plan,
+			right:    right,
+			joinType: typ,
+			on:       joinConjuncts(conds),
+			kind:     joinPlanKind,
+		}
+	}
+	return plan
+}
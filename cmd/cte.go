@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/database-from-zero-to-one/parser"
+)
+
+// WITH 和 公共表表达式(CTE)
+// 每个CTE只执行一次, 结果放在一张临时的表里, 后面的CTE和主查询扫描的就是这张临时表
+// WITH RECURSIVE 里引用了自己的CTE必须是 $非递归的部分 UNION [ALL] $递归的部分,
+// 先执行非递归的部分, 然后不断用上一轮新产生的行执行递归的部分, 直到不再产生新的行
+
+// 递归的CTE最多迭代多少轮, 防止写错了终止条件的查询一直执行下去
+const maxRecursion = 1000
+
+// 按名字找表, CTE的名字优先于同名的表, 里层WITH的CTE优先于外层的
+func (mb *MemoryBackend) lookupTable(name string) (*table, bool, bool) {
+	for i := len(mb.ctes) - 1; i >= 0; i-- {
+		if t, ok := mb.ctes[i][name]; ok {
+			return t, true, true
+		}
+	}
+	t, ok := mb.tables[name]
+	return t, false, ok
+}
+
+// 先执行WITH里的每个CTE, 然后在能看到这些CTE的情况下执行主查询
+func (mb *MemoryBackend) queryWith(slct *parser.SelectStatement, outer *rowContext, columnsOnly bool) (*Results, error) {
+	scope := map[string]*table{}
+	mb.ctes = append(mb.ctes, scope)
+	defer func() {
+		mb.ctes = mb.ctes[:len(mb.ctes)-1]
+	}()
+
+	for _, cte := range slct.With.Ctes {
+		if _, ok := scope[cte.Name.Value]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateTableName, cte.Name.Value)
+		}
+
+		t, err := mb.materializeCte(slct.With, cte, scope, columnsOnly)
+		if err != nil {
+			return nil, err
+		}
+		scope[cte.Name.Value] = t
+	}
+
+	body := *slct
+	body.With = nil
+	return mb.query(&body, outer, columnsOnly)
+}
+
+// 执行一个CTE并把结果放进一张临时表, columnsOnly为true时临时表里只有列没有行
+func (mb *MemoryBackend) materializeCte(with *parser.WithClause, cte *parser.CommonTableExpression, scope map[string]*table, columnsOnly bool) (*table, error) {
+	recursive := isRecursiveCte(with, cte)
+	anchor := cte.Select
+	if recursive {
+		if len(cte.Select.OrderBy) > 0 || cte.Select.Limit != nil || cte.Select.Offset != nil {
+			return nil, fmt.Errorf("%w: ORDER BY, LIMIT and OFFSET are not allowed in recursive query %s", ErrInvalidRecursion, cte.Name.Value)
+		}
+		anchor = cte.Select.Compound.Left
+	}
+
+	results, err := mb.query(anchor, nil, columnsOnly)
+	if err != nil {
+		return nil, err
+	}
+	t, err := cteTable(cte, results)
+	if err != nil {
+		return nil, err
+	}
+	if !recursive {
+		return t, nil
+	}
+
+	// 递归的部分扫描的是工作表, 也就是上一轮新产生的行
+	work := &table{
+		Columns:     t.Columns,
+		ColumnTypes: t.ColumnTypes,
+	}
+	scope[cte.Name.Value] = work
+
+	term := cte.Select.Compound.Right
+	right, err := mb.query(term, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(right.Columns) != len(t.Columns) {
+		return nil, fmt.Errorf("%w: recursive term of WITH query %s has %d columns but non-recursive term has %d columns", ErrCteColumnMismatch, cte.Name.Value, len(right.Columns), len(t.Columns))
+	}
+	for i, col := range right.Columns {
+		if !isType(col.Type, t.ColumnTypes[i]) {
+			return nil, fmt.Errorf("%w: recursive query %s column %d is %s and %s", ErrTypeMismatch, cte.Name.Value, i+1, t.ColumnTypes[i], col.Type)
+		}
+	}
+	if columnsOnly {
+		return t, nil
+	}
+
+	// 没有ALL的时候, 只保留之前没出现过的行
+	all := cte.Select.Compound.All
+	seen := map[string]bool{}
+	if !all {
+		rows := [][]MemoryCell{}
+		for _, row := range t.rows {
+			key := groupKey(row)
+			if !seen[key] {
+				seen[key] = true
+				rows = append(rows, row)
+			}
+		}
+		t.rows = rows
+	}
+
+	work.rows = t.rows
+	for iteration := 0; len(work.rows) > 0; iteration++ {
+		if iteration >= maxRecursion {
+			return nil, fmt.Errorf("%w: %s did not finish after %d iterations", ErrInvalidRecursion, cte.Name.Value, maxRecursion)
+		}
+
+		results, err := mb.query(term, nil, false)
+		if err != nil {
+			return nil, err
+		}
+
+		rows := [][]MemoryCell{}
+		for _, result := range results.Rows {
+			row := []MemoryCell{}
+			for _, cell := range result {
+				row = append(row, cell.(MemoryCell))
+			}
+			if !all {
+				key := groupKey(row)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+			}
+			rows = append(rows, row)
+		}
+
+		t.rows = append(t.rows, rows...)
+		work.rows = rows
+	}
+	return t, nil
+}
+
+// 把CTE的查询结果变成一张表, CTE后面写了列名时用这些列名
+func cteTable(cte *parser.CommonTableExpression, results *Results) (*table, error) {
+	if len(cte.Columns) > 0 && len(cte.Columns) != len(results.Columns) {
+		return nil, fmt.Errorf("%w: WITH query %s has %d columns available but %d columns specified", ErrCteColumnMismatch, cte.Name.Value, len(results.Columns), len(cte.Columns))
+	}
+
+	t := table{}
+	for i, col := range results.Columns {
+		name := col.Name
+		if len(cte.Columns) > 0 {
+			name = cte.Columns[i].Value
+		}
+		t.Columns = append(t.Columns, name)
+		t.ColumnTypes = append(t.ColumnTypes, col.Type)
+		t.ColumnDefaults = append(t.ColumnDefaults, nil)
+	}
+
+	for _, result := range results.Rows {
+		row := []MemoryCell{}
+		for _, cell := range result {
+			row = append(row, cell.(MemoryCell))
+		}
+		t.rows = append(t.rows, row)
+	}
+	return &t, nil
+}
+
+// WITH RECURSIVE 里, 形如 ... UNION [ALL] ... 并且右边引用了自己的CTE才是递归的
+func isRecursiveCte(with *parser.WithClause, cte *parser.CommonTableExpression) bool {
+	compound := cte.Select.Compound
+	return with.Recursive && compound != nil && compound.Operator == parser.UnionOperator &&
+		selectReferencesTable(compound.Right, cte.Name.Value)
+}
+
+// 查询里有没有任何地方(包括子查询)用到了这个名字的表
+func selectReferencesTable(slct *parser.SelectStatement, name string) bool {
+	if slct.Compound != nil {
+		return selectReferencesTable(slct.Compound.Left, name) || selectReferencesTable(slct.Compound.Right, name)
+	}
+
+	for _, ref := range slct.From {
+		if tableReferenceReferencesTable(ref, name) {
+			return true
+		}
+	}
+
+	exps := append([]*parser.Expression{slct.Where, slct.Having}, slct.GroupBy...)
+	for _, item := range slct.Item {
+		exps = append(exps, item.Exp)
+	}
+	for _, exp := range exps {
+		if exp != nil && expressionReferencesTable(exp, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func tableReferenceReferencesTable(ref *parser.TableReference, name string) bool {
+	switch ref.Kind {
+	case parser.TableNameKind:
+		return ref.Table.Value == name
+	case parser.JoinedTableKind:
+		return tableReferenceReferencesTable(ref.Join.Left, name) ||
+			tableReferenceReferencesTable(ref.Join.Right, name) ||
+			(ref.Join.On != nil && expressionReferencesTable(ref.Join.On, name))
+	case parser.DerivedTableKind:
+		return selectReferencesTable(ref.Select, name)
+	}
+	return false
+}
+
+func expressionReferencesTable(exp *parser.Expression, name string) bool {
+	switch exp.Kind {
+	case parser.UnaryKind:
+		return expressionReferencesTable(&exp.Unary.Operand, name)
+	case parser.BinaryKind:
+		return expressionReferencesTable(&exp.Binary.A, name) || expressionReferencesTable(&exp.Binary.B, name)
+	case parser.FunctionKind:
+		for _, arg := range exp.Function.Args {
+			if expressionReferencesTable(arg, name) {
+				return true
+			}
+		}
+	case parser.SubqueryKind, parser.ExistsKind:
+		return selectReferencesTable(exp.Select, name)
+	case parser.InKind:
+		if expressionReferencesTable(&exp.In.Left, name) {
+			return true
+		}
+		for _, value := range exp.In.List {
+			if expressionReferencesTable(value, name) {
+				return true
+			}
+		}
+		return exp.In.Select != nil && selectReferencesTable(exp.In.Select, name)
+	case parser.IsNullKind:
+		return expressionReferencesTable(&exp.IsNull.Operand, name)
+	}
+	return false
+}
+
+// EXPLAIN 的时候不执行CTE, 只显示每个CTE的执行计划
+func (mb *MemoryBackend) explainWith(slct *parser.SelectStatement) ([]string, error) {
+	scope := map[string]*table{}
+	mb.ctes = append(mb.ctes, scope)
+	defer func() {
+		mb.ctes = mb.ctes[:len(mb.ctes)-1]
+	}()
+
+	ctes := []string{}
+	for _, cte := range slct.With.Ctes {
+		t, err := mb.materializeCte(slct.With, cte, scope, true)
+		if err != nil {
+			return nil, err
+		}
+		scope[cte.Name.Value] = t
+
+		var lines []string
+		if isRecursiveCte(slct.With, cte) {
+			left, err := mb.explainSelect(cte.Select.Compound.Left)
+			if err != nil {
+				return nil, err
+			}
+			right, err := mb.explainSelect(cte.Select.Compound.Right)
+			if err != nil {
+				return nil, err
+			}
+			step := "Recursive Union"
+			if cte.Select.Compound.All {
+				step += " All"
+			}
+			lines = append([]string{step}, explainChildren(left, right)...)
+		} else {
+			lines, err = mb.explainSelect(cte.Select)
+			if err != nil {
+				return nil, err
+			}
+		}
+		ctes = append(ctes, explainStep("CTE "+cte.Name.Value, lines)...)
+	}
+
+	body := *slct
+	body.With = nil
+	lines, err := mb.explainSelect(&body)
+	if err != nil {
+		return nil, err
+	}
+	return append(lines, ctes...), nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/database-from-zero-to-one/parser"
+)
+
+// EXPLAIN 显示SELECT会怎么执行, 结果只有一列, 每一行是执行计划的一行
+// 执行计划从上往下读: 上面的步骤处理下面的步骤输出的行
+func (mb *MemoryBackend) Explain(explain *parser.ExplainStatement) (*Results, error) {
+	lines, err := mb.explainSelect(explain.Select)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := [][]Cell{}
+	for _, line := range lines {
+		rows = append(rows, []Cell{textCell(line)})
+	}
+	return &Results{
+		Columns: []ResultColumn{{
+			Type: TextType,
+			Name: "QUERY PLAN",
+		}},
+		Rows: rows,
+	}, nil
+}
+
+func (mb *MemoryBackend) explainSelect(slct *parser.SelectStatement) ([]string, error) {
+	if slct.With != nil {
+		return mb.explainWith(slct)
+	}
+
+	if slct.Compound == nil {
+		return mb.explainQuery(slct)
+	}
+
+	left, err := mb.explainSelect(slct.Compound.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := mb.explainSelect(slct.Compound.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	op := setOperatorNames[slct.Compound.Operator]
+	step := op[:1] + strings.ToLower(op[1:])
+	if slct.Compound.All {
+		step += " All"
+	}
+	lines := append([]string{step}, explainChildren(left, right)...)
+
+	if len(slct.OrderBy) > 0 {
+		keys := []string{}
+		for _, item := range slct.OrderBy {
+			key := item.Exp.String()
+			if item.Desc {
+				key += " desc"
+			}
+			keys = append(keys, key)
+		}
+		lines = explainStep("Sort: "+strings.Join(keys, ", "), lines)
+	}
+	if slct.Limit != nil || slct.Offset != nil {
+		step := "Limit"
+		if slct.Limit != nil {
+			step += " " + slct.Limit.String()
+		}
+		if slct.Offset != nil {
+			step += " offset " + slct.Offset.String()
+		}
+		lines = explainStep(step, lines)
+	}
+	return lines, nil
+}
+
+// 显示一个SELECT改写之后的物理计划
+func (mb *MemoryBackend) explainQuery(slct *parser.SelectStatement) ([]string, error) {
+	plan, err := mb.planSelect(slct, nil)
+	if err != nil {
+		return nil, err
+	}
+	op, _ := mb.physicalPlan(plan.root, nil)
+	return op.explain()
+}
+
+// 在已有的计划上面加一个步骤
+func explainStep(step string, child []string) []string {
+	return append([]string{step}, explainChildren(child)...)
+}
+
+// 用逗号把多个表达式连起来
+func expressionsString(exps []*parser.Expression) string {
+	s := []string{}
+	for _, exp := range exps {
+		s = append(s, exp.String())
+	}
+	return strings.Join(s, ", ")
+}
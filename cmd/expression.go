@@ -0,0 +1,504 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/database-from-zero-to-one/lexer"
+	"github.com/database-from-zero-to-one/parser"
+)
+
+// 表达式求值
+// 所有的后端操作(SELECT的列、WHERE、INSERT的值)都通过这里来计算表达式的值
+
+// 求值时能看到的一列
+type contextColumn struct {
+	Table string // 列所在的表名或者表的别名, 用来查找 t.col 这样的限定列名
+	Name  string
+	Type  ColumnType
+	Outer int // 子查询里能看到外层查询的列, 0是当前查询自己的列, 1是外面一层的列, 以此类推
+}
+
+// 行上下文, 表达式中的标识符会在这里找到对应列的值
+// 子查询的上下文里, columns 先是子查询自己的列, 然后是外层查询的所有列
+// row 只有子查询自己的列的值, 外层的列的值在outer里找
+type rowContext struct {
+	columns []contextColumn
+	row     []MemoryCell
+	outer   *rowContext // 外层查询当前的一行, 不是子查询时为nil
+}
+
+// 子查询能看到的列: 自己的列加上外层查询能看到的所有列
+func scopeColumns(columns []contextColumn, outer *rowContext) []contextColumn {
+	if outer == nil {
+		return columns
+	}
+
+	scope := append([]contextColumn{}, columns...)
+	for _, col := range outer.columns {
+		col.Outer++
+		scope = append(scope, col)
+	}
+	return scope
+}
+
+// 上下文中第i列的值
+func (ctx *rowContext) value(i int) MemoryCell {
+	if i < len(ctx.row) || ctx.outer == nil {
+		return ctx.row[i]
+	}
+	return ctx.outer.value(i - len(ctx.row))
+}
+
+// 表的每一列都可以在表达式里使用, name是在表达式里引用这张表时用的名字
+func (t *table) contextColumns(name string) []contextColumn {
+	columns := []contextColumn{}
+	for i, col := range t.Columns {
+		columns = append(columns, contextColumn{
+			Table: name,
+			Name:  col,
+			Type:  t.ColumnTypes[i],
+		})
+	}
+	return columns
+}
+
+// 根据列名找到列在上下文中的位置, table不为空时只在这张表的列里找
+// 不限定表名时, 如果有多张表都有这一列就不知道指的是哪一列了
+// 子查询里优先用里层的列, 里层没有时才去外层找
+func lookupColumn(columns []contextColumn, table, name string) (int, error) {
+	found := -1
+	for i, col := range columns {
+		if col.Name != name || (table != "" && col.Table != table) {
+			continue
+		}
+		if found >= 0 && columns[found].Outer < col.Outer {
+			break
+		}
+		if found >= 0 {
+			return 0, fmt.Errorf("%w: %s", ErrAmbiguousColumn, qualifiedName(table, name))
+		}
+		found = i
+	}
+	if found < 0 {
+		return 0, fmt.Errorf("%w: %s", ErrColumnDoesNotExist, qualifiedName(table, name))
+	}
+	return found, nil
+}
+
+// 找到标识符表达式引用的列
+func lookupIdentifier(columns []contextColumn, exp *parser.Expression) (int, error) {
+	table := ""
+	if exp.Table != nil {
+		table = exp.Table.Value
+	}
+	return lookupColumn(columns, table, exp.Literal.Value)
+}
+
+// 带表名的列名, 用在错误信息里
+func qualifiedName(table, name string) string {
+	if table == "" {
+		return name
+	}
+	return table + "." + name
+}
+
+// 字面量的类型
+func literalType(columns []contextColumn, exp *parser.Expression) (ColumnType, error) {
+	switch exp.Literal.Kind {
+	case lexer.IdentifierKind:
+		i, err := lookupIdentifier(columns, exp)
+		if err != nil {
+			return 0, err
+		}
+		return columns[i].Type, nil
+	case lexer.NumericKind:
+		return IntType, nil
+	case lexer.StringKind:
+		return TextType, nil
+	case lexer.BoolKind:
+		return BoolType, nil
+	case lexer.NullKind:
+		return NullType, nil
+	}
+	return 0, ErrInvalidDataType
+}
+
+// NULL字面量可以当作任何类型使用, 两个类型可以放在一起比较或者合并时返回它们共同的类型
+func commonType(a, b ColumnType) (ColumnType, bool) {
+	switch {
+	case a == NullType:
+		return b, true
+	case b == NullType:
+		return a, true
+	}
+	return a, a == b
+}
+
+// 一元操作符的类型规则: NOT 作用于bool, 正负号作用于int
+func unaryResultType(op lexer.Token, operand ColumnType) (ColumnType, error) {
+	expected := IntType
+	if op.Kind == lexer.KeywordKind && lexer.Keyword(op.Value) == lexer.NotKeyword {
+		expected = BoolType
+	}
+
+	if _, ok := commonType(operand, expected); !ok {
+		return 0, fmt.Errorf("%w: operator %s expects %s, got %s", ErrTypeMismatch, op.Value, expected, operand)
+	}
+	return expected, nil
+}
+
+// 二元操作符的类型规则:
+// AND OR 两边都是bool, 结果是bool
+// 算术操作两边都是int, 结果是int
+// 比较操作两边类型相同, 结果是bool
+func binaryResultType(op lexer.Token, a, b ColumnType) (ColumnType, error) {
+	switch op.Kind {
+	case lexer.KeywordKind:
+		switch lexer.Keyword(op.Value) {
+		case lexer.AndKeyword, lexer.OrKeyword:
+			if !isType(a, BoolType) || !isType(b, BoolType) {
+				return 0, fmt.Errorf("%w: operator %s expects bool operands, got %s and %s", ErrTypeMismatch, op.Value, a, b)
+			}
+			return BoolType, nil
+		}
+	case lexer.SymbolKind:
+		switch lexer.Symbol(op.Value) {
+		case lexer.PlusSymbol, lexer.MinusSymbol, lexer.AsterisSymbol, lexer.SlashSymbol, lexer.PercentSymbol:
+			if !isType(a, IntType) || !isType(b, IntType) {
+				return 0, fmt.Errorf("%w: operator %s expects int operands, got %s and %s", ErrTypeMismatch, op.Value, a, b)
+			}
+			return IntType, nil
+		case lexer.EqualSymbol, lexer.NotEqualSymbol,
+			lexer.LessSymbol, lexer.LessEqualSymbol,
+			lexer.GreaterSymbol, lexer.GreaterEqualSymbol:
+			if _, ok := commonType(a, b); !ok {
+				return 0, fmt.Errorf("%w: cannot compare %s with %s", ErrTypeMismatch, a, b)
+			}
+			return BoolType, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrInvalidOperator, op.Value)
+}
+
+// 值是不是可以当作这个类型使用, NULL可以当作任何类型
+func isType(typ, expected ColumnType) bool {
+	_, ok := commonType(typ, expected)
+	return ok
+}
+
+// 不求值, 只检查表达式的类型是否正确, 并返回表达式的类型
+func (mb *MemoryBackend) expressionType(columns []contextColumn, exp *parser.Expression) (ColumnType, error) {
+	switch exp.Kind {
+	case parser.LiteralKind:
+		return literalType(columns, exp)
+	case parser.UnaryKind:
+		operand, err := mb.expressionType(columns, &exp.Unary.Operand)
+		if err != nil {
+			return 0, err
+		}
+		return unaryResultType(exp.Unary.Op, operand)
+	case parser.BinaryKind:
+		a, err := mb.expressionType(columns, &exp.Binary.A)
+		if err != nil {
+			return 0, err
+		}
+		b, err := mb.expressionType(columns, &exp.Binary.B)
+		if err != nil {
+			return 0, err
+		}
+		return binaryResultType(exp.Binary.Op, a, b)
+	case parser.FunctionKind:
+		return 0, functionError(exp.Function)
+	case parser.SubqueryKind:
+		return mb.scalarSubqueryType(columns, exp.Select)
+	case parser.ExistsKind:
+		if _, err := mb.query(exp.Select, &rowContext{columns: columns}, true); err != nil {
+			return 0, err
+		}
+		return BoolType, nil
+	case parser.InKind:
+		return mb.inType(columns, exp.In)
+	case parser.IsNullKind:
+		if _, err := mb.expressionType(columns, &exp.IsNull.Operand); err != nil {
+			return 0, err
+		}
+		return BoolType, nil
+	}
+	return 0, ErrInvalidOperator
+}
+
+// 目前只有聚合函数, 聚合函数在聚合之前就会被替换掉, 所以能走到这里的函数调用都是错误的
+func functionError(fn *parser.FunctionCall) error {
+	if isAggregateFunction(fn) {
+		return fmt.Errorf("%w: %s is not allowed here", ErrInvalidAggregate, fn.Name.Value)
+	}
+	return fmt.Errorf("%w: %s", ErrFunctionDoesNotExist, fn.Name.Value)
+}
+
+// 检查WHERE这类过滤条件的类型, 过滤条件必须是bool, 没有条件时不用检查
+func (mb *MemoryBackend) checkCondition(columns []contextColumn, cond *parser.Expression, clause string) error {
+	if cond == nil {
+		return nil
+	}
+
+	typ, err := mb.expressionType(columns, cond)
+	if err != nil {
+		return err
+	}
+	if !isType(typ, BoolType) {
+		return fmt.Errorf("%w: %s expects bool, got %s", ErrTypeMismatch, clause, typ)
+	}
+	return nil
+}
+
+// 判断某一行是否满足过滤条件, 没有条件时所有的行都满足, 条件的结果是NULL时不满足
+func (mb *MemoryBackend) matchCondition(ctx *rowContext, cond *parser.Expression) (bool, error) {
+	if cond == nil {
+		return true, nil
+	}
+
+	cell, _, err := mb.evaluateCell(ctx, cond)
+	if err != nil {
+		return false, err
+	}
+	return !cell.IsNull() && cell.AsBool(), nil
+}
+
+// 计算表达式在某一行上下文中的值, 同时返回值的类型
+func (mb *MemoryBackend) evaluateCell(ctx *rowContext, exp *parser.Expression) (MemoryCell, ColumnType, error) {
+	switch exp.Kind {
+	case parser.LiteralKind:
+		return mb.evaluateLiteral(ctx, exp)
+	case parser.UnaryKind:
+		return mb.evaluateUnary(ctx, exp.Unary)
+	case parser.BinaryKind:
+		return mb.evaluateBinary(ctx, exp.Binary)
+	case parser.FunctionKind:
+		return nil, 0, functionError(exp.Function)
+	case parser.SubqueryKind:
+		return mb.evaluateScalarSubquery(ctx, exp.Select)
+	case parser.ExistsKind:
+		results, err := mb.query(exp.Select, ctx, false)
+		if err != nil {
+			return nil, 0, err
+		}
+		return boolCell(len(results.Rows) > 0), BoolType, nil
+	case parser.InKind:
+		return mb.evaluateIn(ctx, exp.In)
+	case parser.IsNullKind:
+		cell, _, err := mb.evaluateCell(ctx, &exp.IsNull.Operand)
+		if err != nil {
+			return nil, 0, err
+		}
+		return boolCell(cell.IsNull() != exp.IsNull.Not), BoolType, nil
+	}
+	return nil, 0, ErrInvalidOperator
+}
+
+func (mb *MemoryBackend) evaluateLiteral(ctx *rowContext, exp *parser.Expression) (MemoryCell, ColumnType, error) {
+	lit := exp.Literal
+	switch lit.Kind {
+	case lexer.IdentifierKind:
+		i, err := lookupIdentifier(ctx.columns, exp)
+		if err != nil {
+			return nil, 0, err
+		}
+		return ctx.value(i), ctx.columns[i].Type, nil
+	case lexer.NumericKind:
+		cell, err := intLiteral(lit.Value)
+		return cell, IntType, err
+	case lexer.StringKind:
+		return textCell(lit.Value), TextType, nil
+	case lexer.BoolKind:
+		return boolCell(lit.Value == string(lexer.TrueKeyword)), BoolType, nil
+	case lexer.NullKind:
+		return nullCell(), NullType, nil
+	}
+	return nil, 0, ErrInvalidDataType
+}
+
+// 数字字面量先按int64解析, 再检查是否在int的范围里
+func intLiteral(value string) (MemoryCell, error) {
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			return nil, fmt.Errorf("%w: %s", ErrOutOfRange, value)
+		}
+		return nil, fmt.Errorf("%w: %s is not a valid int", ErrInvalidDataType, value)
+	}
+	return intResult(i)
+}
+
+func (mb *MemoryBackend) evaluateUnary(ctx *rowContext, unary *parser.UnaryExpression) (MemoryCell, ColumnType, error) {
+	// -2147483648 里的 2147483648 单独看超出了int的范围, 所以负号和数字一起解析
+	// 词法分析有时会把负号当作数字的一部分, 这时再取负就是去掉负号
+	operandExp := &unary.Operand
+	if unary.Op.Value == string(lexer.MinusSymbol) && operandExp.Kind == parser.LiteralKind && operandExp.Literal.Kind == lexer.NumericKind {
+		value := "-" + operandExp.Literal.Value
+		if strings.HasPrefix(operandExp.Literal.Value, "-") {
+			value = operandExp.Literal.Value[1:]
+		}
+		cell, err := intLiteral(value)
+		return cell, IntType, err
+	}
+
+	operand, operandType, err := mb.evaluateCell(ctx, &unary.Operand)
+	if err != nil {
+		return nil, 0, err
+	}
+	typ, err := unaryResultType(unary.Op, operandType)
+	if err != nil {
+		return nil, 0, err
+	}
+	if operand.IsNull() {
+		return nullCell(), typ, nil
+	}
+
+	switch unary.Op.Value {
+	case string(lexer.NotKeyword):
+		return boolCell(!operand.AsBool()), typ, nil
+	case string(lexer.MinusSymbol):
+		cell, err := intResult(-int64(operand.AsInt()))
+		return cell, typ, err
+	}
+	return operand, typ, nil
+}
+
+// int的运算先用int64算出结果, 超出int32的范围时报错, 而不是悄悄地溢出成一个错误的值
+func intResult(i int64) (MemoryCell, error) {
+	if i < math.MinInt32 || i > math.MaxInt32 {
+		return nil, fmt.Errorf("%w: %d", ErrOutOfRange, i)
+	}
+	return intCell(int32(i)), nil
+}
+
+func (mb *MemoryBackend) evaluateBinary(ctx *rowContext, bin *parser.BinaryExpression) (MemoryCell, ColumnType, error) {
+	a, aType, err := mb.evaluateCell(ctx, &bin.A)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// AND 和 OR 是短路求值的, 这样 b <> 0 AND a / b > 1 才不会出错
+	// 左边是NULL时结果还不确定, 要看右边的值
+	if aType == BoolType && bin.Op.Kind == lexer.KeywordKind && !a.IsNull() {
+		switch lexer.Keyword(bin.Op.Value) {
+		case lexer.AndKeyword:
+			if !a.AsBool() {
+				return boolCell(false), BoolType, nil
+			}
+		case lexer.OrKeyword:
+			if a.AsBool() {
+				return boolCell(true), BoolType, nil
+			}
+		}
+	}
+
+	b, bType, err := mb.evaluateCell(ctx, &bin.B)
+	if err != nil {
+		return nil, 0, err
+	}
+	typ, err := binaryResultType(bin.Op, aType, bType)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch bin.Op.Value {
+	case string(lexer.AndKeyword), string(lexer.OrKeyword):
+		return threeValuedLogic(bin.Op.Value, a, b), typ, nil
+	}
+
+	// 其他的操作符只要有一边是NULL, 结果就是NULL
+	if a.IsNull() || b.IsNull() {
+		return nullCell(), typ, nil
+	}
+
+	switch bin.Op.Value {
+	case string(lexer.PlusSymbol), string(lexer.MinusSymbol), string(lexer.AsterisSymbol), string(lexer.SlashSymbol), string(lexer.PercentSymbol):
+		cell, err := evaluateArithmetic(bin.Op.Value, int64(a.AsInt()), int64(b.AsInt()))
+		return cell, typ, err
+	}
+
+	cmp := compareCells(a, b, aType)
+	switch bin.Op.Value {
+	case string(lexer.EqualSymbol):
+		return boolCell(cmp == 0), typ, nil
+	case string(lexer.NotEqualSymbol):
+		return boolCell(cmp != 0), typ, nil
+	case string(lexer.LessSymbol):
+		return boolCell(cmp < 0), typ, nil
+	case string(lexer.LessEqualSymbol):
+		return boolCell(cmp <= 0), typ, nil
+	case string(lexer.GreaterSymbol):
+		return boolCell(cmp > 0), typ, nil
+	case string(lexer.GreaterEqualSymbol):
+		return boolCell(cmp >= 0), typ, nil
+	}
+	return nil, 0, fmt.Errorf("%w: %s", ErrInvalidOperator, bin.Op.Value)
+}
+
+// 算术运算, 两边都不是NULL
+func evaluateArithmetic(op string, a, b int64) (MemoryCell, error) {
+	switch op {
+	case string(lexer.PlusSymbol):
+		return intResult(a + b)
+	case string(lexer.MinusSymbol):
+		return intResult(a - b)
+	case string(lexer.AsterisSymbol):
+		return intResult(a * b)
+	case string(lexer.SlashSymbol):
+		if b == 0 {
+			return nil, ErrDivisionByZero
+		}
+		return intResult(a / b)
+	}
+	if b == 0 {
+		return nil, ErrDivisionByZero
+	}
+	return intResult(a % b)
+}
+
+// 三值逻辑, 左边的值不能决定结果时才会走到这里:
+// 左边是NULL, 或者 AND 的左边是true, 或者 OR 的左边是false
+// 右边能决定结果时(AND 的false, OR 的true)结果就是右边的值, 否则只要有NULL结果就是NULL
+func threeValuedLogic(op string, a, b MemoryCell) MemoryCell {
+	if !b.IsNull() && b.AsBool() == (op == string(lexer.OrKeyword)) {
+		return b
+	}
+	if a.IsNull() {
+		return nullCell()
+	}
+	return b
+}
+
+// 比较两个同类型的值, a < b 返回负数, a == b 返回0, a > b 返回正数
+// 和排序一样, NULL被当作最大的值, 两个NULL相等
+func compareCells(a, b MemoryCell, typ ColumnType) int {
+	if a.IsNull() || b.IsNull() {
+		switch {
+		case a.IsNull() && b.IsNull():
+			return 0
+		case a.IsNull():
+			return 1
+		}
+		return -1
+	}
+
+	switch typ {
+	case IntType:
+		ai, bi := a.AsInt(), b.AsInt()
+		if ai < bi {
+			return -1
+		}
+		if ai > bi {
+			return 1
+		}
+		return 0
+	}
+	// text按字节序比较, bool的false(0)小于true(1)
+	return bytes.Compare(a, b)
+}
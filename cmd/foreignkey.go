@@ -0,0 +1,396 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/database-from-zero-to-one/parser"
+)
+
+// 外键
+// INSERT, UPDATE 和 DELETE 都不直接修改表, 而是先把对各张表的修改记在changeSet里
+// 被引用的行被删除或修改时, 引用它的行按照外键的ON DELETE和ON UPDATE处理:
+// RESTRICT: 语句执行完之后还有行引用它时报错, 所以同一条语句里引用它的行也被删除或修改了就没有问题
+// CASCADE: 引用它的行也一起删除, 或者把外键的列改成新的值
+// SET NULL: 把引用它的行的外键的列改成NULL
+// 这些处理又可能修改别的表, 最后所有被修改的表都满足约束之后才一起写回去
+// 引用关系按语句执行之前的行来找, 这样一行被级联修改之后不会因为新的值正好等于另一行的旧值而被再改一次
+
+// 一条语句对各张表的修改
+type changeSet struct {
+	tables map[string]*tableChanges
+	order  []string // 第一次修改各张表的顺序, 检查约束时也按这个顺序
+}
+
+// 一张表修改之后的行
+type tableChanges struct {
+	rows    [][]MemoryCell // 被删除的行是nil, 写回去之前才去掉
+	changed map[int]bool   // 被插入或者被修改的行
+}
+
+func newChangeSet() *changeSet {
+	return &changeSet{
+		tables: map[string]*tableChanges{},
+	}
+}
+
+// 第一次修改一张表时, 先拷贝一份表里的行
+func (mb *MemoryBackend) tableChanges(cs *changeSet, name string) *tableChanges {
+	if tc, ok := cs.tables[name]; ok {
+		return tc
+	}
+
+	tc := &tableChanges{
+		rows:    append([][]MemoryCell{}, mb.tables[name].rows...),
+		changed: map[int]bool{},
+	}
+	cs.tables[name] = tc
+	cs.order = append(cs.order, name)
+	return tc
+}
+
+// 表在这条语句修改之后的所有行
+func (mb *MemoryBackend) currentRows(cs *changeSet, name string) [][]MemoryCell {
+	tc, ok := cs.tables[name]
+	if !ok {
+		return mb.tables[name].rows
+	}
+
+	rows := [][]MemoryCell{}
+	for _, row := range tc.rows {
+		if row != nil {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// 在表的最后插入一行
+func (mb *MemoryBackend) insertRow(cs *changeSet, name string, row []MemoryCell) {
+	tc := mb.tableChanges(cs, name)
+	tc.changed[len(tc.rows)] = true
+	tc.rows = append(tc.rows, row)
+}
+
+// 把第i行改成row, 这一行已经被删除时什么都不做
+func (mb *MemoryBackend) updateRow(cs *changeSet, name string, i int, row []MemoryCell) error {
+	tc := mb.tableChanges(cs, name)
+	old := tc.rows[i]
+	if old == nil {
+		return nil
+	}
+
+	tc.rows[i] = row
+	tc.changed[i] = true
+	return mb.referencedRowChanged(cs, name, mb.originalRow(name, i, old), old, row)
+}
+
+// 删除第i行, 这一行已经被删除时返回false
+func (mb *MemoryBackend) deleteRow(cs *changeSet, name string, i int) (bool, error) {
+	tc := mb.tableChanges(cs, name)
+	old := tc.rows[i]
+	if old == nil {
+		return false, nil
+	}
+
+	tc.rows[i] = nil
+	delete(tc.changed, i)
+	return true, mb.referencedRowChanged(cs, name, mb.originalRow(name, i, old), old, nil)
+}
+
+// 第i行在语句执行之前的值, 这条语句插入的行就用old
+func (mb *MemoryBackend) originalRow(name string, i int, old []MemoryCell) []MemoryCell {
+	if rows := mb.tables[name].rows; i < len(rows) {
+		return rows[i]
+	}
+	return old
+}
+
+// 按表名排序, 这样级联修改的顺序和报错的表总是一样的
+func sortedTableNames(tables map[string]*table) []string {
+	names := []string{}
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 表name里的一行从old被改成了row, row是nil时表示这一行被删除了, orig是这一行在语句执行之前的值
+// 找到所有引用它的行, 按照外键的动作处理: 语句执行之前就引用orig, 并且现在还引用old的行
+// 这样每一行只会跟着它原来引用的那一行修改, 不会因为先被级联改成了别的行的旧值而再被改一次
+func (mb *MemoryBackend) referencedRowChanged(cs *changeSet, name string, orig, old, row []MemoryCell) error {
+	for _, childName := range sortedTableNames(mb.tables) {
+		child := mb.tables[childName]
+		for _, c := range child.Constraints {
+			if c.Kind != parser.ForeignKeyConstraint || c.RefTable != name {
+				continue
+			}
+
+			// 旧值里有NULL的话不会有行引用它, 值没有变的话也不用处理
+			origKeys, oldKeys := rowKeys(orig, c.RefColumns), rowKeys(old, c.RefColumns)
+			if hasNull(origKeys) || hasNull(oldKeys) {
+				continue
+			}
+			action := c.OnDelete
+			var newKeys []MemoryCell
+			if row != nil {
+				newKeys = rowKeys(row, c.RefColumns)
+				if groupKey(oldKeys) == groupKey(newKeys) {
+					continue
+				}
+				action = c.OnUpdate
+			}
+
+			// 这条语句插入的行不会在语句执行之前就引用别的行, 所以只用看原来的行
+			rows := child.rows
+			if tc, ok := cs.tables[childName]; ok {
+				rows = tc.rows
+			}
+			matched := []int{}
+			for i, origRow := range child.rows {
+				if rows[i] == nil || groupKey(rowKeys(origRow, c.Columns)) != groupKey(origKeys) {
+					continue
+				}
+				if groupKey(rowKeys(rows[i], c.Columns)) == groupKey(oldKeys) {
+					matched = append(matched, i)
+				}
+			}
+			if len(matched) == 0 {
+				continue
+			}
+
+			// RESTRICT 在commit的时候检查
+			switch action {
+			case parser.CascadeAction:
+				for _, i := range matched {
+					if row == nil {
+						if _, err := mb.deleteRow(cs, childName, i); err != nil {
+							return err
+						}
+						continue
+					}
+
+					newRow := append([]MemoryCell{}, mb.tableChanges(cs, childName).rows[i]...)
+					for k, column := range c.Columns {
+						newRow[column] = newKeys[k]
+					}
+					if err := mb.updateRow(cs, childName, i, newRow); err != nil {
+						return err
+					}
+				}
+			case parser.SetNullAction:
+				for _, i := range matched {
+					newRow := append([]MemoryCell{}, mb.tableChanges(cs, childName).rows[i]...)
+					for _, column := range c.Columns {
+						newRow[column] = nullCell()
+					}
+					if err := mb.updateRow(cs, childName, i, newRow); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// 检查所有被修改的表都满足约束, 都满足之后才一起写回去
+func (mb *MemoryBackend) commit(cs *changeSet) error {
+	// 先去掉被删除的行, 这样检查约束时每张表的行都是最后的样子
+	// positions记下原来的每一行去掉被删除的行之后的位置, 更新索引的时候要用
+	positions := map[string][]int{}
+	for _, name := range cs.order {
+		tc := cs.tables[name]
+		rows := [][]MemoryCell{}
+		changed := map[int]bool{}
+		positions[name] = make([]int, len(tc.rows))
+		for i, row := range tc.rows {
+			positions[name][i] = len(rows)
+			if row == nil {
+				positions[name][i] = -1
+				continue
+			}
+			if tc.changed[i] {
+				changed[len(rows)] = true
+			}
+			rows = append(rows, row)
+		}
+		tc.rows, tc.changed = rows, changed
+	}
+
+	for _, name := range cs.order {
+		tc := cs.tables[name]
+		changed := []int{}
+		for i := range tc.rows {
+			if tc.changed[i] {
+				changed = append(changed, i)
+			}
+		}
+		if err := mb.checkConstraints(cs, mb.tables[name], tc.rows, changed); err != nil {
+			return err
+		}
+	}
+	for _, name := range cs.order {
+		if err := mb.checkReferencingRows(cs, name); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range cs.order {
+		t, tc := mb.tables[name], cs.tables[name]
+		t.updateIndexes(tc.rows, positions[name], tc.changed)
+		t.rows = tc.rows
+	}
+	return nil
+}
+
+// 检查被插入或者被修改的行引用的行都存在, 外键的列里有NULL时不检查
+func (mb *MemoryBackend) checkReferencedRows(cs *changeSet, t *table, c *constraint, rows [][]MemoryCell, changed []int) error {
+	if len(changed) == 0 {
+		return nil
+	}
+
+	keys := map[string]bool{}
+	for _, row := range mb.currentRows(cs, c.RefTable) {
+		refKeys := rowKeys(row, c.RefColumns)
+		if !hasNull(refKeys) {
+			keys[groupKey(refKeys)] = true
+		}
+	}
+
+	for _, i := range changed {
+		childKeys := rowKeys(rows[i], c.Columns)
+		if hasNull(childKeys) {
+			continue
+		}
+		if !keys[groupKey(childKeys)] {
+			return fmt.Errorf("%w: %s, %s is not present in table %s", ErrForeignKeyViolation, c.Name, keyString(t, c.Columns, childKeys), c.RefTable)
+		}
+	}
+	return nil
+}
+
+// 检查语句执行完之后, 引用表name的行引用的行都还在
+// 被引用的行删除或修改之后, 没有被CASCADE或者SET NULL处理的行(也就是RESTRICT)还引用旧的值时报错
+func (mb *MemoryBackend) checkReferencingRows(cs *changeSet, name string) error {
+	for _, childName := range sortedTableNames(mb.tables) {
+		for _, c := range mb.tables[childName].Constraints {
+			if c.Kind != parser.ForeignKeyConstraint || c.RefTable != name {
+				continue
+			}
+
+			keys := map[string]bool{}
+			for _, row := range mb.currentRows(cs, name) {
+				keys[groupKey(rowKeys(row, c.RefColumns))] = true
+			}
+			for _, row := range mb.currentRows(cs, childName) {
+				childKeys := rowKeys(row, c.Columns)
+				if !hasNull(childKeys) && !keys[groupKey(childKeys)] {
+					return fmt.Errorf("%w: %s on table %s, %s is still referenced", ErrForeignKeyViolation, c.Name, childName, keyString(mb.tables[name], c.RefColumns, childKeys))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// 检查外键的定义, 找到引用的表和列
+// 被引用的列必须是那张表的主键或者UNIQUE约束的列, 没有写列名时就是主键
+func (mb *MemoryBackend) checkForeignKey(t *table, tableName string, ref *parser.ForeignKeyReference, c *constraint) error {
+	parent := t
+	if ref.Table.Value != tableName {
+		var ok bool
+		parent, ok = mb.tables[ref.Table.Value]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrTableDoesNotExist, ref.Table.Value)
+		}
+	}
+
+	if len(ref.Columns) == 0 {
+		pk := parent.primaryKey()
+		if pk == nil {
+			return fmt.Errorf("%w: there is no primary key for referenced table %s", ErrInvalidForeignKey, ref.Table.Value)
+		}
+		c.RefColumns = append([]int{}, pk.Columns...)
+	} else {
+		columns, err := constraintColumns(parent, ref.Table.Value, ref.Columns)
+		if err != nil {
+			return err
+		}
+		c.RefColumns = columns
+	}
+
+	if len(c.RefColumns) != len(c.Columns) {
+		return fmt.Errorf("%w: number of referencing and referenced columns disagree", ErrInvalidForeignKey)
+	}
+	for k, i := range c.Columns {
+		j := c.RefColumns[k]
+		if t.ColumnTypes[i] != parent.ColumnTypes[j] {
+			return fmt.Errorf("%w: column %s is %s, referenced column %s is %s", ErrTypeMismatch, t.Columns[i], t.ColumnTypes[i], parent.Columns[j], parent.ColumnTypes[j])
+		}
+	}
+
+	unique := false
+	for _, pc := range parent.Constraints {
+		if pc.Kind == parser.UniqueConstraint || pc.Kind == parser.PrimaryKeyConstraint {
+			if sameColumns(pc.Columns, c.RefColumns) {
+				unique = true
+			}
+		}
+	}
+	if !unique {
+		return fmt.Errorf("%w: there is no unique constraint matching given keys for referenced table %s", ErrInvalidForeignKey, ref.Table.Value)
+	}
+
+	c.RefTable = ref.Table.Value
+	c.OnDelete = ref.OnDelete
+	c.OnUpdate = ref.OnUpdate
+	return nil
+}
+
+// 两组列是不是同样的列, 不管顺序
+func sameColumns(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, i := range a {
+		if !containsColumn(b, i) {
+			return false
+		}
+	}
+	return true
+}
+
+// 删除表name的第column列之前, 检查没有别的外键引用这一列
+// 引用这一列的外键如果在同一张表上并且自己也包含这一列, 会和这一列一起被删除
+func (mb *MemoryBackend) checkDroppedColumnReferences(name string, column int) error {
+	for _, childName := range sortedTableNames(mb.tables) {
+		for _, c := range mb.tables[childName].Constraints {
+			if c.Kind != parser.ForeignKeyConstraint || c.RefTable != name || !containsColumn(c.RefColumns, column) {
+				continue
+			}
+			if childName == name && containsColumn(c.Columns, column) {
+				continue
+			}
+			return fmt.Errorf("%w: constraint %s on table %s references column %s", ErrDependentObjects, c.Name, childName, mb.tables[name].Columns[column])
+		}
+	}
+	return nil
+}
+
+// 删除表name的第column列之后, 引用这张表的外键里列的位置要往前移
+func (mb *MemoryBackend) dropReferencedColumn(name string, column int) {
+	for _, child := range mb.tables {
+		for _, c := range child.Constraints {
+			if c.Kind != parser.ForeignKeyConstraint || c.RefTable != name {
+				continue
+			}
+			for k, i := range c.RefColumns {
+				if i > column {
+					c.RefColumns[k] = i - 1
+				}
+			}
+		}
+	}
+}
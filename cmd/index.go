@@ -0,0 +1,623 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/database-from-zero-to-one/lexer"
+	"github.com/database-from-zero-to-one/parser"
+)
+
+// 索引
+// 有序索引按索引的列的值从小到大记录了每一行在表里的位置, 用跳表实现
+// 哈希索引按索引的列的值把行的位置放进哈希表, 只能用来找值相等的行
+// 每次INSERT, UPDATE 和 DELETE 修改表的时候, 在commit里一起更新表上所有的索引
+// 查询的时候, 下推到扫描上的条件里有 列 = 常量, 列 < 常量 这样的条件时, 用索引找到可能满足条件的行, 不用扫描整张表
+// 有序索引还可以按索引的顺序输出行, 这样归并连接不用再排序
+// 索引只是减少要检查的行, 找到的行还是要再检查一遍这些条件, 所以不会改变查询的结果
+// 连接条件是 右边的表的列 = 左边的表达式, 并且右边的表在这些列上有哈希索引时, 连接也直接用索引找右边的行
+
+// 表上的一个索引
+type index struct {
+	Name    string
+	Columns []int // 索引的列在表里的位置
+	Method  parser.IndexMethod
+	Unique  bool // 索引的列不能有重复的值, 和UNIQUE约束一样有NULL的行不算重复
+
+	entries *skipList        // 有序索引的所有项
+	buckets map[string][]int // 哈希索引: 索引的列的值 -> 行的位置(从小到大), 有NULL的行不会被找到, 所以不放进去
+}
+
+// 索引里的一项: 一行在索引的列上的值, 以及这一行在表里的位置
+type indexEntry struct {
+	key []MemoryCell
+	row int
+}
+
+const skipListMaxLevel = 24
+
+type skipListNode struct {
+	entry indexEntry
+	next  []*skipListNode // 每一层的下一个节点
+}
+
+// 跳表: 最下面一层是按顺序连起来的所有项, 上面每一层大约只有下一层一半的项, 查找的时候从上往下找
+type skipList struct {
+	head   *skipListNode
+	types  []ColumnType // 每一列的类型, 比较的时候要用
+	random *rand.Rand
+}
+
+func newSkipList(types []ColumnType) *skipList {
+	return &skipList{
+		head:   &skipListNode{next: make([]*skipListNode, skipListMaxLevel)},
+		types:  types,
+		random: rand.New(rand.NewSource(1)),
+	}
+}
+
+// 只比较key的前len(prefix)列, NULL比任何值都大
+func (sl *skipList) comparePrefix(key, prefix []MemoryCell) int {
+	for i, cell := range prefix {
+		if c := compareCells(key[i], cell, sl.types[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// 先按key比较, key相同时再按行的位置比较, 这样每一项都不一样
+func (sl *skipList) compare(a, b indexEntry) int {
+	if c := sl.comparePrefix(a.key, b.key); c != 0 {
+		return c
+	}
+	return a.row - b.row
+}
+
+// 找到每一层里最后一个比entry小的节点
+func (sl *skipList) predecessors(entry indexEntry) []*skipListNode {
+	update := make([]*skipListNode, skipListMaxLevel)
+	node := sl.head
+	for level := skipListMaxLevel - 1; level >= 0; level-- {
+		for node.next[level] != nil && sl.compare(node.next[level].entry, entry) < 0 {
+			node = node.next[level]
+		}
+		update[level] = node
+	}
+	return update
+}
+
+func (sl *skipList) insert(entry indexEntry) {
+	update := sl.predecessors(entry)
+	level := 1
+	for level < skipListMaxLevel && sl.random.Intn(2) == 0 {
+		level++
+	}
+
+	node := &skipListNode{
+		entry: entry,
+		next:  make([]*skipListNode, level),
+	}
+	for i := 0; i < level; i++ {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+}
+
+func (sl *skipList) remove(entry indexEntry) {
+	update := sl.predecessors(entry)
+	node := update[0].next[0]
+	if node == nil || sl.compare(node.entry, entry) != 0 {
+		return
+	}
+	for i := range node.next {
+		update[i].next[i] = node.next[i]
+	}
+}
+
+// 第一个前缀大于等于bound的节点, inclusive为false时是第一个大于bound的节点
+func (sl *skipList) seek(bound []MemoryCell, inclusive bool) *skipListNode {
+	node := sl.head
+	for level := skipListMaxLevel - 1; level >= 0; level-- {
+		for node.next[level] != nil {
+			c := sl.comparePrefix(node.next[level].entry.key, bound)
+			if c > 0 || (c == 0 && inclusive) {
+				break
+			}
+			node = node.next[level]
+		}
+	}
+	return node.next[0]
+}
+
+// 修改每一项的行的位置, f必须保持原来的顺序, 所以跳表的结构不用变
+func (sl *skipList) renumber(f func(int) int) {
+	for node := sl.head.next[0]; node != nil; node = node.next[0] {
+		node.entry.row = f(node.entry.row)
+	}
+}
+
+// 在表的几列上建索引, 把表里已有的行都加进去
+func newIndex(name string, t *table, columns []int, method parser.IndexMethod, unique bool) *index {
+	idx := &index{
+		Name:    name,
+		Columns: columns,
+		Method:  method,
+		Unique:  unique,
+	}
+	if method == parser.HashIndex {
+		idx.buckets = map[string][]int{}
+	} else {
+		types := []ColumnType{}
+		for _, i := range columns {
+			types = append(types, t.ColumnTypes[i])
+		}
+		idx.entries = newSkipList(types)
+	}
+
+	for i, row := range t.rows {
+		idx.add(row, i)
+	}
+	return idx
+}
+
+func (idx *index) add(row []MemoryCell, i int) {
+	keys := rowKeys(row, idx.Columns)
+	if idx.Method != parser.HashIndex {
+		idx.entries.insert(indexEntry{key: keys, row: i})
+		return
+	}
+	if hasNull(keys) {
+		return
+	}
+
+	// 桶里的位置保持从小到大, 这样找到的行和扫描整张表的顺序一样
+	key := groupKey(keys)
+	bucket := idx.buckets[key]
+	j := sort.SearchInts(bucket, i)
+	bucket = append(bucket, 0)
+	copy(bucket[j+1:], bucket[j:])
+	bucket[j] = i
+	idx.buckets[key] = bucket
+}
+
+func (idx *index) remove(row []MemoryCell, i int) {
+	keys := rowKeys(row, idx.Columns)
+	if idx.Method != parser.HashIndex {
+		idx.entries.remove(indexEntry{key: keys, row: i})
+		return
+	}
+	if hasNull(keys) {
+		return
+	}
+
+	key := groupKey(keys)
+	bucket := idx.buckets[key]
+	j := sort.SearchInts(bucket, i)
+	if j == len(bucket) || bucket[j] != i {
+		return
+	}
+	if len(bucket) == 1 {
+		delete(idx.buckets, key)
+		return
+	}
+	idx.buckets[key] = append(bucket[:j:j], bucket[j+1:]...)
+}
+
+// 修改每一项的行的位置, f必须保持原来的顺序
+func (idx *index) renumber(f func(int) int) {
+	if idx.Method != parser.HashIndex {
+		idx.entries.renumber(f)
+		return
+	}
+	for _, bucket := range idx.buckets {
+		for j, i := range bucket {
+			bucket[j] = f(i)
+		}
+	}
+}
+
+// 哈希索引里索引的列的值等于keys的所有行的位置
+func (idx *index) lookup(keys []MemoryCell) []int {
+	if hasNull(keys) {
+		return nil
+	}
+	return idx.buckets[groupKey(keys)]
+}
+
+// 索引的范围条件的一端
+type indexBound struct {
+	value     MemoryCell
+	inclusive bool
+}
+
+// 找到前几列等于eq, 并且下一列在low和high之间的所有行的位置, low和high是nil时表示这一端没有限制
+// NULL排在最后, 所以碰到条件里的列是NULL的项就可以停下来了
+func (idx *index) scan(eq []MemoryCell, low, high *indexBound) []int {
+	lower, inclusive := eq, true
+	if low != nil {
+		lower, inclusive = append(append([]MemoryCell{}, eq...), low.value), low.inclusive
+	}
+	conditions := len(eq)
+	if low != nil || high != nil {
+		conditions++
+	}
+
+	rows := []int{}
+	for node := idx.entries.seek(lower, inclusive); node != nil; node = node.next[0] {
+		key := node.entry.key
+		if idx.entries.comparePrefix(key, eq) != 0 || hasNull(key[:conditions]) {
+			break
+		}
+		if high != nil {
+			c := compareCells(key[len(eq)], high.value, idx.entries.types[len(eq)])
+			if c > 0 || (c == 0 && !high.inclusive) {
+				break
+			}
+		}
+		rows = append(rows, node.entry.row)
+	}
+	return rows
+}
+
+// 按名字找索引, 索引的名字在所有的表里都不能重复
+func (mb *MemoryBackend) lookupIndex(name string) (*table, int, bool) {
+	for _, t := range mb.tables {
+		for i, idx := range t.Indexes {
+			if idx.Name == name {
+				return t, i, true
+			}
+		}
+	}
+	return nil, 0, false
+}
+
+func (mb *MemoryBackend) CreateIndex(crt *parser.CreateIndexStatement) error {
+	if _, _, ok := mb.lookupIndex(crt.Name.Value); ok {
+		if crt.IfNotExists {
+			return nil
+		}
+		return fmt.Errorf("%w: %s", ErrIndexAlreadyExists, crt.Name.Value)
+	}
+
+	t, ok := mb.tables[crt.Table.Value]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableDoesNotExist, crt.Table.Value)
+	}
+	columns, err := constraintColumns(t, crt.Table.Value, crt.Columns)
+	if err != nil {
+		return err
+	}
+
+	// 唯一索引建立之前, 表里已有的行也不能有重复的值
+	if crt.Unique {
+		if err := checkUnique(t, crt.Name.Value, columns, t.rows); err != nil {
+			return err
+		}
+	}
+
+	t.Indexes = append(t.Indexes, newIndex(crt.Name.Value, t, columns, crt.Method, crt.Unique))
+	return nil
+}
+
+func (mb *MemoryBackend) DropIndex(drop *parser.DropIndexStatement) error {
+	t, i, ok := mb.lookupIndex(drop.Name.Value)
+	if !ok {
+		if drop.IfExists {
+			return nil
+		}
+		return fmt.Errorf("%w: %s", ErrIndexDoesNotExist, drop.Name.Value)
+	}
+
+	t.Indexes = append(t.Indexes[:i:i], t.Indexes[i+1:]...)
+	return nil
+}
+
+// 表里的行被修改之后更新所有的索引, 这时t.rows还是修改之前的行
+// positions是修改之前的每一行在新的行里的位置, 被删除的行是-1, changed是新的行里被插入或者被修改的行
+func (t *table) updateIndexes(rows [][]MemoryCell, positions []int, changed map[int]bool) {
+	for _, idx := range t.Indexes {
+		deleted := false
+		for i, row := range t.rows {
+			if positions[i] < 0 {
+				deleted = true
+			}
+			if positions[i] < 0 || changed[positions[i]] {
+				idx.remove(row, i)
+			}
+		}
+
+		// 删除了行之后, 后面的行的位置都往前移了
+		if deleted {
+			idx.renumber(func(i int) int {
+				return positions[i]
+			})
+		}
+
+		for i, row := range rows {
+			if changed[i] {
+				idx.add(row, i)
+			}
+		}
+	}
+}
+
+// 删除一列之后, 包含这一列的索引也一起删除, 其他索引里的列的位置要往前移
+func (t *table) dropColumnIndexes(column int) {
+	kept := []*index{}
+	for _, idx := range t.Indexes {
+		if containsColumn(idx.Columns, column) {
+			continue
+		}
+		for k, i := range idx.Columns {
+			if i > column {
+				idx.Columns[k] = i - 1
+			}
+		}
+		kept = append(kept, idx)
+	}
+	t.Indexes = kept
+}
+
+// 用索引扫描一张表: 索引的前几列等于常量, 下一列可以再有一个范围
+// 哈希索引的每一列都要等于常量, 并且不能有范围
+type indexScan struct {
+	index *index
+	eq    []*parser.Expression
+	low   *parser.Expression
+	high  *parser.Expression
+	// 范围的两端是否包含边界上的值
+	lowInclusive  bool
+	highInclusive bool
+	conds         []*parser.Expression // 用到的WHERE里的条件, 用于EXPLAIN
+	ordered       bool                 // 按索引的顺序输出, 归并连接要求输入有序时才这样, 否则按在表里的顺序输出
+}
+
+// 列和常量比较的条件, 比如 a = 1, 2 < a
+type indexCondition struct {
+	column int
+	op     lexer.Symbol // 常量写在左边时会把符号反过来, 所以总是 列 op 常量
+	value  *parser.Expression
+	cond   *parser.Expression
+}
+
+// 常量写在左边时, 把比较的符号反过来
+var flippedSymbols = map[lexer.Symbol]lexer.Symbol{
+	lexer.EqualSymbol:        lexer.EqualSymbol,
+	lexer.NotEqualSymbol:     lexer.NotEqualSymbol,
+	lexer.LessSymbol:         lexer.GreaterSymbol,
+	lexer.LessEqualSymbol:    lexer.GreaterEqualSymbol,
+	lexer.GreaterSymbol:      lexer.LessSymbol,
+	lexer.GreaterEqualSymbol: lexer.LessEqualSymbol,
+}
+
+// 如果条件是 columns里的一列 和 常量 比较, 返回列的位置和常量
+// 常量不能引用任何列, 类型也要和列一样, 这样在扫描之前就能算出它的值
+func (mb *MemoryBackend) indexCondition(columns []contextColumn, cond *parser.Expression) (*indexCondition, bool) {
+	if cond.Kind != parser.BinaryKind || cond.Binary.Op.Kind != lexer.SymbolKind {
+		return nil, false
+	}
+	op, ok := flippedSymbols[lexer.Symbol(cond.Binary.Op.Value)]
+	if !ok {
+		return nil, false
+	}
+
+	column, value := &cond.Binary.A, &cond.Binary.B
+	if column.Kind != parser.LiteralKind || column.Literal.Kind != lexer.IdentifierKind {
+		column, value = value, column
+	} else {
+		op = lexer.Symbol(cond.Binary.Op.Value)
+	}
+	if column.Kind != parser.LiteralKind || column.Literal.Kind != lexer.IdentifierKind {
+		return nil, false
+	}
+
+	i, err := lookupIdentifier(columns, column)
+	if err != nil {
+		return nil, false
+	}
+	refs, err := referencedColumns(value, nil)
+	if err != nil || len(refs) > 0 {
+		return nil, false
+	}
+	typ, err := mb.expressionType(nil, value)
+	if err != nil || typ != columns[i].Type {
+		return nil, false
+	}
+
+	return &indexCondition{
+		column: i,
+		op:     op,
+		value:  value,
+		cond:   cond,
+	}, true
+}
+
+// 选择能用上最多条件的索引: 等值条件优先, 然后是下一列上的范围条件
+// 所有的列都是等值条件时, 哈希索引比同样列上的有序索引优先
+// 表有统计信息时改成按估算的代价选择, 也可能不用索引, 见cost.go
+func (mb *MemoryBackend) chooseIndex(plan *fromPlan, conds []*parser.Expression) *indexScan {
+	candidates := []*indexCondition{}
+	for _, cond := range conds {
+		if c, ok := mb.indexCondition(plan.scanColumns, cond); ok {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	var best *indexScan
+	bestScore := 0
+	scans := []*indexScan{}
+	for _, idx := range plan.table.Indexes {
+		scan := &indexScan{index: idx}
+		score := 0
+		for _, column := range idx.Columns {
+			var eq *indexCondition
+			for _, c := range candidates {
+				if c.column == column && c.op == lexer.EqualSymbol {
+					eq = c
+					break
+				}
+			}
+			if eq == nil {
+				break
+			}
+			scan.eq = append(scan.eq, eq.value)
+			scan.conds = append(scan.conds, eq.cond)
+			score += 2
+		}
+
+		if idx.Method == parser.HashIndex {
+			if len(scan.eq) < len(idx.Columns) {
+				continue
+			}
+			score++
+		} else if len(scan.eq) < len(idx.Columns) {
+			column := idx.Columns[len(scan.eq)]
+			for _, c := range candidates {
+				if c.column != column {
+					continue
+				}
+				switch {
+				case scan.low == nil && (c.op == lexer.GreaterSymbol || c.op == lexer.GreaterEqualSymbol):
+					scan.low = c.value
+					scan.lowInclusive = c.op == lexer.GreaterEqualSymbol
+				case scan.high == nil && (c.op == lexer.LessSymbol || c.op == lexer.LessEqualSymbol):
+					scan.high = c.value
+					scan.highInclusive = c.op == lexer.LessEqualSymbol
+				default:
+					continue
+				}
+				scan.conds = append(scan.conds, c.cond)
+				score++
+			}
+		}
+
+		if score == 0 {
+			continue
+		}
+		scans = append(scans, scan)
+		if score > bestScore {
+			best, bestScore = scan, score
+		}
+	}
+
+	if plan.table.Stats != nil {
+		return mb.cheapestIndexScan(plan, scans)
+	}
+	return best
+}
+
+// 用索引找到可能满足条件的行, 按在表里的顺序返回, 这样和扫描整张表的结果顺序一样
+// 归并连接要求有序的时候, 按有序索引里的顺序返回
+func (mb *MemoryBackend) executeIndexScan(plan *fromPlan) ([][]MemoryCell, error) {
+	scan := plan.scan
+	ctx := &rowContext{}
+
+	// 和NULL比较的结果都是NULL, 所以有一个常量是NULL时没有行满足条件
+	eq := []MemoryCell{}
+	for _, exp := range scan.eq {
+		cell, _, err := mb.evaluateCell(ctx, exp)
+		if err != nil {
+			return nil, err
+		}
+		if cell.IsNull() {
+			return nil, nil
+		}
+		eq = append(eq, cell)
+	}
+
+	bound := func(exp *parser.Expression, inclusive bool) (*indexBound, bool, error) {
+		if exp == nil {
+			return nil, true, nil
+		}
+		cell, _, err := mb.evaluateCell(ctx, exp)
+		if err != nil || cell.IsNull() {
+			return nil, false, err
+		}
+		return &indexBound{value: cell, inclusive: inclusive}, true, nil
+	}
+	low, ok, err := bound(scan.low, scan.lowInclusive)
+	if err != nil || !ok {
+		return nil, err
+	}
+	high, ok, err := bound(scan.high, scan.highInclusive)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	var positions []int
+	if scan.index.Method == parser.HashIndex {
+		positions = scan.index.lookup(eq)
+	} else {
+		positions = scan.index.scan(eq, low, high)
+		if !scan.ordered {
+			sort.Ints(positions)
+		}
+	}
+	rows := [][]MemoryCell{}
+	for _, i := range positions {
+		rows = append(rows, plan.table.rows[i])
+	}
+	return rows, nil
+}
+
+// 如果右边是扫描一张表, 并且表上有一个哈希索引的每一列都出现在等值条件里, 返回这个索引
+// 以及按索引的列的顺序排好的左边的表达式
+func (plan *fromPlan) hashIndexKeys(leftKeys, rightKeys []*parser.Expression) (*index, []*parser.Expression) {
+	if plan.kind != scanPlanKind {
+		return nil, nil
+	}
+
+	for _, idx := range plan.table.Indexes {
+		if idx.Method != parser.HashIndex {
+			continue
+		}
+
+		keys := []*parser.Expression{}
+		for _, column := range idx.Columns {
+			for k, exp := range rightKeys {
+				if exp.Kind != parser.LiteralKind || exp.Literal.Kind != lexer.IdentifierKind {
+					continue
+				}
+				if i, err := lookupIdentifier(plan.scanColumns, exp); err == nil && i == column {
+					keys = append(keys, leftKeys[k])
+					break
+				}
+			}
+		}
+		if len(keys) == len(idx.Columns) {
+			return idx, keys
+		}
+	}
+	return nil, nil
+}
+
+// 索引连接: 左边的一行只可能和索引里值相同的行配对, 这些行还要满足下推到右边的扫描上的条件
+func (mb *MemoryBackend) indexJoinCandidates(plan *fromPlan, left *relation) (func(int) ([]int, error), error) {
+	leftKeys, err := mb.joinKeys(left, plan.leftKeys)
+	if err != nil {
+		return nil, err
+	}
+	right := plan.right
+	cond := joinConjuncts(right.filters)
+	return func(i int) ([]int, error) {
+		js := []int{}
+		for _, j := range plan.joinIndex.lookup(leftKeys[i]) {
+			ok, err := mb.matchCondition(&rowContext{
+				columns: right.scanColumns,
+				row:     right.table.rows[j],
+			}, cond)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				js = append(js, j)
+			}
+		}
+		return js, nil
+	}, nil
+}
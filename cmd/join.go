@@ -0,0 +1,833 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/database-from-zero-to-one/lexer"
+	"github.com/database-from-zero-to-one/parser"
+)
+
+// FROM 和 连接(JOIN)
+// 先根据FROM生成一个由扫描和连接组成的执行计划, 然后再按计划执行
+// 连接有三种执行方式:
+// 嵌套循环连接: 左边的每一行和右边的每一行配对, 适用于任何连接条件
+// 哈希连接: 连接条件里有等值条件(左边的表达式 = 右边的表达式)时, 先把右边的行按等值条件放进哈希表, 再用左边的每一行去查
+// 归并连接: 有等值条件并且两边的行已经按等值条件排好序(有序索引或者子查询的ORDER BY)时, 两边同时往后扫描一遍就行了
+// 索引连接: 右边的表在等值条件的列上有哈希索引时, 左边的每一行直接用索引找右边的行, 不用再建哈希表
+
+// FROM 产生的所有行, 以及每一行里有哪些列
+type relation struct {
+	columns []contextColumn
+	rows    [][]MemoryCell
+}
+
+// 连接的执行方式
+type joinStrategy uint
+
+const (
+	nestedLoopJoin joinStrategy = iota
+	hashJoin
+	mergeJoin
+	indexJoin
+)
+
+func (s joinStrategy) String() string {
+	switch s {
+	case hashJoin:
+		return "Hash Join"
+	case mergeJoin:
+		return "Merge Join"
+	case indexJoin:
+		return "Index Join"
+	}
+	return "Nested Loop"
+}
+
+var joinTypeNames = map[parser.JoinType]string{
+	parser.InnerJoin: "inner",
+	parser.LeftJoin:  "left",
+	parser.RightJoin: "right",
+	parser.FullJoin:  "full",
+	parser.CrossJoin: "cross",
+}
+
+// FROM 的执行计划是一棵树, 叶子节点是扫描一张表或者一个子查询, 其余的节点是连接
+type fromPlanKind uint
+
+const (
+	scanPlanKind         fromPlanKind = iota
+	joinPlanKind                      // 连接
+	singleRowPlanKind                 // 没有FROM, 比如 SELECT 1 + 2, 相当于只有一行并且没有列
+	subqueryScanPlanKind              // FROM 里的子查询, 先执行子查询, 再扫描它的结果
+	cteScanPlanKind                   // 扫描WITH里的CTE的结果, 和扫描表一样
+)
+
+type fromPlan struct {
+	columns []contextColumn
+
+	// 扫描
+	table       *table
+	ref         *parser.TableReference // 扫描子查询的时候, 子查询是ref.Select
+	scan        *indexScan             // 用索引扫描表, 为nil时扫描整张表
+	scanColumns []contextColumn        // 扫描出来的每一行的所有列, 投影裁剪之后columns只是其中的一部分
+	filters     []*parser.Expression   // 下推到扫描上的条件, 只引用这张表的列
+	output      []int                  // 投影裁剪之后输出的列在scanColumns里的位置, 为nil时输出所有的列
+
+	// 连接
+	left      *fromPlan
+	right     *fromPlan
+	joinType  parser.JoinType
+	on        *parser.Expression // 完整的连接条件, 用于EXPLAIN
+	strategy  joinStrategy
+	leftKeys  []*parser.Expression // 等值条件左边的表达式, 只引用左边的列
+	rightKeys []*parser.Expression // 等值条件右边的表达式, 只引用右边的列
+	residual  *parser.Expression   // 除了等值条件之外, 配对的两行还要满足的条件
+	joinIndex *index               // 索引连接时右边的表上的哈希索引, leftKeys按索引的列的顺序排列
+
+	kind fromPlanKind
+}
+
+// 在表达式里引用FROM里一张表时用的名字, 有别名时只能用别名
+func tableReferenceName(ref *parser.TableReference) string {
+	if ref.Alias != nil {
+		return ref.Alias.Value
+	}
+	return ref.Table.Value
+}
+
+// 同一个名字在FROM里不能出现两次, 否则 t.col 就不知道指的是哪张表了
+func checkTableNames(ref *parser.TableReference, names map[string]bool) error {
+	if ref.Kind == parser.JoinedTableKind {
+		if err := checkTableNames(ref.Join.Left, names); err != nil {
+			return err
+		}
+		return checkTableNames(ref.Join.Right, names)
+	}
+
+	name := tableReferenceName(ref)
+	if names[name] {
+		return fmt.Errorf("%w: %s", ErrDuplicateTableName, name)
+	}
+	names[name] = true
+	return nil
+}
+
+// 生成FROM的执行计划, 逗号隔开的多项相当于CROSS JOIN
+func (mb *MemoryBackend) planFrom(from []*parser.TableReference) (*fromPlan, error) {
+	if len(from) == 0 {
+		return &fromPlan{kind: singleRowPlanKind}, nil
+	}
+
+	names := map[string]bool{}
+	for _, ref := range from {
+		if err := checkTableNames(ref, names); err != nil {
+			return nil, err
+		}
+	}
+
+	var plan *fromPlan
+	for _, ref := range from {
+		p, err := mb.planTableReference(ref)
+		if err != nil {
+			return nil, err
+		}
+		if plan == nil {
+			plan = p
+			continue
+		}
+
+		plan, err = mb.planJoin(plan, p, parser.CrossJoin, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// 生成FROM里一项的执行计划
+func (mb *MemoryBackend) planTableReference(ref *parser.TableReference) (*fromPlan, error) {
+	switch ref.Kind {
+	case parser.TableNameKind:
+		t, cte, ok := mb.lookupTable(ref.Table.Value)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrTableDoesNotExist, ref.Table.Value)
+		}
+		kind := scanPlanKind
+		if cte {
+			kind = cteScanPlanKind
+		}
+		columns := t.contextColumns(tableReferenceName(ref))
+		return &fromPlan{
+			columns:     columns,
+			table:       t,
+			ref:         ref,
+			scanColumns: columns,
+			kind:        kind,
+		}, nil
+	case parser.DerivedTableKind:
+		// 子查询的每一列都属于它的别名, 子查询里不能引用外层查询的列
+		results, err := mb.query(ref.Select, nil, true)
+		if err != nil {
+			return nil, err
+		}
+		columns := []contextColumn{}
+		for _, col := range results.Columns {
+			columns = append(columns, contextColumn{
+				Table: ref.Alias.Value,
+				Name:  col.Name,
+				Type:  col.Type,
+			})
+		}
+		return &fromPlan{
+			columns:     columns,
+			ref:         ref,
+			scanColumns: columns,
+			kind:        subqueryScanPlanKind,
+		}, nil
+	case parser.JoinedTableKind:
+		left, err := mb.planTableReference(ref.Join.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := mb.planTableReference(ref.Join.Right)
+		if err != nil {
+			return nil, err
+		}
+		return mb.planJoin(left, right, ref.Join.Type, ref.Join.On)
+	}
+	return nil, ErrTableDoesNotExist
+}
+
+// 生成连接的计划并检查连接条件, 执行方式等到条件都下推完之后再选
+func (mb *MemoryBackend) planJoin(left, right *fromPlan, typ parser.JoinType, on *parser.Expression) (*fromPlan, error) {
+	plan := fromPlan{
+		columns:  append(append([]contextColumn{}, left.columns...), right.columns...),
+		left:     left,
+		right:    right,
+		joinType: typ,
+		on:       on,
+		kind:     joinPlanKind,
+	}
+	if err := mb.checkCondition(plan.columns, on, "ON"); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// 根据连接条件和两边的行是否有序选择连接的执行方式
+func (plan *fromPlan) chooseJoinStrategy() {
+	left, right, on := plan.left, plan.right, plan.on
+	plan.strategy = nestedLoopJoin
+	plan.residual = on
+	if on == nil {
+		return
+	}
+
+	// 把连接条件按AND拆开, 找出所有的等值条件
+	others := []*parser.Expression{}
+	for _, cond := range splitConjuncts(on) {
+		l, r, ok := equiJoinKeys(cond, len(left.columns), plan.columns)
+		if !ok {
+			others = append(others, cond)
+			continue
+		}
+		plan.leftKeys = append(plan.leftKeys, l)
+		plan.rightKeys = append(plan.rightKeys, r)
+	}
+	if len(plan.leftKeys) == 0 {
+		return
+	}
+
+	// 两边已经按第一个等值条件排好序时用归并连接, 剩下的等值条件和其他条件一起在配对之后检查
+	if left.sortedOn(plan.leftKeys[0]) && right.sortedOn(plan.rightKeys[0]) {
+		for i := 1; i < len(plan.leftKeys); i++ {
+			others = append(others, equalExpression(plan.leftKeys[i], plan.rightKeys[i]))
+		}
+		plan.strategy = mergeJoin
+		plan.leftKeys = plan.leftKeys[:1]
+		plan.rightKeys = plan.rightKeys[:1]
+		left.provideOrder(plan.leftKeys[0])
+		right.provideOrder(plan.rightKeys[0])
+	} else if idx, keys := right.hashIndexKeys(plan.leftKeys, plan.rightKeys); idx != nil && (len(right.filters) == 0 || !plan.keepsUnmatchedRight()) {
+		// 索引只保证索引的列相等, 所以配对之后还要检查完整的连接条件
+		// 右边扫描上的条件只在找候选的行时检查, 所以右边没匹配上的行也要保留时, 右边不能有条件
+		plan.strategy = indexJoin
+		plan.joinIndex = idx
+		plan.leftKeys = keys
+		plan.rightKeys = nil
+		plan.residual = on
+		return
+	} else {
+		plan.strategy = hashJoin
+	}
+	plan.residual = joinConjuncts(others)
+}
+
+// RIGHT 和 FULL 连接里, 没有匹配上的右边的行也要保留
+func (plan *fromPlan) keepsUnmatchedRight() bool {
+	return plan.joinType == parser.RightJoin || plan.joinType == parser.FullJoin
+}
+
+// 把 a AND b AND c 拆成 [a, b, c]
+func splitConjuncts(exp *parser.Expression) []*parser.Expression {
+	if exp.Kind == parser.BinaryKind && exp.Binary.Op.Kind == lexer.KeywordKind && lexer.Keyword(exp.Binary.Op.Value) == lexer.AndKeyword {
+		return append(splitConjuncts(&exp.Binary.A), splitConjuncts(&exp.Binary.B)...)
+	}
+	return []*parser.Expression{exp}
+}
+
+// 把 [a, b, c] 合并成 a AND b AND c, 没有条件时返回nil
+func joinConjuncts(exps []*parser.Expression) *parser.Expression {
+	var result *parser.Expression
+	for _, exp := range exps {
+		if result == nil {
+			result = exp
+			continue
+		}
+		result = &parser.Expression{
+			Binary: &parser.BinaryExpression{
+				A:  *result,
+				B:  *exp,
+				Op: parser.TokenFromKeyword(lexer.AndKeyword),
+			},
+			Kind: parser.BinaryKind,
+		}
+	}
+	return result
+}
+
+// 生成 a = b
+func equalExpression(a, b *parser.Expression) *parser.Expression {
+	return &parser.Expression{
+		Binary: &parser.BinaryExpression{
+			A:  *a,
+			B:  *b,
+			Op: parser.TokenFromSymbol(lexer.EqualSymbol),
+		},
+		Kind: parser.BinaryKind,
+	}
+}
+
+// 表达式里引用了哪些列(在上下文中的位置)
+func referencedColumns(exp *parser.Expression, columns []contextColumn) ([]int, error) {
+	switch exp.Kind {
+	case parser.LiteralKind:
+		if exp.Literal.Kind != lexer.IdentifierKind {
+			return nil, nil
+		}
+		i, err := lookupIdentifier(columns, exp)
+		if err != nil {
+			return nil, err
+		}
+		return []int{i}, nil
+	case parser.UnaryKind:
+		return referencedColumns(&exp.Unary.Operand, columns)
+	case parser.BinaryKind:
+		a, err := referencedColumns(&exp.Binary.A, columns)
+		if err != nil {
+			return nil, err
+		}
+		b, err := referencedColumns(&exp.Binary.B, columns)
+		if err != nil {
+			return nil, err
+		}
+		return append(a, b...), nil
+	case parser.InKind:
+		if exp.In.Select == nil {
+			refs, err := referencedColumns(&exp.In.Left, columns)
+			if err != nil {
+				return nil, err
+			}
+			for _, value := range exp.In.List {
+				r, err := referencedColumns(value, columns)
+				if err != nil {
+					return nil, err
+				}
+				refs = append(refs, r...)
+			}
+			return refs, nil
+		}
+	case parser.IsNullKind:
+		return referencedColumns(&exp.IsNull.Operand, columns)
+	case parser.FunctionKind:
+		return nil, functionError(exp.Function)
+	}
+	// 不统计子查询里引用的列, 所以带子查询的条件不会被当成等值条件
+	return nil, fmt.Errorf("%w: subquery", ErrInvalidOperator)
+}
+
+// 表达式引用的列是不是都在连接的左边(或者都在右边), 至少要引用一列
+func onOneSide(exp *parser.Expression, leftColumns int, columns []contextColumn, left bool) bool {
+	refs, err := referencedColumns(exp, columns)
+	if err != nil || len(refs) == 0 {
+		return false
+	}
+	for _, i := range refs {
+		if (i < leftColumns) != left {
+			return false
+		}
+	}
+	return true
+}
+
+// 如果条件是 左边的表达式 = 右边的表达式, 返回等号两边的表达式(左边的在前)
+func equiJoinKeys(cond *parser.Expression, leftColumns int, columns []contextColumn) (*parser.Expression, *parser.Expression, bool) {
+	if cond.Kind != parser.BinaryKind || cond.Binary.Op.Kind != lexer.SymbolKind || lexer.Symbol(cond.Binary.Op.Value) != lexer.EqualSymbol {
+		return nil, nil, false
+	}
+
+	a, b := &cond.Binary.A, &cond.Binary.B
+	if onOneSide(a, leftColumns, columns, true) && onOneSide(b, leftColumns, columns, false) {
+		return a, b, true
+	}
+	if onOneSide(b, leftColumns, columns, true) && onOneSide(a, leftColumns, columns, false) {
+		return b, a, true
+	}
+	return nil, nil, false
+}
+
+// 计划输出的行是否已经按某一列升序排好了(NULL在最后), 只认直接引用列的表达式
+// 只看计划本身, 不读表里的数据: 按有序索引的顺序扫描表, 子查询有ORDER BY, 或者连接的左边是有序的
+func (plan *fromPlan) sortedOn(exp *parser.Expression) bool {
+	if exp.Kind != parser.LiteralKind || exp.Literal.Kind != lexer.IdentifierKind {
+		return false
+	}
+	columns := plan.columns
+	if plan.kind != joinPlanKind {
+		columns = plan.scanColumns
+	}
+	i, err := lookupIdentifier(columns, exp)
+	if err != nil {
+		return false
+	}
+
+	// 过滤和投影裁剪都不会改变行的顺序
+	switch plan.kind {
+	case scanPlanKind:
+		return plan.orderingScan(i) != nil
+	case subqueryScanPlanKind:
+		return subquerySortedOn(plan.ref.Select, i)
+	case joinPlanKind:
+		// 三种执行方式都按左边的行的顺序输出, 但是RIGHT和FULL连接最后会补上右边没匹配的行
+		if i >= len(plan.left.columns) || plan.keepsUnmatchedRight() {
+			return false
+		}
+		return plan.left.sortedOn(exp)
+	}
+	return false
+}
+
+// 能按第column列的顺序输出行的索引扫描
+// 已经选好了有序索引时, 等值条件的列和它们后面的一列都是有序的
+// 还没有选索引时, 可以用第一列是这一列的有序索引扫描整张表
+func (plan *fromPlan) orderingScan(column int) *indexScan {
+	if plan.scan != nil {
+		idx := plan.scan.index
+		if idx.Method == parser.HashIndex {
+			return nil
+		}
+		n := len(plan.scan.eq) + 1
+		if n > len(idx.Columns) {
+			n = len(idx.Columns)
+		}
+		if containsColumn(idx.Columns[:n], column) {
+			return plan.scan
+		}
+		return nil
+	}
+
+	for _, idx := range plan.table.Indexes {
+		if idx.Method != parser.HashIndex && idx.Columns[0] == column {
+			return &indexScan{index: idx}
+		}
+	}
+	return nil
+}
+
+// 选择了归并连接之后, 让这一边真的按某一列有序输出: 扫描表的时候按有序索引的顺序扫描
+func (plan *fromPlan) provideOrder(exp *parser.Expression) {
+	switch plan.kind {
+	case scanPlanKind:
+		i, err := lookupIdentifier(plan.scanColumns, exp)
+		if err != nil {
+			return
+		}
+		plan.scan = plan.orderingScan(i)
+		plan.scan.ordered = true
+	case joinPlanKind:
+		plan.left.provideOrder(exp)
+	}
+}
+
+// 子查询的结果是否按第column列升序排好了: ORDER BY 的第一项就是这一列, 并且NULL排在最后
+// SELECT 里有 * 的时候不知道每一列对应哪一项, 就当作没有排好序
+func subquerySortedOn(slct *parser.SelectStatement, column int) bool {
+	if slct.Compound != nil || len(slct.OrderBy) == 0 {
+		return false
+	}
+	exps := []*parser.Expression{}
+	for _, item := range slct.Item {
+		if item.Asterisk {
+			return false
+		}
+		exps = append(exps, item.Exp)
+	}
+	orderBy, err := resolveOrderBy(slct.Item, exps, slct.OrderBy[:1])
+	if err != nil || column >= len(exps) {
+		return false
+	}
+
+	first := orderBy[0]
+	if first.Desc || first.Nulls == parser.NullsFirstOrder {
+		return false
+	}
+	return first.Exp.String() == exps[column].String()
+}
+
+// 按计划计算FROM的结果
+func (mb *MemoryBackend) executeFrom(plan *fromPlan) (*relation, error) {
+	switch plan.kind {
+	case scanPlanKind, cteScanPlanKind, subqueryScanPlanKind:
+		rows, err := mb.scanSource(plan)
+		if err != nil {
+			return nil, err
+		}
+		return mb.scanRelation(plan, rows)
+	case singleRowPlanKind:
+		return &relation{
+			rows: [][]MemoryCell{{}},
+		}, nil
+	}
+
+	left, err := mb.executeFrom(plan.left)
+	if err != nil {
+		return nil, err
+	}
+	// 索引里记的是行在表里的位置, 所以索引连接的右边不能提前过滤, 右边的条件在找到候选的行之后再检查
+	var right *relation
+	if plan.strategy == indexJoin {
+		right = &relation{
+			columns: plan.right.columns,
+			rows:    plan.right.project(plan.right.table.rows),
+		}
+	} else {
+		right, err = mb.executeFrom(plan.right)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 每种执行方式的区别只在于: 对于左边的一行, 右边有哪些行可能和它配对
+	var candidates func(i int) ([]int, error)
+	switch plan.strategy {
+	case hashJoin:
+		candidates, err = mb.hashJoinCandidates(plan, left, right)
+	case mergeJoin:
+		candidates, err = mb.mergeJoinCandidates(plan, left, right)
+	case indexJoin:
+		candidates, err = mb.indexJoinCandidates(plan, left)
+	default:
+		all := make([]int, len(right.rows))
+		for j := range all {
+			all[j] = j
+		}
+		candidates = func(int) ([]int, error) { return all, nil }
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows := [][]MemoryCell{}
+	rightMatched := make([]bool, len(right.rows))
+	for i, l := range left.rows {
+		js, err := candidates(i)
+		if err != nil {
+			return nil, err
+		}
+
+		matched := false
+		for _, j := range js {
+			row := append(append([]MemoryCell{}, l...), right.rows[j]...)
+			ok, err := mb.matchCondition(&rowContext{
+				columns: plan.columns,
+				row:     row,
+			}, plan.residual)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+
+			matched = true
+			rightMatched[j] = true
+			rows = append(rows, row)
+		}
+
+		// LEFT 和 FULL 连接里, 没有匹配上的左边的行也要保留
+		if !matched && (plan.joinType == parser.LeftJoin || plan.joinType == parser.FullJoin) {
+			rows = append(rows, append(append([]MemoryCell{}, l...), emptyRow(right.columns)...))
+		}
+	}
+
+	// RIGHT 和 FULL 连接里, 没有匹配上的右边的行也要保留
+	if plan.keepsUnmatchedRight() {
+		for j, r := range right.rows {
+			if !rightMatched[j] {
+				rows = append(rows, append(emptyRow(left.columns), r...))
+			}
+		}
+	}
+
+	return &relation{
+		columns: plan.columns,
+		rows:    rows,
+	}, nil
+}
+
+// 扫描表, CTE 或者子查询的计划要过滤之前的所有行
+// 扫描表时只是找出行, 不计算条件, 所以FROM作为最上面的算子时可以一行一行地过滤, 见fromOperator
+func (mb *MemoryBackend) scanSource(plan *fromPlan) ([][]MemoryCell, error) {
+	switch plan.kind {
+	case subqueryScanPlanKind:
+		results, err := mb.query(plan.ref.Select, nil, false)
+		if err != nil {
+			return nil, err
+		}
+		rows := [][]MemoryCell{}
+		for _, result := range results.Rows {
+			row := []MemoryCell{}
+			for _, cell := range result {
+				row = append(row, cell.(MemoryCell))
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	default:
+		if plan.scan != nil {
+			return mb.executeIndexScan(plan)
+		}
+		return plan.table.rows, nil
+	}
+}
+
+// 扫描出来的行先用下推到扫描上的条件过滤, 再去掉投影裁剪掉的列
+func (mb *MemoryBackend) scanRelation(plan *fromPlan, rows [][]MemoryCell) (*relation, error) {
+	cond := joinConjuncts(plan.filters)
+	filtered := [][]MemoryCell{}
+	for _, row := range rows {
+		ok, err := mb.matchScanCondition(plan, cond, row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			filtered = append(filtered, row)
+		}
+	}
+	return &relation{
+		columns: plan.columns,
+		rows:    plan.project(filtered),
+	}, nil
+}
+
+// 用下推到扫描上的条件检查扫描出来的一行
+func (mb *MemoryBackend) matchScanCondition(plan *fromPlan, cond *parser.Expression, row []MemoryCell) (bool, error) {
+	return mb.matchCondition(&rowContext{
+		columns: plan.scanColumns,
+		row:     row,
+	}, cond)
+}
+
+// 只保留每一行里投影裁剪之后的列
+func (plan *fromPlan) project(rows [][]MemoryCell) [][]MemoryCell {
+	if plan.output == nil {
+		return rows
+	}
+
+	projected := [][]MemoryCell{}
+	for _, row := range rows {
+		projected = append(projected, plan.projectRow(row))
+	}
+	return projected
+}
+
+func (plan *fromPlan) projectRow(row []MemoryCell) []MemoryCell {
+	if plan.output == nil {
+		return row
+	}
+
+	cells := []MemoryCell{}
+	for _, i := range plan.output {
+		cells = append(cells, row[i])
+	}
+	return cells
+}
+
+// 计算一边的每一行在等值条件上的值
+func (mb *MemoryBackend) joinKeys(rel *relation, keys []*parser.Expression) ([][]MemoryCell, error) {
+	values := [][]MemoryCell{}
+	for _, row := range rel.rows {
+		ctx := &rowContext{
+			columns: rel.columns,
+			row:     row,
+		}
+
+		value := []MemoryCell{}
+		for _, exp := range keys {
+			cell, _, err := mb.evaluateCell(ctx, exp)
+			if err != nil {
+				return nil, err
+			}
+			value = append(value, cell)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// 哈希连接: 先用右边的行建哈希表, 左边的一行只可能和哈希表里key相同的行配对
+// NULL和任何值都不相等, 所以key里有NULL的行不会和任何行配对
+func (mb *MemoryBackend) hashJoinCandidates(plan *fromPlan, left, right *relation) (func(int) ([]int, error), error) {
+	rightKeys, err := mb.joinKeys(right, plan.rightKeys)
+	if err != nil {
+		return nil, err
+	}
+	buckets := map[string][]int{}
+	for j, keys := range rightKeys {
+		if hasNull(keys) {
+			continue
+		}
+		key := groupKey(keys)
+		buckets[key] = append(buckets[key], j)
+	}
+
+	leftKeys, err := mb.joinKeys(left, plan.leftKeys)
+	if err != nil {
+		return nil, err
+	}
+	return func(i int) ([]int, error) {
+		if hasNull(leftKeys[i]) {
+			return nil, nil
+		}
+		return buckets[groupKey(leftKeys[i])], nil
+	}, nil
+}
+
+// 有没有任何一个值是NULL
+func hasNull(cells []MemoryCell) bool {
+	for _, cell := range cells {
+		if cell.IsNull() {
+			return true
+		}
+	}
+	return false
+}
+
+// 归并连接: 两边都按key升序排好了, 所以右边的指针只需要往后移动
+// 左边的一行只可能和右边key相同的一段行配对
+func (mb *MemoryBackend) mergeJoinCandidates(plan *fromPlan, left, right *relation) (func(int) ([]int, error), error) {
+	leftKeys, err := mb.joinKeys(left, plan.leftKeys)
+	if err != nil {
+		return nil, err
+	}
+	rightKeys, err := mb.joinKeys(right, plan.rightKeys)
+	if err != nil {
+		return nil, err
+	}
+	typ, err := mb.expressionType(left.columns, plan.leftKeys[0])
+	if err != nil {
+		return nil, err
+	}
+
+	start := 0
+	return func(i int) ([]int, error) {
+		key := leftKeys[i][0]
+		if key.IsNull() {
+			return nil, nil
+		}
+		for start < len(rightKeys) && compareCells(rightKeys[start][0], key, typ) < 0 {
+			start++
+		}
+
+		js := []int{}
+		for j := start; j < len(rightKeys) && compareCells(rightKeys[j][0], key, typ) == 0; j++ {
+			js = append(js, j)
+		}
+		return js, nil
+	}, nil
+}
+
+// 外连接里没有匹配上的一边用一行NULL补上
+func emptyRow(columns []contextColumn) []MemoryCell {
+	return make([]MemoryCell, len(columns))
+}
+
+// EXPLAIN 里显示的执行计划, 每一项是一行
+func (mb *MemoryBackend) explainFrom(plan *fromPlan) ([]string, error) {
+	switch plan.kind {
+	case scanPlanKind, cteScanPlanKind:
+		line := "Seq Scan on " + plan.ref.Table.Value
+		if plan.kind == cteScanPlanKind {
+			line = "CTE Scan on " + plan.ref.Table.Value
+		}
+		if plan.scan != nil {
+			line = "Index Scan using " + plan.scan.index.Name + " on " + plan.ref.Table.Value
+		}
+		if plan.ref.Alias != nil {
+			line += " " + plan.ref.Alias.Value
+		}
+		if plan.scan != nil && len(plan.scan.conds) > 0 {
+			line += ": " + joinConjuncts(plan.scan.conds).String()
+		}
+		return plan.explainFilters([]string{line}), nil
+	case singleRowPlanKind:
+		return []string{"Result"}, nil
+	case subqueryScanPlanKind:
+		sub, err := mb.explainSelect(plan.ref.Select)
+		if err != nil {
+			return nil, err
+		}
+		return plan.explainFilters(explainStep("Subquery Scan on "+plan.ref.Alias.Value, sub)), nil
+	}
+
+	left, err := mb.explainFrom(plan.left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := mb.explainFrom(plan.right)
+	if err != nil {
+		return nil, err
+	}
+
+	line := fmt.Sprintf("%s (%s)", plan.strategy, joinTypeNames[plan.joinType])
+	if plan.strategy == indexJoin {
+		line += " using " + plan.joinIndex.Name
+	}
+	if plan.on != nil {
+		line += " on " + plan.on.String()
+	}
+	return append([]string{line}, explainChildren(left, right)...), nil
+}
+
+// 下推到扫描上的条件显示在扫描的上面
+func (plan *fromPlan) explainFilters(lines []string) []string {
+	if len(plan.filters) == 0 {
+		return lines
+	}
+	return explainStep("Filter: "+joinConjuncts(plan.filters).String(), lines)
+}
+
+// 子节点的计划缩进之后放在父节点的下面
+func explainChildren(children ...[]string) []string {
+	lines := []string{}
+	for _, child := range children {
+		for i, line := range child {
+			if i == 0 {
+				lines = append(lines, "  -> "+line)
+				continue
+			}
+			lines = append(lines, "     "+line)
+		}
+	}
+	return lines
+}
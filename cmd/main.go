@@ -7,7 +7,6 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"strconv"
 	"strings"
 
 	"github.com/database-from-zero-to-one/lexer"
@@ -21,38 +20,94 @@ type ColumnType uint
 const (
 	TextType ColumnType = iota
 	IntType
+	BoolType
+	NullType // 只有NULL字面量是这个类型, 它可以当作任何类型使用, 表里的列不会是这个类型
 )
 
+func (c ColumnType) String() string {
+	switch c {
+	case TextType:
+		return "text"
+	case IntType:
+		return "int"
+	case BoolType:
+		return "bool"
+	case NullType:
+		return "null"
+	}
+	return "unknown"
+}
+
+// 一个值, 是NULL的时候不能调用As开头的方法
 type Cell interface {
 	AsText() string
 	AsInt() int32
+	AsBool() bool
+	IsNull() bool
+}
+
+// 结果中的一列既要有类型,也要有名字
+type ResultColumn struct {
+	Type ColumnType
+	Name string
 }
 
 // 返回的结果
 type Results struct {
-	Columns []struct {
-		Type ColumnType // 一个列既要有类型,也要有名字
-		Name string
-	}
-	Rows [][]Cell // 一个行/记录
+	Columns []ResultColumn
+	Rows    [][]Cell // 一个行/记录
 }
 
 // 定义一些错误
 var (
-	ErrTableDoesNotExist  = errors.New("table does not exist")
-	ErrColumnDoesNotExist = errors.New("column does not exist")
-	ErrInvalidSelectItem  = errors.New("select Item is invalid")
-	ErrInvalidDataType    = errors.New("invalid datatype")
-	ErrMissingValue       = errors.New("missing values")
+	ErrTableDoesNotExist    = errors.New("table does not exist")
+	ErrTableAlreadyExists   = errors.New("table already exists")
+	ErrColumnDoesNotExist   = errors.New("column does not exist")
+	ErrInvalidSelectItem    = errors.New("select Item is invalid")
+	ErrInvalidDataType      = errors.New("invalid datatype")
+	ErrMissingValue         = errors.New("missing values")
+	ErrInvalidOperator      = errors.New("invalid operator")
+	ErrTypeMismatch         = errors.New("type mismatch")
+	ErrDivisionByZero       = errors.New("division by zero")
+	ErrDuplicateColumn      = errors.New("duplicate column")
+	ErrInvalidLimit         = errors.New("invalid LIMIT or OFFSET")
+	ErrFunctionDoesNotExist = errors.New("function does not exist")
+	ErrInvalidAggregate     = errors.New("invalid use of aggregate function")
+	ErrNotGrouped           = errors.New("column must appear in GROUP BY or be used in an aggregate function")
+	ErrAmbiguousColumn      = errors.New("column reference is ambiguous")
+	ErrDuplicateTableName   = errors.New("table name specified more than once")
+	ErrColumnCountMismatch  = errors.New("each UNION, INTERSECT or EXCEPT query must have the same number of columns")
+	ErrInvalidSubquery      = errors.New("invalid subquery")
+	ErrInvalidRecursion     = errors.New("invalid recursive query")
+	ErrNotNullViolation     = errors.New("null value violates not-null constraint")
+	ErrUniqueViolation      = errors.New("duplicate key value violates unique constraint")
+	ErrCheckViolation       = errors.New("row violates check constraint")
+	ErrDuplicateConstraint  = errors.New("constraint already exists")
+	ErrForeignKeyViolation  = errors.New("violates foreign key constraint")
+	ErrInvalidForeignKey    = errors.New("invalid foreign key")
+	ErrDependentObjects     = errors.New("other objects depend on it")
+	ErrIndexAlreadyExists   = errors.New("index already exists")
+	ErrIndexDoesNotExist    = errors.New("index does not exist")
+	ErrOutOfRange           = errors.New("integer out of range")
+	ErrInvalidOrderBy       = errors.New("invalid ORDER BY")
+	ErrCteColumnMismatch    = errors.New("WITH query column count mismatch")
 )
 
 type Backend interface {
 	CreateTable(*parser.CreateStatement) error
+	DropTable(*parser.DropTableStatement) error
+	AlterTable(*parser.AlterTableStatement) error
 	Insert(*parser.InsertStatement) error
 	Select(*parser.SelectStatement) (*Results, error)
+	Update(*parser.UpdateStatement) (uint, error) // 返回被修改的行数
+	Delete(*parser.DeleteStatement) (uint, error) // 返回被删除的行数
+	Explain(*parser.ExplainStatement) (*Results, error)
+	CreateIndex(*parser.CreateIndexStatement) error
+	DropIndex(*parser.DropIndexStatement) error
+	Analyze(*parser.AnalyzeStatement) error
 }
 
-////////////////////////////////
+// //////////////////////////////
 // memory layout
 type MemoryCell []byte
 
@@ -70,14 +125,52 @@ func (mc MemoryCell) AsText() string {
 	return string(mc)
 }
 
+func (mc MemoryCell) AsBool() bool {
+	return len(mc) > 0 && mc[0] != 0
+}
+
+// NULL用nil表示, 空字符串转换成[]byte之后不是nil, 所以不会和NULL混淆
+func (mc MemoryCell) IsNull() bool {
+	return mc == nil
+}
+
+func nullCell() MemoryCell {
+	return nil
+}
+
+func intCell(i int32) MemoryCell {
+	buf := new(bytes.Buffer)
+	err := binary.Write(buf, binary.BigEndian, i)
+	if err != nil {
+		panic(err)
+	}
+	return MemoryCell(buf.Bytes())
+}
+
+func boolCell(b bool) MemoryCell {
+	if b {
+		return MemoryCell{1}
+	}
+	return MemoryCell{0}
+}
+
+func textCell(s string) MemoryCell {
+	return MemoryCell(s)
+}
+
 type table struct {
-	Columns     []string
-	ColumnTypes []ColumnType
-	rows        [][]MemoryCell
+	Columns        []string
+	ColumnTypes    []ColumnType
+	ColumnDefaults []*parser.Expression // 每一列的默认值, 没有默认值时为nil
+	Constraints    []*constraint        // 列约束和表约束都在这里, 按定义的顺序检查
+	Indexes        []*index             // 表上的索引, 修改表的时候一起更新
+	Stats          *tableStats          // ANALYZE 收集的统计信息, 没有ANALYZE过时为nil
+	rows           [][]MemoryCell
 }
 
 type MemoryBackend struct {
-	tables map[string]*table // 多张table
+	tables map[string]*table   // 多张table
+	ctes   []map[string]*table // 正在执行的查询的WITH里定义的CTE, 里层的WITH在后面
 }
 
 func NewMemoryBackend() *MemoryBackend {
@@ -88,25 +181,223 @@ func NewMemoryBackend() *MemoryBackend {
 
 // Implementing create table support
 func (mb *MemoryBackend) CreateTable(crt *parser.CreateStatement) error {
+	if _, ok := mb.tables[crt.Table.Value]; ok {
+		if crt.IfNotExists {
+			return nil
+		}
+		return fmt.Errorf("%w: %s", ErrTableAlreadyExists, crt.Table.Value)
+	}
+
+	// 所有的列都检查完了才把表加进去, 这样出错的时候不会留下一张不完整的表
 	t := table{}
+	if crt.Cols != nil {
+		for _, col := range *crt.Cols {
+			if err := mb.addColumn(&t, col); err != nil {
+				return err
+			}
+		}
+
+	}
+
+	// 约束在所有的列都加完之后再加, 这样CHECK里可以引用后面的列
+	// 外键最后加, 这样引用自己的外键可以用到表约束里定义的主键
+	for _, foreignKeys := range []bool{false, true} {
+		if crt.Cols != nil {
+			for i, col := range *crt.Cols {
+				for _, c := range col.Constraints {
+					if (c.Kind == parser.ForeignKeyConstraint) != foreignKeys {
+						continue
+					}
+					if err := mb.addConstraint(&t, crt.Table.Value, c, i); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		for _, c := range crt.Constraints {
+			if (c.Kind == parser.ForeignKeyConstraint) != foreignKeys {
+				continue
+			}
+			if err := mb.addConstraint(&t, crt.Table.Value, c, -1); err != nil {
+				return err
+			}
+		}
+	}
+
 	mb.tables[crt.Table.Value] = &t
-	if crt.Cols == nil {
-		return nil
+	return nil
+}
+
+// 把列的类型关键字转换成ColumnType
+func columnTypeFromToken(t lexer.Token) (ColumnType, error) {
+	switch t.Value {
+	case "int":
+		return IntType, nil
+	case "text":
+		return TextType, nil
+	case "bool":
+		return BoolType, nil
+	}
+	return 0, fmt.Errorf("%w: %s", ErrInvalidDataType, t.Value)
+}
+
+// 检查列的定义并把它加到表的最后, 表里已有的行不会被修改
+func (mb *MemoryBackend) addColumn(t *table, col *parser.ColumnDefinition) error {
+	for _, name := range t.Columns {
+		if name == col.Name.Value {
+			return fmt.Errorf("%w: %s", ErrDuplicateColumn, name)
+		}
 	}
 
-	for _, col := range *crt.Cols {
-		t.Columns = append(t.Columns, col.Name.Value)
+	datatype, err := columnTypeFromToken(col.Datatype)
+	if err != nil {
+		return err
+	}
 
-		var datatype ColumnType
-		switch col.Datatype.Value {
-		case "int":
-			datatype = IntType
-		case "text":
-			datatype = TextType
-		default:
-			return ErrInvalidDataType
+	// 默认值不能引用任何列, 类型也要和列一致
+	if col.Default != nil {
+		typ, err := mb.expressionType(nil, col.Default)
+		if err != nil {
+			return err
+		}
+		if !isType(typ, datatype) {
+			return fmt.Errorf("%w: default of column %s expects %s, got %s", ErrTypeMismatch, col.Name.Value, datatype, typ)
+		}
+	}
+
+	t.Columns = append(t.Columns, col.Name.Value)
+	t.ColumnTypes = append(t.ColumnTypes, datatype)
+	t.ColumnDefaults = append(t.ColumnDefaults, col.Default)
+	return nil
+}
+
+// 计算某一列的默认值, 没有默认值时就是NULL
+func (mb *MemoryBackend) defaultValue(t *table, column int) (MemoryCell, error) {
+	if t.ColumnDefaults[column] == nil {
+		return nullCell(), nil
+	}
+
+	cell, _, err := mb.evaluateCell(&rowContext{}, t.ColumnDefaults[column])
+	return cell, err
+}
+
+// Implementing drop table support
+func (mb *MemoryBackend) DropTable(drop *parser.DropTableStatement) error {
+	if _, ok := mb.tables[drop.Table.Value]; !ok {
+		if drop.IfExists {
+			return nil
+		}
+		return ErrTableDoesNotExist
+	}
+
+	// 还有别的表的外键引用这张表时不能删除
+	for _, name := range sortedTableNames(mb.tables) {
+		if name == drop.Table.Value {
+			continue
+		}
+		for _, c := range mb.tables[name].Constraints {
+			if c.Kind == parser.ForeignKeyConstraint && c.RefTable == drop.Table.Value {
+				return fmt.Errorf("%w: constraint %s on table %s references table %s", ErrDependentObjects, c.Name, name, drop.Table.Value)
+			}
+		}
+	}
+
+	delete(mb.tables, drop.Table.Value)
+	return nil
+}
+
+// Implementing alter table support
+func (mb *MemoryBackend) AlterTable(alter *parser.AlterTableStatement) error {
+	t, ok := mb.tables[alter.Table.Value]
+	if !ok {
+		return ErrTableDoesNotExist
+	}
+
+	switch alter.Action {
+	case parser.AddColumnAction:
+		// 新的列先加到一份拷贝上, 已有的行也都用默认值补上之后再替换
+		altered := *t
+		altered.Columns = append([]string{}, t.Columns...)
+		altered.ColumnTypes = append([]ColumnType{}, t.ColumnTypes...)
+		altered.ColumnDefaults = append([]*parser.Expression{}, t.ColumnDefaults...)
+		altered.Constraints = append([]*constraint{}, t.Constraints...)
+		if err := mb.addColumn(&altered, alter.Column); err != nil {
+			return err
+		}
+		for _, c := range alter.Column.Constraints {
+			if err := mb.addConstraint(&altered, alter.Table.Value, c, len(altered.Columns)-1); err != nil {
+				return err
+			}
+		}
+
+		value, err := mb.defaultValue(&altered, len(altered.Columns)-1)
+		if err != nil {
+			return err
+		}
+		altered.rows = [][]MemoryCell{}
+		changed := []int{}
+		for i, row := range t.rows {
+			newRow := append([]MemoryCell{}, row...)
+			altered.rows = append(altered.rows, append(newRow, value))
+			changed = append(changed, i)
+		}
+
+		// 已有的行也要满足新的列上的约束, 比如没有默认值的NOT NULL列只能加到空表上
+		// 引用自己的外键要在加了新列之后的行里找被引用的行
+		cs := newChangeSet()
+		cs.tables[alter.Table.Value] = &tableChanges{rows: altered.rows}
+		if err := mb.checkConstraints(cs, &altered, altered.rows, changed); err != nil {
+			return err
+		}
+
+		*t = altered
+	case parser.DropColumnAction:
+		i, err := lookupColumn(t.contextColumns(alter.Table.Value), "", alter.Name.Value)
+		if err != nil {
+			return err
+		}
+
+		if err := mb.checkDroppedColumnReferences(alter.Table.Value, i); err != nil {
+			return err
+		}
+
+		t.Columns = append(t.Columns[:i:i], t.Columns[i+1:]...)
+		t.ColumnTypes = append(t.ColumnTypes[:i:i], t.ColumnTypes[i+1:]...)
+		t.ColumnDefaults = append(t.ColumnDefaults[:i:i], t.ColumnDefaults[i+1:]...)
+		t.dropColumnConstraints(i)
+		t.dropColumnIndexes(i)
+		t.dropColumnStats(i)
+		mb.dropReferencedColumn(alter.Table.Value, i)
+		for rowIndex, row := range t.rows {
+			t.rows[rowIndex] = append(row[:i:i], row[i+1:]...)
+		}
+	case parser.RenameColumnAction:
+		i, err := lookupColumn(t.contextColumns(alter.Table.Value), "", alter.Name.Value)
+		if err != nil {
+			return err
+		}
+		if _, err := lookupColumn(t.contextColumns(alter.Table.Value), "", alter.NewName.Value); err == nil {
+			return fmt.Errorf("%w: %s", ErrDuplicateColumn, alter.NewName.Value)
+		}
+
+		t.renameColumnConstraints(t.Columns[i], alter.NewName.Value)
+		t.Columns[i] = alter.NewName.Value
+	case parser.RenameTableAction:
+		if _, ok := mb.tables[alter.NewName.Value]; ok {
+			return fmt.Errorf("%w: %s", ErrTableAlreadyExists, alter.NewName.Value)
+		}
+
+		delete(mb.tables, alter.Table.Value)
+		mb.tables[alter.NewName.Value] = t
+
+		// 引用这张表的外键也要改成新的表名
+		for _, other := range mb.tables {
+			for _, c := range other.Constraints {
+				if c.Kind == parser.ForeignKeyConstraint && c.RefTable == alter.Table.Value {
+					c.RefTable = alter.NewName.Value
+				}
+			}
 		}
-		t.ColumnTypes = append(t.ColumnTypes, datatype)
 	}
 	return nil
 }
@@ -120,125 +411,371 @@ func (mb *MemoryBackend) Insert(inst *parser.InsertStatement) error {
 		return ErrTableDoesNotExist
 	}
 
-	if inst.Values == nil {
-		return nil
+	// 找到要插入的每一列在表里的位置, 没有写列名时就是所有的列
+	columns := []int{}
+	if len(inst.Columns) == 0 {
+		for i := range table.Columns {
+			columns = append(columns, i)
+		}
+	}
+	for _, name := range inst.Columns {
+		i, err := lookupColumn(table.contextColumns(inst.Table.Value), "", name.Value)
+		if err != nil {
+			return err
+		}
+		for _, j := range columns {
+			if i == j {
+				return fmt.Errorf("%w: %s", ErrDuplicateColumn, name.Value)
+			}
+		}
+		columns = append(columns, i)
 	}
 
-	row := []MemoryCell{}
+	// 每一行要插入的值, 插入的值不能引用任何列
+	values := [][]MemoryCell{}
+	if inst.Select != nil {
+		results, err := mb.Select(inst.Select)
+		if err != nil {
+			return err
+		}
+		if len(results.Columns) != len(columns) {
+			return fmt.Errorf("%w: expects %d columns, got %d", ErrMissingValue, len(columns), len(results.Columns))
+		}
+		for i, col := range results.Columns {
+			column := columns[i]
+			if !isType(col.Type, table.ColumnTypes[column]) {
+				return fmt.Errorf("%w: column %s expects %s, got %s", ErrTypeMismatch, table.Columns[column], table.ColumnTypes[column], col.Type)
+			}
+		}
+		for _, result := range results.Rows {
+			row := []MemoryCell{}
+			for _, cell := range result {
+				row = append(row, cell.(MemoryCell))
+			}
+			values = append(values, row)
+		}
+	}
 
-	// 插入的值与列的数量对应不上
-	if len(*inst.Values) != len(table.Columns) {
-		return ErrMissingValue
+	ctx := &rowContext{}
+	for _, exps := range inst.Values {
+		// 插入的值与列的数量对应不上
+		if len(exps) != len(columns) {
+			return fmt.Errorf("%w: expects %d values, got %d", ErrMissingValue, len(columns), len(exps))
+		}
+
+		row := []MemoryCell{}
+		for i, value := range exps {
+			column := columns[i]
+			cell, typ, err := mb.evaluateCell(ctx, value)
+			if err != nil {
+				return err
+			}
+			if !isType(typ, table.ColumnTypes[column]) {
+				return fmt.Errorf("%w: column %s expects %s, got %s", ErrTypeMismatch, table.Columns[column], table.ColumnTypes[column], typ)
+			}
+			row = append(row, cell)
+		}
+		values = append(values, row)
+	}
+
+	// 所有的行都没有问题并且满足约束之后才一起插入, 没有给出值的列用默认值
+	cs := newChangeSet()
+	for _, value := range values {
+		row := make([]MemoryCell, len(table.Columns))
+		for i := range row {
+			cell, err := mb.defaultValue(table, i)
+			if err != nil {
+				return err
+			}
+			row[i] = cell
+		}
+		for i, column := range columns {
+			row[column] = value[i]
+		}
+		mb.insertRow(cs, inst.Table.Value, row)
+	}
+	return mb.commit(cs)
+}
+
+// Implementing update support
+func (mb *MemoryBackend) Update(upd *parser.UpdateStatement) (uint, error) {
+	table, ok := mb.tables[upd.Table.Value]
+	if !ok {
+		return 0, ErrTableDoesNotExist
 	}
 
-	for _, value := range *inst.Values {
-		// if value.Kind == parser.LiteralKind {
-		// 	fmt.Println("Skipp non-literal")
-		// 	continue
-		// }
-		if value.Kind != parser.LiteralKind {
-			fmt.Println("Skipp non-literal")
+	// 先检查SET里的每一列都存在, 并且新值的类型和列的类型一致
+	tableColumns := table.contextColumns(upd.Table.Value)
+	indexes := []int{}
+	for _, set := range upd.Set {
+		i, err := lookupColumn(tableColumns, "", set.Column.Value)
+		if err != nil {
+			return 0, err
+		}
+		for _, j := range indexes {
+			if i == j {
+				return 0, fmt.Errorf("%w: %s is set more than once", ErrDuplicateColumn, set.Column.Value)
+			}
+		}
+
+		typ, err := mb.expressionType(tableColumns, set.Value)
+		if err != nil {
+			return 0, err
+		}
+		if !isType(typ, table.ColumnTypes[i]) {
+			return 0, fmt.Errorf("%w: column %s expects %s, got %s", ErrTypeMismatch, table.Columns[i], table.ColumnTypes[i], typ)
+		}
+		indexes = append(indexes, i)
+	}
+
+	if err := mb.checkCondition(tableColumns, upd.Where, "WHERE"); err != nil {
+		return 0, err
+	}
+
+	// 先把所有的新行都算出来, 中途出错的话表里的数据不会被改掉一半
+	updated := map[int][]MemoryCell{}
+	for rowIndex, row := range table.rows {
+		ctx := &rowContext{
+			columns: tableColumns,
+			row:     row,
+		}
+
+		ok, err := mb.matchCondition(ctx, upd.Where)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
 			continue
 		}
-		row = append(row, mb.tokenToCell(value.Literal))
+
+		// SET里的表达式看到的都是修改之前的值
+		values := []MemoryCell{}
+		for _, set := range upd.Set {
+			cell, _, err := mb.evaluateCell(ctx, set.Value)
+			if err != nil {
+				return 0, err
+			}
+			values = append(values, cell)
+		}
+		updated[rowIndex] = values
 	}
 
-	table.rows = append(table.rows, row)
-	return nil
+	// 引用被修改的行的外键按照ON UPDATE处理, 所有的表都满足约束之后才一起修改
+	// 外键引用自己这张表时, 前面的行的级联修改可能已经改过这一行, 所以在这一行现在的值上修改SET里的列
+	cs := newChangeSet()
+	for _, rowIndex := range sortedRowIndexes(updated) {
+		newRow := append([]MemoryCell{}, mb.tableChanges(cs, upd.Table.Value).rows[rowIndex]...)
+		for k, cell := range updated[rowIndex] {
+			newRow[indexes[k]] = cell
+		}
+		if err := mb.updateRow(cs, upd.Table.Value, rowIndex, newRow); err != nil {
+			return 0, err
+		}
+	}
+	if err := mb.commit(cs); err != nil {
+		return 0, err
+	}
+	return uint(len(updated)), nil
+}
+
+// Implementing delete support
+func (mb *MemoryBackend) Delete(del *parser.DeleteStatement) (uint, error) {
+	table, ok := mb.tables[del.Table.Value]
+	if !ok {
+		return 0, ErrTableDoesNotExist
+	}
+
+	tableColumns := table.contextColumns(del.Table.Value)
+	if err := mb.checkCondition(tableColumns, del.Where, "WHERE"); err != nil {
+		return 0, err
+	}
+
+	// 先找到所有要删除的行, 全部判断完之后再删除, 中途出错的话一行都不删
+	matched := []int{}
+	for rowIndex, row := range table.rows {
+		ctx := &rowContext{
+			columns: tableColumns,
+			row:     row,
+		}
+
+		ok, err := mb.matchCondition(ctx, del.Where)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			matched = append(matched, rowIndex)
+		}
+	}
+
+	// 引用被删除的行的外键按照ON DELETE处理, 已经因为CASCADE被删除的行不再计数
+	cs := newChangeSet()
+	deleted := uint(0)
+	for _, rowIndex := range matched {
+		ok, err := mb.deleteRow(cs, del.Table.Value, rowIndex)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			deleted++
+		}
+	}
+	if err := mb.commit(cs); err != nil {
+		return 0, err
+	}
+	return deleted, nil
 }
 
 // Implementing select support
 func (mb *MemoryBackend) Select(slct *parser.SelectStatement) (*Results, error) {
-	// 查看表名是否存在
-	// table, ok := mb.tables[slct.From.Value]
-	table, ok := mb.tables[slct.From.Value]
-	if !ok {
-		return nil, ErrTableDoesNotExist
+	return mb.query(slct, nil, false)
+}
+
+// 执行查询, 子查询执行时outer是外层查询当前的一行, 不是子查询时为nil
+// columnsOnly为true时只做类型检查, 不读取任何一行, 返回的结果里只有列
+func (mb *MemoryBackend) query(slct *parser.SelectStatement, outer *rowContext, columnsOnly bool) (*Results, error) {
+	if slct.With != nil {
+		return mb.queryWith(slct, outer, columnsOnly)
+	}
+	if slct.Compound != nil {
+		return mb.selectCompound(slct, outer, columnsOnly)
 	}
 
+	// 生成查询计划的时候就做完了类型检查, 只要结果的列时不用执行
+	plan, err := mb.planSelect(slct, outer)
+	if err != nil {
+		return nil, err
+	}
 	results := [][]Cell{}
-	columns := []struct {
-		Type ColumnType
-		Name string
-	}{}
-
-	// 遍历所有的行
-	for i, row := range table.rows {
-		result := []Cell{}
-		// 是否是第一行
-		isFirstRow := i == 0
+	if columnsOnly {
+		return &Results{
+			Columns: plan.columns,
+			Rows:    results,
+		}, nil
+	}
 
-		for _, exp := range slct.Item {
-			if exp.Kind != parser.LiteralKind {
-				fmt.Println("Skipping non-literal expression")
-				continue
-			}
-			// 字面量
-			lit := exp.Literal
-			// 看看是不是标识符类型
-			if lit.Kind == lexer.IdentifierKind {
-				found := false
-				// 遍历所有的列
-				for i, tableCol := range table.Columns {
-					if tableCol == lit.Value {
-						// 第一行就是列名什么的
-						if isFirstRow {
-							columns = append(columns, struct {
-								Type ColumnType
-								Name string
-							}{
-								Type: table.ColumnTypes[i],
-								Name: lit.Value,
-							})
-						}
-
-						result = append(result, row[i])
-						found = true
-						// 找到一个，跳出最近的这个for循环
-						break
-					}
-				}
-				// 如果一个item都没有找到
-				if !found {
-					return nil, ErrColumnDoesNotExist
-				}
+	op, _ := mb.physicalPlan(plan.root, outer)
+	for {
+		row, ok, err := op.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
 
-				continue
-			}
-			return nil, ErrColumnDoesNotExist
-			// 错误:
-			// results = append(results, result)
+		// 投影之后的行后面可能还有排序键, 不属于结果
+		result := []Cell{}
+		for _, cell := range row[:len(plan.columns)] {
+			result = append(result, cell)
 		}
 		results = append(results, result)
 	}
 
 	return &Results{
-		Columns: columns,
+		Columns: plan.columns,
 		Rows:    results,
 	}, nil
 }
 
-func (mb *MemoryBackend) tokenToCell(t *lexer.Token) MemoryCell {
-	if t.Kind == lexer.NumericKind {
-		buf := new(bytes.Buffer)
-		// string converted into int
-		i, err := strconv.Atoi(t.Value)
-		if err != nil {
-			panic(err)
+// 把 * 和 t.* 展开成对应的每一列, 顺序和建表时列的顺序一样
+// 返回每一项的表达式和它在结果中的名字
+func expandSelectItems(slct *parser.SelectStatement, columns []contextColumn) ([]*parser.Expression, []string, error) {
+	exps := []*parser.Expression{}
+	names := []string{}
+	for _, item := range slct.Item {
+		if !item.Asterisk {
+			exps = append(exps, item.Exp)
+			names = append(names, selectItemName(item))
+			continue
 		}
 
-		err = binary.Write(buf, binary.BigEndian, int32(i))
-		if err != nil {
-			panic(err)
+		if len(slct.From) == 0 {
+			return nil, nil, fmt.Errorf("%w: SELECT * with no tables specified", ErrInvalidSelectItem)
+		}
+
+		// t.* 里的t必须是FROM里的表, 就算这张表没有列; 没有列的时候 * 展开之后什么都没有
+		if item.Table != nil && !fromTableNames(slct.From)[item.Table.Value] {
+			return nil, nil, fmt.Errorf("%w: %s", ErrTableDoesNotExist, item.Table.Value)
+		}
+		for _, col := range columns {
+			if item.Table != nil && col.Table != item.Table.Value {
+				continue
+			}
+
+			// 展开之后的列都带上表名, 这样多张表有同名的列时也不会有歧义
+			exps = append(exps, &parser.Expression{
+				Literal: &lexer.Token{
+					Value: col.Name,
+					Kind:  lexer.IdentifierKind,
+				},
+				Table: &lexer.Token{
+					Value: col.Table,
+					Kind:  lexer.IdentifierKind,
+				},
+				Kind: parser.LiteralKind,
+			})
+			names = append(names, col.Name)
 		}
-		return MemoryCell(buf.Bytes())
 	}
+	return exps, names, nil
+}
 
-	if t.Kind == lexer.StringKind {
-		return MemoryCell(t.Value)
+// FROM里所有的表的名字, 有别名时是别名
+func fromTableNames(from []*parser.TableReference) map[string]bool {
+	names := map[string]bool{}
+	for _, ref := range from {
+		// 执行计划里已经检查过名字不会重复了
+		_ = checkTableNames(ref, names)
 	}
+	return names
+}
 
-	return nil
+// 结果中一列的名字: 有别名时就是别名
+func selectItemName(item *parser.SelectItem) string {
+	if item.As != nil {
+		return item.As.Value
+	}
+	return resultColumnName(item.Exp)
+}
+
+// 没有别名时, 直接选择某一列时是列名, 调用函数时是函数名
+func resultColumnName(exp *parser.Expression) string {
+	switch exp.Kind {
+	case parser.LiteralKind:
+		if exp.Literal.Kind == lexer.IdentifierKind {
+			return exp.Literal.Value
+		}
+	case parser.FunctionKind:
+		return exp.Function.Name.Value
+	}
+	return "?column?"
+}
+
+// 计算LIMIT和OFFSET的值, 没有LIMIT时limit为-1
+func (mb *MemoryBackend) limitAndOffset(slct *parser.SelectStatement) (int, int, error) {
+	values := []int{-1, 0}
+	for i, exp := range []*parser.Expression{slct.Limit, slct.Offset} {
+		if exp == nil {
+			continue
+		}
+
+		// LIMIT和OFFSET只能是不引用任何列的int表达式, 和PostgreSQL一样, 值是NULL时就和没有写一样
+		cell, typ, err := mb.evaluateCell(&rowContext{}, exp)
+		if err != nil {
+			return 0, 0, err
+		}
+		if !isType(typ, IntType) {
+			return 0, 0, fmt.Errorf("%w: expects int, got %s", ErrInvalidLimit, typ)
+		}
+		if cell.IsNull() {
+			continue
+		}
+		if cell.AsInt() < 0 {
+			return 0, 0, fmt.Errorf("%w: %d is negative", ErrInvalidLimit, cell.AsInt())
+		}
+		values[i] = int(cell.AsInt())
+	}
+	return values[0], values[1], nil
 }
 
 func main() {
@@ -262,65 +799,138 @@ func main() {
 		// 尝试，trim space 失败
 		// text = strings.Replace(text, " ", "", -1)
 
+		// 出错的时候只打印错误信息, 不要让整个REPL退出
 		ast, err := parser.Parse(text)
 		if err != nil {
-			panic(err)
+			fmt.Println("Error:", err)
+			continue
 		}
 
 		for _, stmt := range ast.Statements {
 			// 判断statement类型
 			switch stmt.Kind {
 			case parser.CreateKind:
-				err = mb.CreateTable(ast.Statements[0].CreateStatement)
+				err = mb.CreateTable(stmt.CreateStatement)
+				if err != nil {
+					fmt.Println("Error:", err)
+					continue
+				}
+				fmt.Println("ok")
+			case parser.DropTableKind:
+				err = mb.DropTable(stmt.DropTableStatement)
 				if err != nil {
-					panic(err)
+					fmt.Println("Error:", err)
+					continue
+				}
+				fmt.Println("ok")
+			case parser.AlterTableKind:
+				err = mb.AlterTable(stmt.AlterTableStatement)
+				if err != nil {
+					fmt.Println("Error:", err)
+					continue
+				}
+				fmt.Println("ok")
+			case parser.CreateIndexKind:
+				err = mb.CreateIndex(stmt.CreateIndexStatement)
+				if err != nil {
+					fmt.Println("Error:", err)
+					continue
+				}
+				fmt.Println("ok")
+			case parser.DropIndexKind:
+				err = mb.DropIndex(stmt.DropIndexStatement)
+				if err != nil {
+					fmt.Println("Error:", err)
+					continue
+				}
+				fmt.Println("ok")
+			case parser.AnalyzeKind:
+				err = mb.Analyze(stmt.AnalyzeStatement)
+				if err != nil {
+					fmt.Println("Error:", err)
+					continue
 				}
 				fmt.Println("ok")
 			case parser.InsertKind:
 				err = mb.Insert(stmt.InsertStatement)
 				if err != nil {
-					panic(err)
+					fmt.Println("Error:", err)
+					continue
 				}
 				fmt.Println("ok")
-			case parser.SelectKind:
-				results, err := mb.Select(stmt.SelectStatement)
+			case parser.UpdateKind:
+				affected, err := mb.Update(stmt.UpdateStatement)
 				if err != nil {
-					panic(err)
+					fmt.Println("Error:", err)
+					continue
 				}
-				// 打印每一列
-				for _, col := range results.Columns {
-					fmt.Printf("| %s ", col.Name)
+				fmt.Printf("ok, %d row(s) affected\n", affected)
+			case parser.DeleteKind:
+				affected, err := mb.Delete(stmt.DeleteStatement)
+				if err != nil {
+					fmt.Println("Error:", err)
+					continue
 				}
-				fmt.Println("|")
-
-				// 打印分割线
-				for j := 0; j < 20; j++ {
-					fmt.Printf("=")
+				fmt.Printf("ok, %d row(s) affected\n", affected)
+			case parser.SelectKind:
+				results, err := mb.Select(stmt.SelectStatement)
+				if err != nil {
+					fmt.Println("Error:", err)
+					continue
 				}
-				fmt.Println()
-
-				// 然后打印行
-				for _, result := range results.Rows {
-					fmt.Printf("|")
-
-					for i, cell := range result {
-						typ := results.Columns[i].Type
-						s := ""
-						switch typ {
-						case IntType:
-							// s = strconv.Itoa(int(cell.AsInt()))
-							s = fmt.Sprintf("%d", cell.AsInt())
-						case TextType:
-							s = cell.AsText()
-						}
-
-						fmt.Printf(" %s | ", s)
-					}
-					fmt.Println()
+				printResults(results)
+			case parser.ExplainKind:
+				results, err := mb.Explain(stmt.ExplainStatement)
+				if err != nil {
+					fmt.Println("Error:", err)
+					continue
 				}
-				fmt.Println("ok")
+				printResults(results)
 			}
 		}
 	}
 
 }
+
+// 把一个值转换成字符串, NULL和空字符串要能区分开
+func cellString(cell Cell, typ ColumnType) string {
+	if cell.IsNull() {
+		return "NULL"
+	}
+	switch typ {
+	case IntType:
+		// s = strconv.Itoa(int(cell.AsInt()))
+		return fmt.Sprintf("%d", cell.AsInt())
+	case TextType:
+		return cell.AsText()
+	case BoolType:
+		return fmt.Sprintf("%t", cell.AsBool())
+	}
+	return ""
+}
+
+// 打印查询的结果
+func printResults(results *Results) {
+	// 打印每一列
+	for _, col := range results.Columns {
+		fmt.Printf("| %s ", col.Name)
+	}
+	fmt.Println("|")
+
+	// 打印分割线
+	for j := 0; j < 20; j++ {
+		fmt.Printf("=")
+	}
+	fmt.Println()
+
+	// 然后打印行
+	for _, result := range results.Rows {
+		fmt.Printf("|")
+
+		for i, cell := range result {
+			fmt.Printf(" %s | ", cellString(cell, results.Columns[i].Type))
+		}
+		fmt.Println()
+	}
+	fmt.Println("ok")
+}
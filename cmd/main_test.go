@@ -0,0 +1,3145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/database-from-zero-to-one/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+// 解析一条SQL语句, 测试用的辅助函数
+func mustParse(t *testing.T, source string) *parser.Statement {
+	ast, err := parser.Parse(source)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %s", source, err)
+	}
+	return ast.Statements[0]
+}
+
+// 执行一条不返回结果的语句, 测试用的辅助函数
+func execute(mb *MemoryBackend, stmt *parser.Statement) error {
+	var err error
+	switch stmt.Kind {
+	case parser.CreateKind:
+		err = mb.CreateTable(stmt.CreateStatement)
+	case parser.DropTableKind:
+		err = mb.DropTable(stmt.DropTableStatement)
+	case parser.AlterTableKind:
+		err = mb.AlterTable(stmt.AlterTableStatement)
+	case parser.InsertKind:
+		err = mb.Insert(stmt.InsertStatement)
+	case parser.UpdateKind:
+		_, err = mb.Update(stmt.UpdateStatement)
+	case parser.DeleteKind:
+		_, err = mb.Delete(stmt.DeleteStatement)
+	case parser.CreateIndexKind:
+		err = mb.CreateIndex(stmt.CreateIndexStatement)
+	case parser.DropIndexKind:
+		err = mb.DropIndex(stmt.DropIndexStatement)
+	case parser.AnalyzeKind:
+		err = mb.Analyze(stmt.AnalyzeStatement)
+	}
+	return err
+}
+
+// 建一张users表并插入几行数据
+func newTestBackend(t *testing.T) *MemoryBackend {
+	mb := NewMemoryBackend()
+	err := mb.CreateTable(mustParse(t, "create table users (id int, name text);").CreateStatement)
+	assert.Nil(t, err)
+
+	for _, source := range []string{
+		"insert into users values (1, 'alice');",
+		"insert into users values (2, 'bob');",
+		"insert into users values (3, 'carol');",
+	} {
+		err = mb.Insert(mustParse(t, source).InsertStatement)
+		assert.Nil(t, err, source)
+	}
+	return mb
+}
+
+// 把结果转换成方便比较的字符串
+func resultStrings(results *Results) [][]string {
+	rows := [][]string{}
+	for _, row := range results.Rows {
+		r := []string{}
+		for i, cell := range row {
+			if cell.IsNull() {
+				r = append(r, "NULL")
+				continue
+			}
+			switch results.Columns[i].Type {
+			case IntType:
+				r = append(r, fmt.Sprintf("%d", cell.AsInt()))
+			case TextType:
+				r = append(r, cell.AsText())
+			case BoolType:
+				r = append(r, fmt.Sprintf("%t", cell.AsBool()))
+			}
+		}
+		rows = append(rows, r)
+	}
+	return rows
+}
+
+func TestMemoryBackend_selectWhere(t *testing.T) {
+	mb := newTestBackend(t)
+
+	tests := []struct {
+		source string
+		rows   [][]string
+		err    error
+	}{
+		{
+			source: "select id, name from users;",
+			rows:   [][]string{{"1", "alice"}, {"2", "bob"}, {"3", "carol"}},
+		},
+		{
+			source: "select name from users where id = 2;",
+			rows:   [][]string{{"bob"}},
+		},
+		{
+			source: "select id from users where name <> 'bob';",
+			rows:   [][]string{{"1"}, {"3"}},
+		},
+		{
+			source: "select id from users where name = 'dave';",
+			rows:   [][]string{},
+		},
+		{
+			source: "select id from users where name = 1;",
+			err:    ErrTypeMismatch,
+		},
+		{
+			source: "select id from users where age = 1;",
+			err:    ErrColumnDoesNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		results, err := mb.Select(mustParse(t, test.source).SelectStatement)
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.source)
+			continue
+		}
+		assert.Nil(t, err, test.source)
+		assert.Equal(t, test.rows, resultStrings(results), test.source)
+	}
+}
+
+func TestMemoryBackend_selectExpressions(t *testing.T) {
+	mb := newTestBackend(t)
+
+	tests := []struct {
+		source string
+		rows   [][]string
+		err    error
+	}{
+		{
+			source: "select id * 10 + 1, name = 'bob' from users where id >= 2;",
+			rows:   [][]string{{"21", "true"}, {"31", "false"}},
+		},
+		{
+			source: "select id from users where id > 1 and not name = 'carol' or id = 1;",
+			rows:   [][]string{{"1"}, {"2"}},
+		},
+		{
+			source: "select -id % 2, (id - 1) / 2 from users where name < 'c';",
+			rows:   [][]string{{"-1", "0"}, {"0", "0"}},
+		},
+		{
+			source: "select id from users where id <> 1 and 6 / (id - 1) = 6;",
+			rows:   [][]string{{"2"}},
+		},
+		{
+			source: "select id from users where true;",
+			rows:   [][]string{{"1"}, {"2"}, {"3"}},
+		},
+		{
+			source: "select 2147483647 - id, -2147483647 - 1 from users where id = 1;",
+			rows:   [][]string{{"2147483646", "-2147483648"}},
+		},
+		{
+			// 最小的int可以直接写出来
+			source: "select -2147483648, 2147483647, -2147483648 + id from users where id = 1;",
+			rows:   [][]string{{"-2147483648", "2147483647", "-2147483647"}},
+		},
+		{
+			source: "select id / (id - 1) from users;",
+			err:    ErrDivisionByZero,
+		},
+		{
+			source: "select 2147483648;",
+			err:    ErrOutOfRange,
+		},
+		{
+			source: "select -2147483649;",
+			err:    ErrOutOfRange,
+		},
+		{
+			source: "select -(-2147483648);",
+			err:    ErrOutOfRange,
+		},
+		{
+			source: "select 2147483647 + id from users;",
+			err:    ErrOutOfRange,
+		},
+		{
+			source: "select id - 2147483647 - 3 from users;",
+			err:    ErrOutOfRange,
+		},
+		{
+			source: "select id * 1073741824 from users;",
+			err:    ErrOutOfRange,
+		},
+		{
+			source: "select -(-2147483647 - id) from users;",
+			err:    ErrOutOfRange,
+		},
+		{
+			source: "select (-2147483647 - id) / -1 from users;",
+			err:    ErrOutOfRange,
+		},
+		{
+			source: "select id from users where id;",
+			err:    ErrTypeMismatch,
+		},
+		{
+			source: "select id + name from users;",
+			err:    ErrTypeMismatch,
+		},
+		{
+			source: "select not id from users;",
+			err:    ErrTypeMismatch,
+		},
+		{
+			source: "select id from users where id = 1 and name;",
+			err:    ErrTypeMismatch,
+		},
+	}
+
+	for _, test := range tests {
+		results, err := mb.Select(mustParse(t, test.source).SelectStatement)
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.source)
+			continue
+		}
+		assert.Nil(t, err, test.source)
+		assert.Equal(t, test.rows, resultStrings(results), test.source)
+	}
+}
+
+func TestMemoryBackend_insert(t *testing.T) {
+	mb := newTestBackend(t)
+
+	tests := []struct {
+		source string
+		err    error
+	}{
+		{
+			source: "insert into users values (2 * 2, 'dave');",
+		},
+		{
+			source: "insert into users values ('5', 'erin');",
+			err:    ErrTypeMismatch,
+		},
+		{
+			source: "insert into users values (5);",
+			err:    ErrMissingValue,
+		},
+		{
+			source: "insert into users values (id, 'frank');",
+			err:    ErrColumnDoesNotExist,
+		},
+		{
+			source: "insert into users values (1.5, 'gina');",
+			err:    ErrInvalidDataType,
+		},
+		{
+			source: "insert into nobody values (1, 'x');",
+			err:    ErrTableDoesNotExist,
+		},
+		{
+			source: "insert into users (name, id) values ('hank', 5), ('ivy', 6);",
+		},
+		{
+			// 一行出错的时候其他行也不会插入
+			source: "insert into users values (7, 'jack'), (8, 9);",
+			err:    ErrTypeMismatch,
+		},
+		{
+			source: "insert into users (id) values (1, 'x');",
+			err:    ErrMissingValue,
+		},
+		{
+			source: "insert into users (id, id) values (1, 2);",
+			err:    ErrDuplicateColumn,
+		},
+		{
+			source: "insert into users (age) values (1);",
+			err:    ErrColumnDoesNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		err := mb.Insert(mustParse(t, test.source).InsertStatement)
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.source)
+			continue
+		}
+		assert.Nil(t, err, test.source)
+	}
+
+	results, err := mb.Select(mustParse(t, "select id, name from users where id >= 4;").SelectStatement)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"4", "dave"}, {"5", "hank"}, {"6", "ivy"}}, resultStrings(results))
+}
+
+func TestMemoryBackend_insertColumnsAndSelect(t *testing.T) {
+	mb := newTestBackend(t)
+	err := mb.CreateTable(mustParse(t, "create table archive (id int, name text default 'unknown', active bool);").CreateStatement)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		source string
+		err    error
+	}{
+		{
+			// 没有给出的列用默认值, 没有默认值时是NULL
+			source: "insert into archive (id) values (100);",
+		},
+		{
+			source: "insert into archive (active, id) select id > 1, id from users where id < 3;",
+		},
+		{
+			source: "insert into archive select id + 10, name, true from users order by id desc limit 1;",
+		},
+		{
+			// 先算出查询的结果再插入, 所以可以从同一张表里查
+			source: "insert into archive (id, name) select id + 1000, name from archive where active;",
+		},
+		// false tests
+		{
+			source: "insert into archive (id, name) select id from users;",
+			err:    ErrMissingValue,
+		},
+		{
+			source: "insert into archive (id, name) select name, id from users;",
+			err:    ErrTypeMismatch,
+		},
+		{
+			source: "insert into archive select * from missing;",
+			err:    ErrTableDoesNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		err := mb.Insert(mustParse(t, test.source).InsertStatement)
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.source)
+			continue
+		}
+		assert.Nil(t, err, test.source)
+	}
+
+	results, err := mb.Select(mustParse(t, "select id, name, active from archive;").SelectStatement)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{
+		{"100", "unknown", "NULL"},
+		{"1", "unknown", "false"},
+		{"2", "unknown", "true"},
+		{"13", "carol", "true"},
+		{"1002", "unknown", "NULL"},
+		{"1013", "carol", "NULL"},
+	}, resultStrings(results))
+}
+
+func TestMemoryBackend_update(t *testing.T) {
+	tests := []struct {
+		source   string
+		affected uint
+		rows     [][]string
+		err      error
+	}{
+		{
+			source:   "update users set name = 'bobby' where id = 2;",
+			affected: 1,
+			rows:     [][]string{{"1", "alice"}, {"2", "bobby"}, {"3", "carol"}},
+		},
+		{
+			source:   "update users set id = id * 10;",
+			affected: 3,
+			rows:     [][]string{{"10", "alice"}, {"20", "bob"}, {"30", "carol"}},
+		},
+		{
+			source:   "update users set id = id + 1, name = 'x' where id > 5;",
+			affected: 0,
+			rows:     [][]string{{"1", "alice"}, {"2", "bob"}, {"3", "carol"}},
+		},
+		{
+			source:   "update users set id = 2, name = 'y' where name = 'alice' or id = 3;",
+			affected: 2,
+			rows:     [][]string{{"2", "y"}, {"2", "bob"}, {"2", "y"}},
+		},
+		{
+			source: "update users set id = 'one';",
+			err:    ErrTypeMismatch,
+		},
+		{
+			source: "update users set age = 1;",
+			err:    ErrColumnDoesNotExist,
+		},
+		{
+			source: "update users set id = 1, id = 2;",
+			err:    ErrDuplicateColumn,
+		},
+		{
+			source: "update users set id = 1 where name;",
+			err:    ErrTypeMismatch,
+		},
+		{
+			source: "update users set id = 6 / (id - 2);",
+			err:    ErrDivisionByZero,
+			// 出错的时候不能只修改了一部分行
+			rows: [][]string{{"1", "alice"}, {"2", "bob"}, {"3", "carol"}},
+		},
+		{
+			source: "update nobody set id = 1;",
+			err:    ErrTableDoesNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		mb := newTestBackend(t)
+		affected, err := mb.Update(mustParse(t, test.source).UpdateStatement)
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.source)
+		} else {
+			assert.Nil(t, err, test.source)
+			assert.Equal(t, test.affected, affected, test.source)
+		}
+
+		if test.rows != nil {
+			results, err := mb.Select(mustParse(t, "select id, name from users;").SelectStatement)
+			assert.Nil(t, err, test.source)
+			assert.Equal(t, test.rows, resultStrings(results), test.source)
+		}
+	}
+}
+
+func TestMemoryBackend_delete(t *testing.T) {
+	tests := []struct {
+		source   string
+		affected uint
+		rows     [][]string
+		err      error
+	}{
+		{
+			source:   "delete from users where id = 2;",
+			affected: 1,
+			rows:     [][]string{{"1", "alice"}, {"3", "carol"}},
+		},
+		{
+			source:   "delete from users where name <> 'carol';",
+			affected: 2,
+			rows:     [][]string{{"3", "carol"}},
+		},
+		{
+			source:   "delete from users where id > 3;",
+			affected: 0,
+			rows:     [][]string{{"1", "alice"}, {"2", "bob"}, {"3", "carol"}},
+		},
+		{
+			source:   "delete from users;",
+			affected: 3,
+			rows:     [][]string{},
+		},
+		{
+			source: "delete from users where name;",
+			err:    ErrTypeMismatch,
+		},
+		{
+			source: "delete from users where 6 / (id - 3) > 0;",
+			err:    ErrDivisionByZero,
+			// 出错的时候一行都不能删
+			rows: [][]string{{"1", "alice"}, {"2", "bob"}, {"3", "carol"}},
+		},
+		{
+			source: "delete from nobody;",
+			err:    ErrTableDoesNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		mb := newTestBackend(t)
+		affected, err := mb.Delete(mustParse(t, test.source).DeleteStatement)
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.source)
+		} else {
+			assert.Nil(t, err, test.source)
+			assert.Equal(t, test.affected, affected, test.source)
+		}
+
+		if test.rows != nil {
+			results, err := mb.Select(mustParse(t, "select id, name from users;").SelectStatement)
+			assert.Nil(t, err, test.source)
+			assert.Equal(t, test.rows, resultStrings(results), test.source)
+		}
+	}
+}
+
+func TestMemoryBackend_createAndDropTable(t *testing.T) {
+	mb := newTestBackend(t)
+
+	// 表已经存在
+	err := mb.CreateTable(mustParse(t, "create table users (id int);").CreateStatement)
+	assert.True(t, errors.Is(err, ErrTableAlreadyExists))
+	err = mb.CreateTable(mustParse(t, "create table if not exists users (id int);").CreateStatement)
+	assert.Nil(t, err)
+
+	// IF NOT EXISTS 不能改掉已有的表
+	results, err := mb.Select(mustParse(t, "select id, name from users;").SelectStatement)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(results.Rows))
+
+	// 列名重复或者类型不对的时候不能建表
+	err = mb.CreateTable(mustParse(t, "create table dup (id int, id text);").CreateStatement)
+	assert.True(t, errors.Is(err, ErrDuplicateColumn))
+	err = mb.CreateTable(mustParse(t, "create table bad (id where);").CreateStatement)
+	assert.True(t, errors.Is(err, ErrInvalidDataType))
+	_, err = mb.Select(mustParse(t, "select id from bad;").SelectStatement)
+	assert.True(t, errors.Is(err, ErrTableDoesNotExist))
+
+	// 删除表
+	err = mb.DropTable(mustParse(t, "drop table users;").DropTableStatement)
+	assert.Nil(t, err)
+	_, err = mb.Select(mustParse(t, "select id from users;").SelectStatement)
+	assert.True(t, errors.Is(err, ErrTableDoesNotExist))
+
+	err = mb.DropTable(mustParse(t, "drop table users;").DropTableStatement)
+	assert.True(t, errors.Is(err, ErrTableDoesNotExist))
+	err = mb.DropTable(mustParse(t, "drop table if exists users;").DropTableStatement)
+	assert.Nil(t, err)
+
+	// 删除之后可以重新建同名的表
+	err = mb.CreateTable(mustParse(t, "create table users (id int);").CreateStatement)
+	assert.Nil(t, err)
+}
+
+func TestMemoryBackend_alterTable(t *testing.T) {
+	tests := []struct {
+		sources []string
+		query   string
+		columns []string
+		rows    [][]string
+		err     error
+	}{
+		{
+			sources: []string{"alter table users add column age int default 18;"},
+			query:   "select id, name, age from users;",
+			columns: []string{"id", "name", "age"},
+			rows:    [][]string{{"1", "alice", "18"}, {"2", "bob", "18"}, {"3", "carol", "18"}},
+		},
+		{
+			sources: []string{"alter table users add active bool;"},
+			query:   "select id, active from users where id = 1;",
+			columns: []string{"id", "active"},
+			rows:    [][]string{{"1", "NULL"}},
+		},
+		{
+			sources: []string{
+				"alter table users add column age int default 1 + 1;",
+				"insert into users values (4, 'dave', 40);",
+			},
+			query:   "select id, age from users where id >= 3;",
+			columns: []string{"id", "age"},
+			rows:    [][]string{{"3", "2"}, {"4", "40"}},
+		},
+		{
+			sources: []string{"alter table users drop column id;"},
+			query:   "select name from users;",
+			columns: []string{"name"},
+			rows:    [][]string{{"alice"}, {"bob"}, {"carol"}},
+		},
+		{
+			sources: []string{
+				"alter table users drop id;",
+				"insert into users values ('dave');",
+			},
+			query:   "select name from users where name > 'bob';",
+			columns: []string{"name"},
+			rows:    [][]string{{"carol"}, {"dave"}},
+		},
+		{
+			sources: []string{"alter table users rename column name to username;"},
+			query:   "select username from users where id = 2;",
+			columns: []string{"username"},
+			rows:    [][]string{{"bob"}},
+		},
+		{
+			sources: []string{"alter table users rename to people;"},
+			query:   "select id from people where id = 3;",
+			columns: []string{"id"},
+			rows:    [][]string{{"3"}},
+		},
+		// false tests
+		{
+			sources: []string{"alter table users add column id int;"},
+			err:     ErrDuplicateColumn,
+		},
+		{
+			sources: []string{"alter table users add column age int default 'x';"},
+			err:     ErrTypeMismatch,
+		},
+		{
+			sources: []string{"alter table users add column age int default id;"},
+			err:     ErrColumnDoesNotExist,
+		},
+		{
+			sources: []string{"alter table users drop column age;"},
+			err:     ErrColumnDoesNotExist,
+		},
+		{
+			sources: []string{"alter table users rename column id to name;"},
+			err:     ErrDuplicateColumn,
+		},
+		{
+			sources: []string{
+				"create table people (id int);",
+				"alter table users rename to people;",
+			},
+			err: ErrTableAlreadyExists,
+		},
+		{
+			sources: []string{"alter table nobody drop column id;"},
+			err:     ErrTableDoesNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		mb := newTestBackend(t)
+
+		var err error
+		for _, source := range test.sources {
+			stmt := mustParse(t, source)
+			switch stmt.Kind {
+			case parser.AlterTableKind:
+				err = mb.AlterTable(stmt.AlterTableStatement)
+			case parser.InsertKind:
+				err = mb.Insert(stmt.InsertStatement)
+			case parser.CreateKind:
+				err = mb.CreateTable(stmt.CreateStatement)
+			}
+			if err != nil {
+				break
+			}
+		}
+
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.sources)
+			continue
+		}
+		assert.Nil(t, err, test.sources)
+
+		results, err := mb.Select(mustParse(t, test.query).SelectStatement)
+		assert.Nil(t, err, test.query)
+		columns := []string{}
+		for _, col := range results.Columns {
+			columns = append(columns, col.Name)
+		}
+		assert.Equal(t, test.columns, columns, test.query)
+		assert.Equal(t, test.rows, resultStrings(results), test.query)
+	}
+}
+
+func TestMemoryBackend_constraints(t *testing.T) {
+	setup := []string{
+		"create table products (id int unique not null, sku text not null default 'none', price int check (price >= 0), stock int default 0, constraint cheap check (price < 1000 or stock > 0), unique (sku, stock));",
+		"insert into products values (1, 'a', 10, 5), (2, 'b', null, 0);",
+	}
+
+	tests := []struct {
+		sources []string
+		query   string
+		rows    [][]string
+		err     error
+	}{
+		{
+			// 默认值也要满足约束, CHECK 的条件是NULL时也算满足
+			sources: []string{"insert into products (id, price, stock) values (3, null, 0), (4, 1, 7);"},
+			query:   "select id, sku, price, stock from products where id > 2;",
+			rows:    [][]string{{"3", "none", "NULL", "0"}, {"4", "none", "1", "7"}},
+		},
+		{
+			// 有NULL的行不算重复
+			sources: []string{"insert into products (id, sku, stock) values (3, 'a', null), (4, 'a', null);"},
+			query:   "select count(*) from products where sku = 'a';",
+			rows:    [][]string{{"3"}},
+		},
+		{
+			// 只检查修改之后的结果, 所以修改的过程中暂时重复也没关系
+			sources: []string{"update products set id = 3 - id;"},
+			query:   "select id, sku from products order by id;",
+			rows:    [][]string{{"1", "b"}, {"2", "a"}},
+		},
+		{
+			sources: []string{
+				"alter table products rename column price to cost;",
+				"update products set cost = 5 where id = 2;",
+			},
+			query: "select id, cost from products where cost is not null order by id;",
+			rows:  [][]string{{"1", "10"}, {"2", "5"}},
+		},
+		{
+			// 删除一列时引用了这一列的约束也一起删除
+			sources: []string{
+				"alter table products drop column stock;",
+				"insert into products values (3, 'a', 5000);",
+			},
+			query: "select count(*) from products where sku = 'a';",
+			rows:  [][]string{{"2"}},
+		},
+		{
+			sources: []string{"alter table products add column tag text not null default 'new' unique;"},
+			err:     ErrUniqueViolation,
+		},
+		{
+			sources: []string{"alter table products add column tag text unique check (tag <> '');"},
+			query:   "select id, tag from products;",
+			rows:    [][]string{{"1", "NULL"}, {"2", "NULL"}},
+		},
+		// false tests
+		{
+			sources: []string{"insert into products (sku) values ('c');"},
+			err:     ErrNotNullViolation,
+		},
+		{
+			sources: []string{"insert into products values (3, null, 1, 1);"},
+			err:     ErrNotNullViolation,
+		},
+		{
+			sources: []string{"insert into products (id) values (3), (1);"},
+			err:     ErrUniqueViolation,
+		},
+		{
+			sources: []string{"insert into products (id, sku, stock) values (3, 'c', 1), (4, 'c', 1);"},
+			err:     ErrUniqueViolation,
+		},
+		{
+			sources: []string{"insert into products values (3, 'c', -1, 1);"},
+			err:     ErrCheckViolation,
+		},
+		{
+			sources: []string{"insert into products values (3, 'c', 1000, 0);"},
+			err:     ErrCheckViolation,
+		},
+		{
+			sources: []string{"update products set price = price - 11;"},
+			err:     ErrCheckViolation,
+		},
+		{
+			sources: []string{"update products set sku = null where id = 2;"},
+			err:     ErrNotNullViolation,
+		},
+		{
+			sources: []string{"alter table products add column tag text not null;"},
+			err:     ErrNotNullViolation,
+		},
+		{
+			sources: []string{"create table t (a int check (a));"},
+			err:     ErrTypeMismatch,
+		},
+		{
+			sources: []string{"create table t (a int, unique (a, b));"},
+			err:     ErrColumnDoesNotExist,
+		},
+		{
+			sources: []string{"create table t (a int, unique (a, a));"},
+			err:     ErrDuplicateColumn,
+		},
+		{
+			sources: []string{"create table t (a int constraint c unique, b int constraint c check (b > 0));"},
+			err:     ErrDuplicateConstraint,
+		},
+		{
+			sources: []string{"create table t (a int check (a > count(*)));"},
+			err:     ErrInvalidAggregate,
+		},
+		{
+			sources: []string{"create table t (a int check (a in (select id from products)));"},
+			err:     ErrInvalidOperator,
+		},
+	}
+
+	for _, test := range tests {
+		mb := NewMemoryBackend()
+
+		var err error
+		for _, source := range append(append([]string{}, setup...), test.sources...) {
+			stmt := mustParse(t, source)
+			switch stmt.Kind {
+			case parser.CreateKind:
+				err = mb.CreateTable(stmt.CreateStatement)
+			case parser.AlterTableKind:
+				err = mb.AlterTable(stmt.AlterTableStatement)
+			case parser.InsertKind:
+				err = mb.Insert(stmt.InsertStatement)
+			case parser.UpdateKind:
+				_, err = mb.Update(stmt.UpdateStatement)
+			}
+			if err != nil {
+				break
+			}
+		}
+
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.sources)
+
+			// 违反约束时一行都不修改
+			results, err := mb.Select(mustParse(t, "select count(*) from products;").SelectStatement)
+			assert.Nil(t, err)
+			assert.Equal(t, [][]string{{"2"}}, resultStrings(results), test.sources)
+			continue
+		}
+		assert.Nil(t, err, test.sources)
+
+		results, err := mb.Select(mustParse(t, test.query).SelectStatement)
+		assert.Nil(t, err, test.query)
+		assert.Equal(t, test.rows, resultStrings(results), test.query)
+	}
+
+	// 错误信息里有约束的名字, 没有起名字的约束按 表名_列名_后缀 命名
+	mb := NewMemoryBackend()
+	for _, source := range setup {
+		stmt := mustParse(t, source)
+		if stmt.Kind == parser.CreateKind {
+			assert.Nil(t, mb.CreateTable(stmt.CreateStatement))
+		} else {
+			assert.Nil(t, mb.Insert(stmt.InsertStatement))
+		}
+	}
+	err := mb.Insert(mustParse(t, "insert into products values (1, 'c', 1, 1);").InsertStatement)
+	assert.EqualError(t, err, "duplicate key value violates unique constraint: products_id_key, key (id)=(1) already exists")
+	err = mb.Insert(mustParse(t, "insert into products values (3, 'a', 1, 5);").InsertStatement)
+	assert.EqualError(t, err, "duplicate key value violates unique constraint: products_sku_stock_key, key (sku, stock)=(a, 5) already exists")
+	err = mb.Insert(mustParse(t, "insert into products values (3, 'c', 1000, 0);").InsertStatement)
+	assert.EqualError(t, err, "row violates check constraint: cheap")
+	_, err = mb.Update(mustParse(t, "update products set price = -1;").UpdateStatement)
+	assert.EqualError(t, err, "row violates check constraint: products_price_check")
+}
+
+func TestMemoryBackend_foreignKeys(t *testing.T) {
+	setup := []string{
+		"create table customers (id int primary key, name text);",
+		"create table orders (id int primary key, customer int references customers on delete cascade on update cascade);",
+		"create table items (order_id int references orders, line int, primary key (order_id, line));",
+		"create table employees (id int primary key, manager int, foreign key (manager) references employees (id) on delete set null);",
+		"insert into customers values (1, 'ann'), (2, 'bob');",
+		"insert into orders values (10, 1), (11, 1), (12, 2);",
+		"insert into items values (10, 1), (10, 2);",
+		"insert into employees values (1, null), (2, 1), (3, 2);",
+	}
+	// 出错时所有的表都不会被修改
+	state := "select (select count(*) from customers), (select sum(customer) from orders), (select count(*) from items), (select count(manager) from employees);"
+
+	tests := []struct {
+		sources []string
+		query   string
+		rows    [][]string
+		err     error
+	}{
+		{
+			// 外键的列是NULL时不检查
+			sources: []string{"insert into orders values (13, null), (14, 2);"},
+			query:   "select id, customer from orders where id > 12 order by id;",
+			rows:    [][]string{{"13", "NULL"}, {"14", "2"}},
+		},
+		{
+			sources: []string{"insert into items values (10, 3), (11, 1);"},
+			query:   "select order_id, line from items order by order_id, line;",
+			rows:    [][]string{{"10", "1"}, {"10", "2"}, {"10", "3"}, {"11", "1"}},
+		},
+		{
+			sources: []string{"delete from customers where id = 2;"},
+			query:   "select id, customer from orders order by id;",
+			rows:    [][]string{{"10", "1"}, {"11", "1"}},
+		},
+		{
+			sources: []string{"update customers set id = 3 where id = 1;"},
+			query:   "select id, customer from orders order by id;",
+			rows:    [][]string{{"10", "3"}, {"11", "3"}, {"12", "2"}},
+		},
+		{
+			// 级联修改按语句执行之前引用的行来找, 改成的新值正好是别的行的旧值时不会再被改一次
+			sources: []string{"update customers set id = id + 1;"},
+			query:   "select id, customer from orders order by id;",
+			rows:    [][]string{{"10", "2"}, {"11", "2"}, {"12", "3"}},
+		},
+		{
+			sources: []string{"update customers set id = 3 - id;"},
+			query:   "select id, customer from orders order by id;",
+			rows:    [][]string{{"10", "2"}, {"11", "2"}, {"12", "1"}},
+		},
+		{
+			// 引用自己的外键, 被级联修改过的行再被UPDATE修改时保留级联修改的值
+			sources: []string{
+				"create table e (id int primary key, boss int references e on update cascade);",
+				"insert into e values (1, null), (2, 1), (3, 2);",
+				"update e set id = id + 10;",
+			},
+			query: "select id, boss from e order by id;",
+			rows:  [][]string{{"11", "NULL"}, {"12", "11"}, {"13", "12"}},
+		},
+		{
+			sources: []string{
+				"create table e (id int primary key, boss int references e on update cascade);",
+				"insert into e values (1, 2), (2, 1), (3, 3);",
+				"update e set id = 3 - id where id < 3;",
+			},
+			query: "select id, boss from e order by id;",
+			rows:  [][]string{{"1", "2"}, {"2", "1"}, {"3", "3"}},
+		},
+		{
+			// RESTRICT 在语句执行完之后检查, 引用它的行在同一条语句里也被删除了就没有问题
+			sources: []string{
+				"create table tree (id int primary key, parent int references tree (id));",
+				"insert into tree values (1, null), (2, 1), (3, 2);",
+				"delete from tree where id >= 2;",
+				"delete from tree;",
+			},
+			query: "select count(*) from tree;",
+			rows:  [][]string{{"0"}},
+		},
+		{
+			sources: []string{
+				"create table tree (id int primary key, parent int references tree (id));",
+				"insert into tree values (1, null), (2, 1);",
+				"update tree set id = id + 1, parent = parent + 1;",
+			},
+			query: "select id, parent from tree order by id;",
+			rows:  [][]string{{"2", "NULL"}, {"3", "2"}},
+		},
+		{
+			sources: []string{"delete from employees where id = 1;"},
+			query:   "select id, manager from employees order by id;",
+			rows:    [][]string{{"2", "NULL"}, {"3", "2"}},
+		},
+		{
+			// 引用自己的行可以在同一条语句里插入
+			sources: []string{"insert into employees values (4, 5), (5, 4);"},
+			query:   "select count(*) from employees;",
+			rows:    [][]string{{"5"}},
+		},
+		{
+			sources: []string{
+				"alter table customers rename to clients;",
+				"insert into orders values (13, 2);",
+				"delete from clients where id = 2;",
+			},
+			query: "select id from orders order by id;",
+			rows:  [][]string{{"10"}, {"11"}},
+		},
+		{
+			sources: []string{
+				"delete from items;",
+				"delete from orders where id = 10;",
+				"drop table items;",
+				"drop table orders;",
+				"drop table customers;",
+			},
+			query: "select count(*) from employees;",
+			rows:  [][]string{{"3"}},
+		},
+		{
+			sources: []string{
+				"alter table items drop column order_id;",
+				"alter table orders drop column id;",
+			},
+			query: "select customer from orders order by customer;",
+			rows:  [][]string{{"1"}, {"1"}, {"2"}},
+		},
+		// false tests
+		{
+			sources: []string{"insert into customers values (1, 'cat');"},
+			err:     ErrUniqueViolation,
+		},
+		{
+			sources: []string{"insert into customers (name) values ('cat');"},
+			err:     ErrNotNullViolation,
+		},
+		{
+			sources: []string{"insert into items values (10, 1);"},
+			err:     ErrUniqueViolation,
+		},
+		{
+			sources: []string{"insert into items values (10, null);"},
+			err:     ErrNotNullViolation,
+		},
+		{
+			sources: []string{"insert into orders values (13, 5);"},
+			err:     ErrForeignKeyViolation,
+		},
+		{
+			sources: []string{"update orders set customer = 5 where id = 10;"},
+			err:     ErrForeignKeyViolation,
+		},
+		{
+			// 级联删除的订单还有明细引用它
+			sources: []string{"delete from customers where id = 1;"},
+			err:     ErrForeignKeyViolation,
+		},
+		{
+			sources: []string{"update orders set id = 20 where id = 10;"},
+			err:     ErrForeignKeyViolation,
+		},
+		{
+			sources: []string{
+				"create table tree (id int primary key, parent int references tree (id));",
+				"insert into tree values (1, null), (2, 1);",
+				"delete from tree where id = 1;",
+			},
+			err: ErrForeignKeyViolation,
+		},
+		{
+			// SET NULL 之后违反了NOT NULL
+			sources: []string{
+				"create table t (a int not null references customers on delete set null);",
+				"insert into t values (2);",
+				"delete from customers where id = 2;",
+			},
+			err: ErrNotNullViolation,
+		},
+		{
+			sources: []string{"drop table customers;"},
+			err:     ErrDependentObjects,
+		},
+		{
+			sources: []string{"alter table customers drop column id;"},
+			err:     ErrDependentObjects,
+		},
+		{
+			sources: []string{"create table t (a int primary key, b int primary key);"},
+			err:     ErrDuplicateConstraint,
+		},
+		{
+			sources: []string{"create table t (a text references customers (id));"},
+			err:     ErrTypeMismatch,
+		},
+		{
+			sources: []string{"create table t (a text references customers (name));"},
+			err:     ErrInvalidForeignKey,
+		},
+		{
+			sources: []string{"create table t (a int, b int, foreign key (a, b) references customers);"},
+			err:     ErrInvalidForeignKey,
+		},
+		{
+			sources: []string{"create table t (a int references t);"},
+			err:     ErrInvalidForeignKey,
+		},
+		{
+			sources: []string{"create table t (a int references missing);"},
+			err:     ErrTableDoesNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		mb := NewMemoryBackend()
+		for _, source := range setup {
+			assert.Nil(t, execute(mb, mustParse(t, source)), source)
+		}
+		results, err := mb.Select(mustParse(t, state).SelectStatement)
+		assert.Nil(t, err)
+		before := resultStrings(results)
+
+		for _, source := range test.sources {
+			err = execute(mb, mustParse(t, source))
+			if err != nil {
+				break
+			}
+		}
+
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.sources)
+
+			results, err := mb.Select(mustParse(t, state).SelectStatement)
+			assert.Nil(t, err)
+			assert.Equal(t, before, resultStrings(results), test.sources)
+			continue
+		}
+		assert.Nil(t, err, test.sources)
+
+		results, err = mb.Select(mustParse(t, test.query).SelectStatement)
+		assert.Nil(t, err, test.query)
+		assert.Equal(t, test.rows, resultStrings(results), test.query)
+	}
+
+	// 错误信息里有外键的名字和引用的值
+	mb := NewMemoryBackend()
+	for _, source := range setup {
+		assert.Nil(t, execute(mb, mustParse(t, source)), source)
+	}
+	err := mb.Insert(mustParse(t, "insert into orders values (13, 5);").InsertStatement)
+	assert.EqualError(t, err, "violates foreign key constraint: orders_customer_fkey, key (customer)=(5) is not present in table customers")
+	_, err = mb.Delete(mustParse(t, "delete from orders where id = 10;").DeleteStatement)
+	assert.EqualError(t, err, "violates foreign key constraint: items_order_id_fkey on table items, key (id)=(10) is still referenced")
+	err = mb.Insert(mustParse(t, "insert into customers values (1, 'cat');").InsertStatement)
+	assert.EqualError(t, err, "duplicate key value violates unique constraint: customers_pkey, key (id)=(1) already exists")
+}
+
+func TestMemoryBackend_indexes(t *testing.T) {
+	setup := []string{
+		"create table scores (id int primary key, name text, score int);",
+		"insert into scores values (1, 'ann', 70), (2, 'bob', null), (3, 'cat', 85), (4, 'ann', 90), (5, 'dan', 70), (6, 'eve', 60);",
+	}
+	indexes := []string{
+		"create index scores_score on scores (score);",
+		"create unique index scores_name_score on scores (name, score);",
+	}
+	queries := []string{
+		"select id from scores where score = 70;",
+		"select id from scores where 70 = score and id > 1;",
+		"select id from scores where score > 70;",
+		"select id from scores where score >= 70 and score < 90;",
+		"select id from scores where score <= 70;",
+		"select id from scores where score = null;",
+		"select id from scores where score is null;",
+		"select id from scores where name = 'ann';",
+		"select id from scores where name = 'ann' and score > 80;",
+		"select id from scores where name = 'ann' and score = 90;",
+		"select id from scores where name > 'bob' and name <= 'dan';",
+		"select count(*), max(score) from scores where score > 60 - 1;",
+		"select a.id, b.id from scores a join scores b on a.score = b.score where a.score < 80 and b.name = 'dan';",
+		"select a.id, b.id from scores a left join scores b on a.id = b.id + 1 where b.score > 80;",
+	}
+
+	// 同一个查询不管有没有索引, 表被修改之后结果都应该一样
+	steps := [][]string{
+		{},
+		{"insert into scores values (7, 'fay', 70), (8, 'ann', 75), (9, 'gus', null);"},
+		{"update scores set score = score + 5 where score < 80;"},
+		{"delete from scores where score = 75 or name = 'bob';"},
+		{"update scores set name = 'ann', score = 50 where id = 9;"},
+		{"alter table scores add column note text default 'x';", "delete from scores where id = 1;"},
+		{"alter table scores drop column note;", "insert into scores values (10, 'ann', 60);"},
+	}
+
+	plain := NewMemoryBackend()
+	indexed := NewMemoryBackend()
+	for _, source := range setup {
+		assert.Nil(t, execute(plain, mustParse(t, source)), source)
+		assert.Nil(t, execute(indexed, mustParse(t, source)), source)
+	}
+	for _, source := range indexes {
+		err := indexed.CreateIndex(mustParse(t, source).CreateIndexStatement)
+		assert.Nil(t, err, source)
+	}
+	for _, step := range steps {
+		for _, source := range step {
+			assert.Nil(t, execute(plain, mustParse(t, source)), source)
+			assert.Nil(t, execute(indexed, mustParse(t, source)), source)
+		}
+		for _, query := range queries {
+			expected, err := plain.Select(mustParse(t, query).SelectStatement)
+			assert.Nil(t, err, query)
+			results, err := indexed.Select(mustParse(t, query).SelectStatement)
+			assert.Nil(t, err, query)
+			assert.Equal(t, resultStrings(expected), resultStrings(results), step, query)
+		}
+	}
+
+	// 选择能用上最多条件的索引, 补NULL的一边不用索引
+	plans := []struct {
+		source string
+		plan   []string
+	}{
+		{
+			source: "explain select id from scores where score = 70;",
+			plan: []string{
+				"Filter: score = 70",
+				"  -> Index Scan using scores_score on scores: score = 70",
+			},
+		},
+		{
+			source: "explain select id from scores s where s.score > 60 and id < 3 and s.score <= 2 * 40;",
+			plan: []string{
+				"Filter: s.score > 60 and id < 3 and s.score <= 80",
+				"  -> Index Scan using scores_score on scores s: s.score > 60 and s.score <= 80",
+			},
+		},
+		{
+			source: "explain select id from scores where score = 70 and name = 'ann';",
+			plan: []string{
+				"Filter: score = 70 and name = 'ann'",
+				"  -> Index Scan using scores_name_score on scores: name = 'ann' and score = 70",
+			},
+		},
+		{
+			source: "explain select id from scores where name = 'ann' or score = 70;",
+			plan: []string{
+				"Filter: name = 'ann' or score = 70",
+				"  -> Seq Scan on scores",
+			},
+		},
+		{
+			source: "explain select id from scores where score = null;",
+			plan: []string{
+				"Filter: score = null",
+				"  -> Seq Scan on scores",
+			},
+		},
+		{
+			source: "explain select a.id from scores a left join scores b on a.id = b.id where a.score = 1 and b.score = 1;",
+			plan: []string{
+				"Filter: b.score = 1",
+				"  -> Hash Join (left) on a.id = b.id",
+				"       -> Filter: a.score = 1",
+				"            -> Index Scan using scores_score on scores a: a.score = 1",
+				"       -> Seq Scan on scores b",
+			},
+		},
+	}
+	for _, test := range plans {
+		results, err := indexed.Explain(mustParse(t, test.source).ExplainStatement)
+		assert.Nil(t, err, test.source)
+
+		plan := []string{}
+		for _, row := range results.Rows {
+			plan = append(plan, row[0].AsText())
+		}
+		assert.Equal(t, test.plan, plan, test.source)
+	}
+
+	tests := []struct {
+		sources []string
+		query   string
+		rows    [][]string
+		err     error
+	}{
+		{
+			// 有NULL的行不算重复
+			sources: []string{"insert into scores values (7, 'bob', null);"},
+			query:   "select count(*) from scores where name = 'bob';",
+			rows:    [][]string{{"2"}},
+		},
+		{
+			sources: []string{
+				"drop index scores_name_score;",
+				"insert into scores values (7, 'ann', 70);",
+				"drop index if exists scores_name_score;",
+			},
+			query: "select id from scores where name = 'ann' and score = 70;",
+			rows:  [][]string{{"1"}, {"7"}},
+		},
+		{
+			// 删除一列时包含这一列的索引也一起删除
+			sources: []string{
+				"alter table scores drop column name;",
+				"create index scores_name_score on scores (id, score);",
+			},
+			query: "select id from scores where id = 3 and score = 85;",
+			rows:  [][]string{{"3"}},
+		},
+		{
+			sources: []string{"create index if not exists scores_score on scores (id);"},
+			query:   "select id from scores where score = 60;",
+			rows:    [][]string{{"6"}},
+		},
+		// false tests
+		{
+			sources: []string{"insert into scores values (7, 'ann', 70);"},
+			err:     ErrUniqueViolation,
+		},
+		{
+			sources: []string{"update scores set score = 70 where id = 4;"},
+			err:     ErrUniqueViolation,
+		},
+		{
+			sources: []string{"create unique index scores_unique_score on scores (score);"},
+			err:     ErrUniqueViolation,
+		},
+		{
+			sources: []string{"create index scores_score on scores (id);"},
+			err:     ErrIndexAlreadyExists,
+		},
+		{
+			sources: []string{"create index i on scores (grade);"},
+			err:     ErrColumnDoesNotExist,
+		},
+		{
+			sources: []string{"create index i on scores (id, id);"},
+			err:     ErrDuplicateColumn,
+		},
+		{
+			sources: []string{"create index i on missing (id);"},
+			err:     ErrTableDoesNotExist,
+		},
+		{
+			sources: []string{"drop index missing;"},
+			err:     ErrIndexDoesNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		mb := NewMemoryBackend()
+		for _, source := range append(append([]string{}, setup...), indexes...) {
+			assert.Nil(t, execute(mb, mustParse(t, source)), source)
+		}
+
+		var err error
+		for _, source := range test.sources {
+			err = execute(mb, mustParse(t, source))
+			if err != nil {
+				break
+			}
+		}
+
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.sources)
+			continue
+		}
+		assert.Nil(t, err, test.sources)
+
+		results, err := mb.Select(mustParse(t, test.query).SelectStatement)
+		assert.Nil(t, err, test.query)
+		assert.Equal(t, test.rows, resultStrings(results), test.query)
+	}
+
+	mb := NewMemoryBackend()
+	for _, source := range append(append([]string{}, setup...), indexes...) {
+		assert.Nil(t, execute(mb, mustParse(t, source)), source)
+	}
+	err := mb.Insert(mustParse(t, "insert into scores values (7, 'ann', 70);").InsertStatement)
+	assert.EqualError(t, err, "duplicate key value violates unique constraint: scores_name_score, key (name, score)=(ann, 70) already exists")
+}
+
+func TestMemoryBackend_hashIndexes(t *testing.T) {
+	setup := []string{
+		"create table sessions (token text, uid int, active bool);",
+		"create table events (id int, token text, kind text);",
+		"insert into sessions values ('s1', 1, true), ('s2', 2, false), (null, 3, true), ('s4', 1, true);",
+		"insert into events values (10, 's2', 'login'), (11, 's1', 'view'), (12, 's9', 'view'), (13, null, 'login'), (14, 's1', 'logout');",
+	}
+	indexes := []string{
+		"create index sessions_token on sessions using hash (token);",
+		"create index sessions_uid_active on sessions using hash (uid, active);",
+	}
+	queries := []string{
+		"select uid from sessions where token = 's1';",
+		"select uid from sessions where 's4' = token;",
+		"select uid from sessions where token = null;",
+		"select token from sessions where uid = 1 and active = true;",
+		"select token from sessions where uid = 1;",
+		"select e.id, s.uid from events e join sessions s on s.token = e.token;",
+		"select e.id, s.uid from events e left join sessions s on e.token = s.token and s.active;",
+		"select e.id, s.uid from events e right join sessions s on e.token = s.token;",
+		"select e.id, s.uid from events e full join sessions s on e.token = s.token where e.kind = 'view' or e.kind is null;",
+		"select e.id, s.token from events e join sessions s on s.uid = e.id - 10 and s.active = (e.kind = 'view');",
+	}
+
+	// 同一个查询不管有没有索引, 表被修改之后结果都应该一样
+	steps := [][]string{
+		{},
+		{"insert into sessions values ('s5', 4, true), ('s1', 5, false);"},
+		{"update sessions set token = 's9' where uid = 3;"},
+		{"delete from sessions where token = 's1' and active = false;", "update sessions set active = not active;"},
+		{"delete from sessions where uid < 2;", "insert into sessions values ('s2', 1, true);"},
+	}
+
+	plain := NewMemoryBackend()
+	indexed := NewMemoryBackend()
+	for _, source := range setup {
+		assert.Nil(t, execute(plain, mustParse(t, source)), source)
+		assert.Nil(t, execute(indexed, mustParse(t, source)), source)
+	}
+	for _, source := range indexes {
+		assert.Nil(t, execute(indexed, mustParse(t, source)), source)
+	}
+	for _, step := range steps {
+		for _, source := range step {
+			assert.Nil(t, execute(plain, mustParse(t, source)), source)
+			assert.Nil(t, execute(indexed, mustParse(t, source)), source)
+		}
+		for _, query := range queries {
+			expected, err := plain.Select(mustParse(t, query).SelectStatement)
+			assert.Nil(t, err, query)
+			results, err := indexed.Select(mustParse(t, query).SelectStatement)
+			assert.Nil(t, err, query)
+			assert.Equal(t, resultStrings(expected), resultStrings(results), step, query)
+		}
+	}
+
+	// 哈希索引只能用于所有的列都是等值条件的时候
+	assert.Nil(t, execute(indexed, mustParse(t, "create index sessions_uid on sessions (uid);")))
+	plans := []struct {
+		source string
+		plan   []string
+	}{
+		{
+			source: "explain select uid from sessions where token = 's1';",
+			plan: []string{
+				"Filter: token = 's1'",
+				"  -> Index Scan using sessions_token on sessions: token = 's1'",
+			},
+		},
+		{
+			source: "explain select token from sessions where uid = 1;",
+			plan: []string{
+				"Filter: uid = 1",
+				"  -> Index Scan using sessions_uid on sessions: uid = 1",
+			},
+		},
+		{
+			source: "explain select token from sessions where active = true and uid = 1;",
+			plan: []string{
+				"Filter: active = true and uid = 1",
+				"  -> Index Scan using sessions_uid_active on sessions: uid = 1 and active = true",
+			},
+		},
+		{
+			source: "explain select uid from sessions where token > 's1';",
+			plan: []string{
+				"Filter: token > 's1'",
+				"  -> Seq Scan on sessions",
+			},
+		},
+		{
+			source: "explain select e.id from events e join sessions s on e.token = s.token where s.token = 's1';",
+			plan: []string{
+				"Index Join (inner) using sessions_token on e.token = s.token",
+				"  -> Seq Scan on events e",
+				"  -> Filter: s.token = 's1'",
+				"       -> Seq Scan on sessions s",
+			},
+		},
+		{
+			source: "explain select e.id from sessions s join events e on e.token = s.token;",
+			plan: []string{
+				"Hash Join (inner) on e.token = s.token",
+				"  -> Seq Scan on sessions s",
+				"  -> Seq Scan on events e",
+			},
+		},
+	}
+	for _, test := range plans {
+		results, err := indexed.Explain(mustParse(t, test.source).ExplainStatement)
+		assert.Nil(t, err, test.source)
+
+		plan := []string{}
+		for _, row := range results.Rows {
+			plan = append(plan, row[0].AsText())
+		}
+		assert.Equal(t, test.plan, plan, test.source)
+	}
+
+	// 唯一的哈希索引
+	mb := NewMemoryBackend()
+	for _, source := range setup {
+		assert.Nil(t, execute(mb, mustParse(t, source)), source)
+	}
+	err := mb.CreateIndex(mustParse(t, "create unique index events_token on events using hash (token);").CreateIndexStatement)
+	assert.True(t, errors.Is(err, ErrUniqueViolation))
+	err = mb.CreateIndex(mustParse(t, "create unique index sessions_token on sessions using hash (token);").CreateIndexStatement)
+	assert.Nil(t, err)
+	err = mb.Insert(mustParse(t, "insert into sessions values ('s1', 9, true);").InsertStatement)
+	assert.True(t, errors.Is(err, ErrUniqueViolation))
+	err = mb.Insert(mustParse(t, "insert into sessions values (null, 9, true);").InsertStatement)
+	assert.Nil(t, err)
+}
+
+func TestMemoryBackend_selectOrderBy(t *testing.T) {
+	mb := newTestBackend(t)
+	for _, source := range []string{
+		"insert into users values (4, 'bob');",
+		"insert into users values (0, 'dave');",
+	} {
+		err := mb.Insert(mustParse(t, source).InsertStatement)
+		assert.Nil(t, err, source)
+	}
+
+	tests := []struct {
+		source string
+		rows   [][]string
+		err    error
+	}{
+		{
+			source: "select id from users order by id;",
+			rows:   [][]string{{"0"}, {"1"}, {"2"}, {"3"}, {"4"}},
+		},
+		{
+			source: "select id from users order by id desc;",
+			rows:   [][]string{{"4"}, {"3"}, {"2"}, {"1"}, {"0"}},
+		},
+		{
+			source: "select name, id from users order by name, id desc;",
+			rows:   [][]string{{"alice", "1"}, {"bob", "4"}, {"bob", "2"}, {"carol", "3"}, {"dave", "0"}},
+		},
+		{
+			source: "select name, id from users where id > 0 order by name desc nulls first, id asc nulls last;",
+			rows:   [][]string{{"carol", "3"}, {"bob", "2"}, {"bob", "4"}, {"alice", "1"}},
+		},
+		{
+			// 排序键不一定要出现在结果里, 相同的键保持插入顺序
+			source: "select id from users order by name = 'bob', id % 2;",
+			rows:   [][]string{{"0"}, {"1"}, {"3"}, {"2"}, {"4"}},
+		},
+		{
+			// 整数是SELECT的第几列, * 展开之后算
+			source: "select name, id from users order by 1, 2 desc;",
+			rows:   [][]string{{"alice", "1"}, {"bob", "4"}, {"bob", "2"}, {"carol", "3"}, {"dave", "0"}},
+		},
+		{
+			source: "select * from users where id > 0 order by 2 desc, 1;",
+			rows:   [][]string{{"3", "carol"}, {"2", "bob"}, {"4", "bob"}, {"1", "alice"}},
+		},
+		{
+			source: "select id from users union select 5 order by 1 desc;",
+			rows:   [][]string{{"5"}, {"4"}, {"3"}, {"2"}, {"1"}, {"0"}},
+		},
+		{
+			source: "select id from users order by age;",
+			err:    ErrColumnDoesNotExist,
+		},
+		{
+			source: "select name, id from users order by 3;",
+			err:    ErrInvalidOrderBy,
+		},
+		{
+			source: "select name from users order by 0;",
+			err:    ErrInvalidOrderBy,
+		},
+		{
+			source: "select id from users union select 5 order by 2;",
+			err:    ErrInvalidOrderBy,
+		},
+		{
+			source: "select id from users order by name + 1;",
+			err:    ErrTypeMismatch,
+		},
+	}
+
+	for _, test := range tests {
+		results, err := mb.Select(mustParse(t, test.source).SelectStatement)
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.source)
+			continue
+		}
+		assert.Nil(t, err, test.source)
+		assert.Equal(t, test.rows, resultStrings(results), test.source)
+	}
+}
+
+func TestMemoryBackend_selectLimitOffset(t *testing.T) {
+	mb := newTestBackend(t)
+
+	tests := []struct {
+		source string
+		rows   [][]string
+		err    error
+	}{
+		{
+			source: "select id from users limit 2;",
+			rows:   [][]string{{"1"}, {"2"}},
+		},
+		{
+			source: "select id from users limit 2 offset 2;",
+			rows:   [][]string{{"3"}},
+		},
+		{
+			source: "select id from users offset 1;",
+			rows:   [][]string{{"2"}, {"3"}},
+		},
+		{
+			source: "select id from users limit 0;",
+			rows:   [][]string{},
+		},
+		{
+			source: "select id from users where id <> 1 limit 1 offset 1;",
+			rows:   [][]string{{"3"}},
+		},
+		{
+			source: "select id from users order by id desc limit 1 + 1;",
+			rows:   [][]string{{"3"}, {"2"}},
+		},
+		{
+			source: "select id from users order by id desc limit 5 offset 2;",
+			rows:   [][]string{{"1"}},
+		},
+		{
+			// 拿到足够的行之后就不再扫描, 所以第三行的除零不会被执行到
+			source: "select 6 / (3 - id) from users limit 2;",
+			rows:   [][]string{{"3"}, {"6"}},
+		},
+		{
+			// WHERE 里的条件也是一行一行地检查
+			source: "select id from users where 6 / (3 - id) > 0 limit 2;",
+			rows:   [][]string{{"1"}, {"2"}},
+		},
+		{
+			// 有ORDER BY的时候必须扫描所有的行
+			source: "select 6 / (3 - id) from users order by id limit 2;",
+			err:    ErrDivisionByZero,
+		},
+		{
+			source: "select id from users limit 'a';",
+			err:    ErrInvalidLimit,
+		},
+		{
+			source: "select id from users limit 1 offset -1;",
+			err:    ErrInvalidLimit,
+		},
+		{
+			source: "select id from users limit id;",
+			err:    ErrColumnDoesNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		results, err := mb.Select(mustParse(t, test.source).SelectStatement)
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.source)
+			continue
+		}
+		assert.Nil(t, err, test.source)
+		assert.Equal(t, test.rows, resultStrings(results), test.source)
+	}
+}
+
+func TestMemoryBackend_selectAggregate(t *testing.T) {
+	mb := NewMemoryBackend()
+	for _, source := range []string{
+		"create table sales (region text, amount int, paid bool);",
+		"insert into sales values ('east', 10, true);",
+		"insert into sales values ('west', 20, false);",
+		"insert into sales values ('east', 30, true);",
+		"insert into sales values ('north', 5, true);",
+		"insert into sales values ('west', 25, true);",
+		"create table empty (a int);",
+		"create table big (a int);",
+		"insert into big values (2147483647);",
+		"insert into big values (1);",
+		"insert into big values (-5);",
+	} {
+		stmt := mustParse(t, source)
+		var err error
+		switch stmt.Kind {
+		case parser.CreateKind:
+			err = mb.CreateTable(stmt.CreateStatement)
+		case parser.InsertKind:
+			err = mb.Insert(stmt.InsertStatement)
+		}
+		assert.Nil(t, err, source)
+	}
+
+	tests := []struct {
+		source  string
+		columns []string
+		rows    [][]string
+		err     error
+	}{
+		{
+			source:  "select count(*), count(amount), sum(amount), avg(amount), min(amount), max(region) from sales;",
+			columns: []string{"count", "count", "sum", "avg", "min", "max"},
+			rows:    [][]string{{"5", "5", "90", "18", "5", "west"}},
+		},
+		{
+			source:  "select region, count(*), sum(amount) from sales group by region;",
+			columns: []string{"region", "count", "sum"},
+			rows:    [][]string{{"east", "2", "40"}, {"west", "2", "45"}, {"north", "1", "5"}},
+		},
+		{
+			source: "select region, sum(amount) from sales where paid group by region having sum(amount) > 5 order by sum(amount) desc;",
+			rows:   [][]string{{"east", "40"}, {"west", "25"}},
+		},
+		{
+			source: "select paid, count(*) * 10, max(amount) - min(amount) from sales group by paid order by paid;",
+			rows:   [][]string{{"false", "10", "0"}, {"true", "40", "25"}},
+		},
+		{
+			source: "select amount > 15, count(*) from sales group by amount > 15 order by count(*);",
+			rows:   [][]string{{"false", "2"}, {"true", "3"}},
+		},
+		{
+			source: "select region from sales group by region order by region limit 2;",
+			rows:   [][]string{{"east"}, {"north"}},
+		},
+		{
+			source: "select count(*) from sales having count(*) > 10;",
+			rows:   [][]string{},
+		},
+		{
+			// 没有GROUP BY的时候, 空表也会返回一行
+			source: "select count(*), sum(a), max(a) from empty;",
+			rows:   [][]string{{"0", "NULL", "NULL"}},
+		},
+		{
+			source: "select a, count(*) from empty group by a;",
+			rows:   [][]string{},
+		},
+		{
+			// 中间的和超出了int的范围, 最后的结果没有超出时没关系
+			source: "select sum(a), avg(a) from big;",
+			rows:   [][]string{{"2147483643", "715827881"}},
+		},
+		// false tests
+		{
+			source: "select sum(a) from big where a > 0;",
+			err:    ErrOutOfRange,
+		},
+		{
+			source: "select region, count(*) from sales;",
+			err:    ErrNotGrouped,
+		},
+		{
+			source: "select amount from sales group by region;",
+			err:    ErrNotGrouped,
+		},
+		{
+			source: "select region from sales group by region order by amount;",
+			err:    ErrNotGrouped,
+		},
+		{
+			source: "select region from sales where count(*) > 1 group by region;",
+			err:    ErrInvalidAggregate,
+		},
+		{
+			source: "select sum(count(*)) from sales;",
+			err:    ErrInvalidAggregate,
+		},
+		{
+			source: "select sum(region) from sales;",
+			err:    ErrTypeMismatch,
+		},
+		{
+			source: "select sum(*) from sales;",
+			err:    ErrInvalidAggregate,
+		},
+		{
+			source: "select max(amount, paid) from sales;",
+			err:    ErrInvalidAggregate,
+		},
+		{
+			source: "select median(amount) from sales;",
+			err:    ErrFunctionDoesNotExist,
+		},
+		{
+			source: "select region from sales group by region having sum(amount);",
+			err:    ErrTypeMismatch,
+		},
+	}
+
+	for _, test := range tests {
+		results, err := mb.Select(mustParse(t, test.source).SelectStatement)
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.source)
+			continue
+		}
+		assert.Nil(t, err, test.source)
+		assert.Equal(t, test.rows, resultStrings(results), test.source)
+
+		if test.columns != nil {
+			columns := []string{}
+			for _, col := range results.Columns {
+				columns = append(columns, col.Name)
+			}
+			assert.Equal(t, test.columns, columns, test.source)
+		}
+	}
+}
+
+// 在users表之外再建一张orders表, 用来测试连接
+// carol没有订单, 订单13的用户不存在
+func newJoinTestBackend(t *testing.T) *MemoryBackend {
+	mb := newTestBackend(t)
+	err := mb.CreateTable(mustParse(t, "create table orders (id int, uid int, total int);").CreateStatement)
+	assert.Nil(t, err)
+
+	for _, source := range []string{
+		"insert into orders values (10, 1, 100);",
+		"insert into orders values (11, 1, 50);",
+		"insert into orders values (12, 2, 70);",
+		"insert into orders values (13, 4, 30);",
+	} {
+		err = mb.Insert(mustParse(t, source).InsertStatement)
+		assert.Nil(t, err, source)
+	}
+	return mb
+}
+
+func TestMemoryBackend_selectJoin(t *testing.T) {
+	mb := newJoinTestBackend(t)
+
+	tests := []struct {
+		source string
+		rows   [][]string
+		err    error
+	}{
+		{
+			source: "select name, total from users join orders on users.id = orders.uid;",
+			rows:   [][]string{{"alice", "100"}, {"alice", "50"}, {"bob", "70"}},
+		},
+		{
+			source: "select u.name, o.id from users u inner join orders as o on u.id = o.uid where o.total > 60;",
+			rows:   [][]string{{"alice", "10"}, {"bob", "12"}},
+		},
+		{
+			source: "select u.name, o.id from users u, orders o where u.id = o.uid and u.name = 'bob';",
+			rows:   [][]string{{"bob", "12"}},
+		},
+		{
+			// 还没有NULL, 没有匹配上的一边是零值
+			source: "select u.name, o.id from users u left join orders o on u.id = o.uid;",
+			rows:   [][]string{{"alice", "10"}, {"alice", "11"}, {"bob", "12"}, {"carol", "NULL"}},
+		},
+		{
+			source: "select u.name, o.id from users u right outer join orders o on u.id = o.uid;",
+			rows:   [][]string{{"alice", "10"}, {"alice", "11"}, {"bob", "12"}, {"NULL", "13"}},
+		},
+		{
+			source: "select u.id, o.id from users u full join orders o on u.id = o.uid order by o.id;",
+			rows:   [][]string{{"1", "10"}, {"1", "11"}, {"2", "12"}, {"NULL", "13"}, {"3", "NULL"}},
+		},
+		{
+			source: "select count(*) from users cross join orders;",
+			rows:   [][]string{{"12"}},
+		},
+		{
+			source: "select a.name, b.name from users a join users b on a.id + 1 = b.id;",
+			rows:   [][]string{{"alice", "bob"}, {"bob", "carol"}},
+		},
+		{
+			source: "select a.id, b.id, c.id from users a join users b on a.id < b.id join users c on b.id < c.id;",
+			rows:   [][]string{{"1", "2", "3"}},
+		},
+		{
+			source: "select u.name, sum(o.total) from users u join orders o on u.id = o.uid group by u.name order by sum(total);",
+			rows:   [][]string{{"bob", "70"}, {"alice", "150"}},
+		},
+		{
+			source: "select name, count(*) from users u left join orders o on u.id = o.uid group by u.name order by name;",
+			rows:   [][]string{{"alice", "2"}, {"bob", "1"}, {"carol", "1"}},
+		},
+		{
+			source: "select users.name from users where users.id = 1;",
+			rows:   [][]string{{"alice"}},
+		},
+		// false tests
+		{
+			source: "select id from users join orders on users.id = orders.uid;",
+			err:    ErrAmbiguousColumn,
+		},
+		{
+			source: "select users.name from users u;",
+			err:    ErrColumnDoesNotExist,
+		},
+		{
+			source: "select u.total from users u join orders o on u.id = o.uid;",
+			err:    ErrColumnDoesNotExist,
+		},
+		{
+			source: "select name from users join users on true;",
+			err:    ErrDuplicateTableName,
+		},
+		{
+			source: "select name from users u, orders u;",
+			err:    ErrDuplicateTableName,
+		},
+		{
+			source: "select name from users join missing on true;",
+			err:    ErrTableDoesNotExist,
+		},
+		{
+			source: "select name from users u join orders o on u.id;",
+			err:    ErrTypeMismatch,
+		},
+		{
+			source: "select name from users u join orders o on u.name = o.uid;",
+			err:    ErrTypeMismatch,
+		},
+		{
+			source: "select name from users u join orders o on count(*) > 1;",
+			err:    ErrInvalidAggregate,
+		},
+	}
+
+	for _, test := range tests {
+		results, err := mb.Select(mustParse(t, test.source).SelectStatement)
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.source)
+			continue
+		}
+		assert.Nil(t, err, test.source)
+		assert.Equal(t, test.rows, resultStrings(results), test.source)
+	}
+}
+
+func TestMemoryBackend_updateDeleteQualified(t *testing.T) {
+	mb := newTestBackend(t)
+
+	affected, err := mb.Update(mustParse(t, "update users set name = 'bobby' where users.id = 2;").UpdateStatement)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1), affected)
+
+	affected, err = mb.Delete(mustParse(t, "delete from users where users.name = 'bobby';").DeleteStatement)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1), affected)
+
+	_, err = mb.Delete(mustParse(t, "delete from users where u.id = 1;").DeleteStatement)
+	assert.True(t, errors.Is(err, ErrColumnDoesNotExist))
+}
+
+func TestMemoryBackend_explainJoin(t *testing.T) {
+	mb := newJoinTestBackend(t)
+
+	tests := []struct {
+		source string
+		plan   []string
+		err    error
+	}{
+		{
+			source: "explain select name from users;",
+			plan:   []string{"Seq Scan on users"},
+		},
+		{
+			// users.id 和 orders.uid 都是按插入顺序升序排好的
+			source: "explain select name, total from users join orders on users.id = orders.uid;",
+			plan: []string{
+				"Hash Join (inner) on users.id = orders.uid",
+				"  -> Seq Scan on users",
+				"  -> Seq Scan on orders",
+			},
+		},
+		{
+			source: "explain select u.name from users u left join orders o on o.total = u.id * 10 and o.id > 10;",
+			plan: []string{
+				"Hash Join (left) on o.total = u.id * 10",
+				"  -> Seq Scan on users u",
+				"  -> Filter: o.id > 10",
+				"       -> Seq Scan on orders o",
+			},
+		},
+		{
+			source: "explain select u.name from users u join orders o on u.id < o.uid;",
+			plan: []string{
+				"Nested Loop (inner) on u.id < o.uid",
+				"  -> Seq Scan on users u",
+				"  -> Seq Scan on orders o",
+			},
+		},
+		{
+			source: "explain select a.id from users a, users b join orders o on b.id = o.uid where a.id = o.uid;",
+			plan: []string{
+				"Hash Join (inner) on a.id = o.uid",
+				"  -> Seq Scan on users a",
+				"  -> Hash Join (inner) on b.id = o.uid",
+				"       -> Seq Scan on users b",
+				"       -> Seq Scan on orders o",
+			},
+		},
+		{
+			source: "explain select u.name, count(*) from users u join orders o on u.id = o.uid group by u.name having count(*) > 1 order by u.name desc limit 1 + 1 offset 1;",
+			plan: []string{
+				"Limit 2 offset 1",
+				"  -> Sort: u.name desc",
+				"       -> Filter: count(*) > 1",
+				"            -> Hash Aggregate: group by u.name",
+				"                 -> Hash Join (inner) on u.id = o.uid",
+				"                      -> Seq Scan on users u",
+				"                      -> Seq Scan on orders o",
+			},
+		},
+		// false tests
+		{
+			source: "explain select name from missing;",
+			err:    ErrTableDoesNotExist,
+		},
+		{
+			source: "explain select name from users u join orders o on u.name = o.id;",
+			err:    ErrTypeMismatch,
+		},
+	}
+
+	for _, test := range tests {
+		results, err := mb.Explain(mustParse(t, test.source).ExplainStatement)
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.source)
+			continue
+		}
+		assert.Nil(t, err, test.source)
+
+		plan := []string{}
+		for _, row := range results.Rows {
+			plan = append(plan, row[0].AsText())
+		}
+		assert.Equal(t, test.plan, plan, test.source)
+	}
+}
+
+func TestMemoryBackend_joinStrategies(t *testing.T) {
+	mb := newJoinTestBackend(t)
+
+	// 同一个连接不管用哪种方式执行, 结果都应该一样
+	queries := []struct {
+		source string
+		rows   [][]string
+	}{
+		{
+			source: "select a.id, b.id from orders a join orders b on a.uid = b.uid order by a.id, b.id;",
+			rows:   [][]string{{"10", "10"}, {"10", "11"}, {"11", "10"}, {"11", "11"}, {"12", "12"}, {"13", "13"}},
+		},
+		{
+			source: "select u.name, o.id from users u full join orders o on u.id = o.uid and o.total > 60 order by o.id;",
+			rows:   [][]string{{"alice", "10"}, {"NULL", "11"}, {"bob", "12"}, {"NULL", "13"}, {"carol", "NULL"}},
+		},
+		{
+			source: "select u.name, o.id from users u right join orders o on o.uid = u.id order by o.id;",
+			rows:   [][]string{{"alice", "10"}, {"alice", "11"}, {"bob", "12"}, {"NULL", "13"}},
+		},
+	}
+
+	// 两边都有连接的列上的有序索引时, 按索引的顺序扫描两张表, 用归并连接
+	// 删掉索引之后, 不知道输入是否有序, 就只能用哈希连接了
+	strategies := []struct {
+		sources  []string
+		strategy string
+	}{
+		{
+			sources:  []string{"create index users_id on users (id);", "create index orders_uid on orders (uid);"},
+			strategy: "Merge Join",
+		},
+		{
+			sources:  []string{"drop index users_id;", "drop index orders_uid;"},
+			strategy: "Hash Join",
+		},
+	}
+	for _, test := range strategies {
+		for _, source := range test.sources {
+			assert.Nil(t, execute(mb, mustParse(t, source)), source)
+		}
+		for _, query := range queries {
+			explain, err := mb.Explain(mustParse(t, "explain "+query.source).ExplainStatement)
+			assert.Nil(t, err, query.source)
+			assert.Contains(t, explain.Rows[1][0].AsText(), test.strategy, query.source)
+
+			results, err := mb.Select(mustParse(t, query.source).SelectStatement)
+			assert.Nil(t, err, query.source)
+			assert.Equal(t, query.rows, resultStrings(results), query.source)
+		}
+	}
+
+	// 是否有序只看计划: 子查询按连接的列升序排序, 或者用有序索引扫描
+	plans := []struct {
+		sources []string
+		query   string
+		plan    []string
+		rows    [][]string
+	}{
+		{
+			query: "select s.name, o.id from (select id, name from users order by id) s join (select uid, id from orders order by 1) o on s.id = o.uid;",
+			plan: []string{
+				"Merge Join (inner) on s.id = o.uid",
+				"  -> Subquery Scan on s",
+				"       -> Sort: id",
+				"            -> Seq Scan on users",
+				"  -> Subquery Scan on o",
+				"       -> Sort: 1",
+				"            -> Seq Scan on orders",
+			},
+			rows: [][]string{{"alice", "10"}, {"alice", "11"}, {"bob", "12"}},
+		},
+		{
+			query: "select s.name, o.id from (select id, name from users order by id desc) s join (select uid, id from orders order by uid) o on s.id = o.uid;",
+			plan: []string{
+				"Hash Join (inner) on s.id = o.uid",
+				"  -> Subquery Scan on s",
+				"       -> Sort: id desc",
+				"            -> Seq Scan on users",
+				"  -> Subquery Scan on o",
+				"       -> Sort: uid",
+				"            -> Seq Scan on orders",
+			},
+			rows: [][]string{{"bob", "12"}, {"alice", "10"}, {"alice", "11"}},
+		},
+		{
+			sources: []string{
+				"create index orders_uid_total on orders (uid, total);",
+				"insert into orders values (14, 1, 20);",
+			},
+			query: "select s.name, o.total from (select id, name from users order by id) s join orders o on s.id = o.uid;",
+			plan: []string{
+				"Merge Join (inner) on s.id = o.uid",
+				"  -> Subquery Scan on s",
+				"       -> Sort: id",
+				"            -> Seq Scan on users",
+				"  -> Index Scan using orders_uid_total on orders o",
+			},
+			rows: [][]string{{"alice", "20"}, {"alice", "50"}, {"alice", "100"}, {"bob", "70"}},
+		},
+		{
+			sources: []string{"update orders set total = 2 where id = 14;"},
+			query:   "select o.id, s.name from orders o join (select id, name from users order by id) s on o.total = s.id where o.uid = 1;",
+			plan: []string{
+				"Merge Join (inner) on o.total = s.id",
+				"  -> Filter: o.uid = 1",
+				"       -> Index Scan using orders_uid_total on orders o: o.uid = 1",
+				"  -> Subquery Scan on s",
+				"       -> Sort: id",
+				"            -> Seq Scan on users",
+			},
+			rows: [][]string{{"14", "bob"}},
+		},
+	}
+	for _, test := range plans {
+		for _, source := range test.sources {
+			assert.Nil(t, execute(mb, mustParse(t, source)), source)
+		}
+
+		explain, err := mb.Explain(mustParse(t, "explain "+test.query).ExplainStatement)
+		assert.Nil(t, err, test.query)
+		plan := []string{}
+		for _, row := range explain.Rows {
+			plan = append(plan, row[0].AsText())
+		}
+		assert.Equal(t, test.plan, plan, test.query)
+
+		results, err := mb.Select(mustParse(t, test.query).SelectStatement)
+		assert.Nil(t, err, test.query)
+		assert.Equal(t, test.rows, resultStrings(results), test.query)
+	}
+}
+
+func TestMemoryBackend_planner(t *testing.T) {
+	mb := newJoinTestBackend(t)
+
+	// 常量折叠和谓词下推之后的执行计划, 以及改写之后查询的结果
+	tests := []struct {
+		source string
+		plan   []string
+		rows   [][]string
+		err    error
+	}{
+		{
+			source: "select name from users where id = 1 + 1 and true;",
+			plan: []string{
+				"Filter: id = 2",
+				"  -> Seq Scan on users",
+			},
+			rows: [][]string{{"bob"}},
+		},
+		{
+			source: "select name from users where 1 = 1;",
+			plan:   []string{"Seq Scan on users"},
+			rows:   [][]string{{"alice"}, {"bob"}, {"carol"}},
+		},
+		{
+			source: "select u.name from users u, orders o where u.id = o.uid and o.total > 60;",
+			plan: []string{
+				"Hash Join (inner) on u.id = o.uid",
+				"  -> Seq Scan on users u",
+				"  -> Filter: o.total > 60",
+				"       -> Seq Scan on orders o",
+			},
+			rows: [][]string{{"alice"}, {"bob"}},
+		},
+		{
+			source: "select u.name from users u left join orders o on u.id = o.uid and o.total > 60 where u.name <> 'bob' and o.id is null;",
+			plan: []string{
+				"Filter: o.id is null",
+				"  -> Hash Join (left) on u.id = o.uid",
+				"       -> Filter: u.name <> 'bob'",
+				"            -> Seq Scan on users u",
+				"       -> Filter: o.total > 60",
+				"            -> Seq Scan on orders o",
+			},
+			rows: [][]string{{"carol"}},
+		},
+		{
+			source: "select name from users where id > 1 and exists (select 1 from orders where orders.uid = users.id);",
+			plan: []string{
+				"Filter: exists (select 1 from orders where orders.uid = users.id)",
+				"  -> Filter: id > 1",
+				"       -> Seq Scan on users",
+			},
+			rows: [][]string{{"bob"}},
+		},
+		{
+			// 没有ORDER BY的时候, 跳过的行和LIMIT之后的行都不会计算SELECT的列
+			source: "select 10 / (id - 2) from users limit 1;",
+			plan: []string{
+				"Limit 1",
+				"  -> Seq Scan on users",
+			},
+			rows: [][]string{{"-10"}},
+		},
+		{
+			source: "select 10 / (id - 2) from users offset 2;",
+			rows:   [][]string{{"10"}},
+		},
+		{
+			// 下推到扫描上的条件也只在取到的行上计算
+			source: "select id from users where 10 / (id - 3) < 0 limit 2;",
+			plan: []string{
+				"Limit 2",
+				"  -> Filter: 10 / (id - 3) < 0",
+				"       -> Seq Scan on users",
+			},
+			rows: [][]string{{"1"}, {"2"}},
+		},
+		// false tests
+		{
+			source: "select 10 / (id - 2) from users order by id limit 1;",
+			err:    ErrDivisionByZero,
+		},
+		{
+			source: "select name from users where id = 1 or 1 = 'a';",
+			err:    ErrTypeMismatch,
+		},
+	}
+
+	for _, test := range tests {
+		results, err := mb.Select(mustParse(t, test.source).SelectStatement)
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.source)
+			continue
+		}
+		assert.Nil(t, err, test.source)
+		assert.Equal(t, test.rows, resultStrings(results), test.source)
+
+		if test.plan == nil {
+			continue
+		}
+		explain, err := mb.Explain(mustParse(t, "explain "+test.source).ExplainStatement)
+		assert.Nil(t, err, test.source)
+		plan := []string{}
+		for _, row := range explain.Rows {
+			plan = append(plan, row[0].AsText())
+		}
+		assert.Equal(t, test.plan, plan, test.source)
+	}
+
+	// 投影裁剪之后FROM输出的列, 扫描上的条件用到的列在扫描的时候就用完了
+	pruned := []struct {
+		source  string
+		columns []string
+	}{
+		{
+			source:  "select u.name from users u join orders o on u.id = o.uid where o.total > 60;",
+			columns: []string{"u.id", "u.name", "o.uid"},
+		},
+		{
+			source:  "select count(*) from users, orders where users.id = orders.uid group by orders.total;",
+			columns: []string{"users.id", "orders.uid", "orders.total"},
+		},
+		{
+			source:  "select * from users u join orders o on u.id = o.uid;",
+			columns: []string{"u.id", "u.name", "o.id", "o.uid", "o.total"},
+		},
+		{
+			// 有子查询时不裁剪
+			source:  "select name from users where id in (select uid from orders);",
+			columns: []string{"users.id", "users.name"},
+		},
+	}
+	for _, test := range pruned {
+		plan, err := mb.planSelect(mustParse(t, test.source).SelectStatement, nil)
+		assert.Nil(t, err, test.source)
+
+		node := plan.root
+		for node.kind != fromLogicalKind {
+			node = node.input
+		}
+		columns := []string{}
+		for _, col := range node.from.columns {
+			columns = append(columns, qualifiedName(col.Table, col.Name))
+		}
+		assert.Equal(t, test.columns, columns, test.source)
+	}
+}
+
+// 建几张行数差别很大的表, 用来测试按统计信息选择索引和连接顺序
+func newAnalyzeTestBackend(t *testing.T) *MemoryBackend {
+	mb := NewMemoryBackend()
+	items, tags := []string{}, []string{}
+	for i := 0; i < 100; i++ {
+		items = append(items, fmt.Sprintf("(%d, %d, 'item%d')", i, i%10, i))
+		tags = append(tags, fmt.Sprintf("(%d, 't%d')", i, i%5))
+	}
+	for _, source := range []string{
+		"create table items (id int, cat int, name text);",
+		"insert into items values " + strings.Join(items, ", ") + ";",
+		"create table tags (item int, tag text);",
+		"insert into tags values " + strings.Join(tags, ", ") + ";",
+		"create table cats (id int, name text);",
+		"insert into cats values (1, 'books'), (2, 'games'), (3, null);",
+		"create index items_cat on items (cat);",
+	} {
+		assert.Nil(t, execute(mb, mustParse(t, source)), source)
+	}
+	return mb
+}
+
+func TestMemoryBackend_analyze(t *testing.T) {
+	mb := newAnalyzeTestBackend(t)
+
+	// 没有ANALYZE过的表没有统计信息
+	assert.Nil(t, mb.tables["items"].Stats)
+	assert.Nil(t, execute(mb, mustParse(t, "analyze cats;")))
+	assert.Nil(t, mb.tables["items"].Stats)
+
+	stats := mb.tables["cats"].Stats
+	assert.Equal(t, 3, stats.RowCount)
+	assert.Equal(t, 3, stats.Columns[0].Distinct)
+	assert.Equal(t, 0.0, stats.Columns[0].NullFraction)
+	assert.Equal(t, []MemoryCell{intCell(1), intCell(2), intCell(3)}, stats.Columns[0].Histogram)
+	assert.Equal(t, 2, stats.Columns[1].Distinct)
+	assert.InDelta(t, 1.0/3, stats.Columns[1].NullFraction, 1e-9)
+	assert.Equal(t, []MemoryCell{textCell("books"), textCell("games")}, stats.Columns[1].Histogram)
+
+	// 直方图最多10个桶, 每个桶里的值一样多
+	assert.Nil(t, execute(mb, mustParse(t, "ANALYZE;")))
+	stats = mb.tables["items"].Stats
+	assert.Equal(t, 100, stats.RowCount)
+	assert.Equal(t, 100, stats.Columns[0].Distinct)
+	assert.Equal(t, 10, stats.Columns[1].Distinct)
+	histogram := []int32{}
+	for _, cell := range stats.Columns[0].Histogram {
+		histogram = append(histogram, cell.AsInt())
+	}
+	assert.Equal(t, []int32{0, 9, 19, 29, 39, 49, 59, 69, 79, 89, 99}, histogram)
+	assert.NotNil(t, mb.tables["tags"].Stats)
+
+	// 删除的列的统计信息一起删除, 新加的列没有统计信息
+	assert.Nil(t, execute(mb, mustParse(t, "alter table cats drop column id;")))
+	assert.Nil(t, execute(mb, mustParse(t, "alter table cats add column id int;")))
+	stats = mb.tables["cats"].Stats
+	assert.Equal(t, 2, stats.Columns[0].Distinct)
+	assert.Nil(t, stats.column(1))
+
+	// false tests
+	err := execute(mb, mustParse(t, "analyze orders;"))
+	assert.True(t, errors.Is(err, ErrTableDoesNotExist))
+}
+
+func TestMemoryBackend_costBasedPlans(t *testing.T) {
+	// ANALYZE 之前按规则选择, 之后按估算的代价选择, 查询的结果不变
+	tests := []struct {
+		source string
+		before []string
+		after  []string
+		rows   int
+	}{
+		{
+			// 几乎所有的行都满足条件, 用索引还不如扫描整张表
+			source: "select name from items where cat >= 1;",
+			before: []string{
+				"Filter: cat >= 1",
+				"  -> Index Scan using items_cat on items: cat >= 1",
+			},
+			after: []string{
+				"Filter: cat >= 1",
+				"  -> Seq Scan on items",
+			},
+			rows: 90,
+		},
+		{
+			source: "select name from items where cat = 3;",
+			before: []string{
+				"Filter: cat = 3",
+				"  -> Index Scan using items_cat on items: cat = 3",
+			},
+			after: []string{
+				"Filter: cat = 3",
+				"  -> Index Scan using items_cat on items: cat = 3",
+			},
+			rows: 10,
+		},
+		{
+			// 先连接只有一行满足条件的cats, 中间结果只有10行
+			source: "select i.name, t.tag from items i join tags t on t.item = i.id join cats c on c.id = i.cat where c.name = 'books';",
+			before: []string{
+				"Hash Join (inner) on c.id = i.cat",
+				"  -> Hash Join (inner) on t.item = i.id",
+				"       -> Seq Scan on items i",
+				"       -> Seq Scan on tags t",
+				"  -> Filter: c.name = 'books'",
+				"       -> Seq Scan on cats c",
+			},
+			after: []string{
+				"Hash Join (inner) on t.item = i.id",
+				"  -> Hash Join (inner) on c.id = i.cat",
+				"       -> Seq Scan on items i",
+				"       -> Filter: c.name = 'books'",
+				"            -> Seq Scan on cats c",
+				"  -> Seq Scan on tags t",
+			},
+			rows: 10,
+		},
+		{
+			// 逗号隔开的表也一样, cats上的条件只剩一行, 所以先和items连接
+			source: "select count(*) from tags, items, cats where cats.id = items.cat and tags.item = items.id and cats.id = 2;",
+			before: []string{
+				"Aggregate",
+				"  -> Hash Join (inner) on cats.id = items.cat",
+				"       -> Hash Join (inner) on tags.item = items.id",
+				"            -> Seq Scan on tags",
+				"            -> Seq Scan on items",
+				"       -> Filter: cats.id = 2",
+				"            -> Seq Scan on cats",
+			},
+			after: []string{
+				"Aggregate",
+				"  -> Hash Join (inner) on tags.item = items.id",
+				"       -> Hash Join (inner) on cats.id = items.cat",
+				"            -> Seq Scan on items",
+				"            -> Filter: cats.id = 2",
+				"                 -> Seq Scan on cats",
+				"       -> Seq Scan on tags",
+			},
+			rows: 1,
+		},
+	}
+
+	for _, analyzed := range []bool{false, true} {
+		mb := newAnalyzeTestBackend(t)
+		if analyzed {
+			assert.Nil(t, execute(mb, mustParse(t, "analyze;")))
+		}
+
+		for _, test := range tests {
+			results, err := mb.Select(mustParse(t, test.source).SelectStatement)
+			assert.Nil(t, err, test.source)
+			assert.Equal(t, test.rows, len(results.Rows), test.source)
+
+			explain, err := mb.Explain(mustParse(t, "explain "+test.source).ExplainStatement)
+			assert.Nil(t, err, test.source)
+			plan := []string{}
+			for _, row := range explain.Rows {
+				plan = append(plan, row[0].AsText())
+			}
+			expected := test.before
+			if analyzed {
+				expected = test.after
+			}
+			assert.Equal(t, expected, plan, test.source)
+		}
+	}
+
+	// 表在ANALYZE的时候还是空的, 之后才插入数据, 估算的行数还是用表现在的行数
+	mb := newAnalyzeTestBackend(t)
+	logs := []string{}
+	for i := 0; i < 100; i++ {
+		logs = append(logs, fmt.Sprintf("(%d, %d)", i, i%3))
+	}
+	for _, source := range []string{
+		"create table logs (id int, level int);",
+		"create index logs_id on logs (id);",
+		"analyze logs;",
+		"insert into logs values " + strings.Join(logs, ", ") + ";",
+	} {
+		assert.Nil(t, execute(mb, mustParse(t, source)), source)
+	}
+	explain, err := mb.Explain(mustParse(t, "explain select level from logs where id = 5;").ExplainStatement)
+	assert.Nil(t, err)
+	assert.Equal(t, "  -> Index Scan using logs_id on logs: id = 5", explain.Rows[1][0].AsText())
+}
+
+func TestMemoryBackend_selectAlias(t *testing.T) {
+	mb := newJoinTestBackend(t)
+
+	tests := []struct {
+		source  string
+		columns []string
+		rows    [][]string
+		err     error
+	}{
+		{
+			source:  "select id as user_id, name username, id * 10 from users where id < 3;",
+			columns: []string{"user_id", "username", "?column?"},
+			rows:    [][]string{{"1", "alice", "10"}, {"2", "bob", "20"}},
+		},
+		{
+			source:  "select u.name as who, count(*) as n from users u join orders o on u.id = o.uid group by u.name order by n desc;",
+			columns: []string{"who", "n"},
+			rows:    [][]string{{"alice", "2"}, {"bob", "1"}},
+		},
+		{
+			// 别名和列重名时, ORDER BY 用的是别名
+			source:  "select -id as id from users order by id;",
+			columns: []string{"id"},
+			rows:    [][]string{{"-3"}, {"-2"}, {"-1"}},
+		},
+		{
+			source:  "select 1 + 2, 'x' as s, not false;",
+			columns: []string{"?column?", "s", "?column?"},
+			rows:    [][]string{{"3", "x", "true"}},
+		},
+		{
+			source:  "select 1 where false;",
+			columns: []string{"?column?"},
+			rows:    [][]string{},
+		},
+		{
+			source:  "select count(*) as n;",
+			columns: []string{"n"},
+			rows:    [][]string{{"1"}},
+		},
+		{
+			source:  "select 1 limit 0;",
+			columns: []string{"?column?"},
+			rows:    [][]string{},
+		},
+		// false tests
+		{
+			source: "select name;",
+			err:    ErrColumnDoesNotExist,
+		},
+		{
+			// 别名只能在ORDER BY里用
+			source: "select id as n from users where n > 1;",
+			err:    ErrColumnDoesNotExist,
+		},
+		{
+			source: "select 1 / 0;",
+			err:    ErrDivisionByZero,
+		},
+	}
+
+	for _, test := range tests {
+		results, err := mb.Select(mustParse(t, test.source).SelectStatement)
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.source)
+			continue
+		}
+		assert.Nil(t, err, test.source)
+
+		columns := []string{}
+		for _, col := range results.Columns {
+			columns = append(columns, col.Name)
+		}
+		assert.Equal(t, test.columns, columns, test.source)
+		assert.Equal(t, test.rows, resultStrings(results), test.source)
+	}
+
+	explain, err := mb.Explain(mustParse(t, "explain select 1 + 2;").ExplainStatement)
+	assert.Nil(t, err)
+	assert.Equal(t, "Result", explain.Rows[0][0].AsText())
+}
+
+func TestMemoryBackend_selectAsterisk(t *testing.T) {
+	mb := newJoinTestBackend(t)
+
+	tests := []struct {
+		source  string
+		columns []string
+		rows    [][]string
+		err     error
+	}{
+		{
+			source:  "select * from users;",
+			columns: []string{"id", "name"},
+			rows:    [][]string{{"1", "alice"}, {"2", "bob"}, {"3", "carol"}},
+		},
+		{
+			source:  "select *, id * 2 as double from users where id = 2;",
+			columns: []string{"id", "name", "double"},
+			rows:    [][]string{{"2", "bob", "4"}},
+		},
+		{
+			// 两张表都有id, 展开之后的列带着表名, 所以不会有歧义
+			source:  "select * from users u join orders o on u.id = o.uid where o.total < 60;",
+			columns: []string{"id", "name", "id", "uid", "total"},
+			rows:    [][]string{{"1", "alice", "11", "1", "50"}},
+		},
+		{
+			source:  "select o.*, u.name from users u join orders o on u.id = o.uid where u.id = 2;",
+			columns: []string{"id", "uid", "total", "name"},
+			rows:    [][]string{{"12", "2", "70", "bob"}},
+		},
+		{
+			source:  "select users.* from users order by id desc limit 1;",
+			columns: []string{"id", "name"},
+			rows:    [][]string{{"3", "carol"}},
+		},
+		{
+			source:  "select u.* from users u group by u.id, u.name having u.id > 2;",
+			columns: []string{"id", "name"},
+			rows:    [][]string{{"3", "carol"}},
+		},
+		// false tests
+		{
+			source: "select *;",
+			err:    ErrInvalidSelectItem,
+		},
+		{
+			source: "select users.* from users u;",
+			err:    ErrTableDoesNotExist,
+		},
+		{
+			source: "select * from users group by id;",
+			err:    ErrNotGrouped,
+		},
+	}
+
+	for _, test := range tests {
+		results, err := mb.Select(mustParse(t, test.source).SelectStatement)
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.source)
+			continue
+		}
+		assert.Nil(t, err, test.source)
+
+		columns := []string{}
+		for _, col := range results.Columns {
+			columns = append(columns, col.Name)
+		}
+		assert.Equal(t, test.columns, columns, test.source)
+		assert.Equal(t, test.rows, resultStrings(results), test.source)
+	}
+
+	// 没有列的表, * 展开之后什么都没有, t.* 也一样
+	empty := []struct {
+		sources []string
+		query   string
+		columns int
+		rows    int
+	}{
+		{
+			sources: []string{"create table z ();"},
+			query:   "select * from z;",
+			columns: 0,
+			rows:    0,
+		},
+		{
+			query:   "select z.*, u.* from users u, z;",
+			columns: 2,
+			rows:    0,
+		},
+		{
+			sources: []string{"create table w (a int);", "insert into w values (1), (2);", "alter table w drop column a;"},
+			query:   "select * from w;",
+			columns: 0,
+			rows:    2,
+		},
+	}
+	for _, test := range empty {
+		for _, source := range test.sources {
+			assert.Nil(t, execute(mb, mustParse(t, source)), source)
+		}
+		results, err := mb.Select(mustParse(t, test.query).SelectStatement)
+		assert.Nil(t, err, test.query)
+		assert.Equal(t, test.columns, len(results.Columns), test.query)
+		assert.Equal(t, test.rows, len(results.Rows), test.query)
+	}
+}
+
+func TestMemoryBackend_selectDistinctAndSetOperations(t *testing.T) {
+	mb := newJoinTestBackend(t)
+
+	tests := []struct {
+		source  string
+		columns []string
+		rows    [][]string
+		err     error
+	}{
+		{
+			source:  "select distinct uid from orders;",
+			columns: []string{"uid"},
+			rows:    [][]string{{"1"}, {"2"}, {"4"}},
+		},
+		{
+			source: "select distinct uid, total > 60 from orders order by uid desc;",
+			rows:   [][]string{{"4", "false"}, {"2", "true"}, {"1", "true"}, {"1", "false"}},
+		},
+		{
+			source: "select distinct uid as u, total > 60 from orders o order by o.uid desc, u, 2;",
+			rows:   [][]string{{"4", "false"}, {"2", "true"}, {"1", "false"}, {"1", "true"}},
+		},
+		{
+			source: "select distinct uid from orders limit 2 offset 1;",
+			rows:   [][]string{{"2"}, {"4"}},
+		},
+		{
+			source: "select distinct count(*) from orders group by uid;",
+			rows:   [][]string{{"2"}, {"1"}},
+		},
+		{
+			source:  "select id as n from users union select uid from orders;",
+			columns: []string{"n"},
+			rows:    [][]string{{"1"}, {"2"}, {"3"}, {"4"}},
+		},
+		{
+			source: "select id from users union all select uid from orders;",
+			rows:   [][]string{{"1"}, {"2"}, {"3"}, {"1"}, {"1"}, {"2"}, {"4"}},
+		},
+		{
+			source: "select uid from orders intersect select id from users;",
+			rows:   [][]string{{"1"}, {"2"}},
+		},
+		{
+			source: "select uid from orders intersect all select 1 union all select 1;",
+			rows:   [][]string{{"1"}, {"1"}},
+		},
+		{
+			source: "select uid from orders intersect all select id from users;",
+			rows:   [][]string{{"1"}, {"2"}},
+		},
+		{
+			source: "select uid from orders except select id from users;",
+			rows:   [][]string{{"4"}},
+		},
+		{
+			source: "select uid from orders except all select id from users;",
+			rows:   [][]string{{"1"}, {"4"}},
+		},
+		{
+			source: "select id, name from users union select uid, 'x' from orders order by id desc, name limit 3;",
+			rows:   [][]string{{"4", "x"}, {"3", "carol"}, {"2", "bob"}},
+		},
+		{
+			source: "select id from users except select uid from orders union select 10 order by id offset 1;",
+			rows:   [][]string{{"10"}},
+		},
+		// false tests
+		{
+			source: "select id, name from users union select uid from orders;",
+			err:    ErrColumnCountMismatch,
+		},
+		{
+			source: "select name from users intersect select uid from orders;",
+			err:    ErrTypeMismatch,
+		},
+		{
+			source: "select id from users union select uid from orders order by uid;",
+			err:    ErrColumnDoesNotExist,
+		},
+		{
+			source: "select distinct uid from orders order by total;",
+			err:    ErrInvalidOrderBy,
+		},
+		{
+			source: "select distinct uid + 1 from orders order by uid;",
+			err:    ErrInvalidOrderBy,
+		},
+		{
+			source: "select id from users union select uid from missing;",
+			err:    ErrTableDoesNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		results, err := mb.Select(mustParse(t, test.source).SelectStatement)
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.source)
+			continue
+		}
+		assert.Nil(t, err, test.source)
+		assert.Equal(t, test.rows, resultStrings(results), test.source)
+
+		if test.columns != nil {
+			columns := []string{}
+			for _, col := range results.Columns {
+				columns = append(columns, col.Name)
+			}
+			assert.Equal(t, test.columns, columns, test.source)
+		}
+	}
+
+	explain, err := mb.Explain(mustParse(t, "explain select distinct id from users union all select uid from orders order by id;").ExplainStatement)
+	assert.Nil(t, err)
+	plan := []string{}
+	for _, row := range explain.Rows {
+		plan = append(plan, row[0].AsText())
+	}
+	assert.Equal(t, []string{
+		"Sort: id",
+		"  -> Union All",
+		"       -> Distinct",
+		"            -> Seq Scan on users",
+		"       -> Seq Scan on orders",
+	}, plan)
+}
+
+func TestMemoryBackend_selectSubquery(t *testing.T) {
+	mb := newJoinTestBackend(t)
+
+	tests := []struct {
+		source string
+		rows   [][]string
+		err    error
+	}{
+		{
+			source: "select name, (select max(total) from orders) from users where id = 1;",
+			rows:   [][]string{{"alice", "100"}},
+		},
+		{
+			// 相关子查询: 子查询里的users.id是外层查询当前这一行的值
+			source: "select name, (select count(*) from orders where orders.uid = users.id) from users;",
+			rows:   [][]string{{"alice", "2"}, {"bob", "1"}, {"carol", "0"}},
+		},
+		{
+			// 不限定表名的id优先是子查询自己的列
+			source: "select name from users u where (select sum(total) from orders where uid = u.id and id > 10) > 60;",
+			rows:   [][]string{{"bob"}},
+		},
+		{
+			source: "select name from users where id in (select uid from orders where total >= 70);",
+			rows:   [][]string{{"alice"}, {"bob"}},
+		},
+		{
+			source: "select name from users where id not in (select uid from orders);",
+			rows:   [][]string{{"carol"}},
+		},
+		{
+			source: "select name from users where id in (1, 3) and name not in ('carol');",
+			rows:   [][]string{{"alice"}},
+		},
+		{
+			source: "select id from orders o where exists (select * from users where users.id = o.uid);",
+			rows:   [][]string{{"10"}, {"11"}, {"12"}},
+		},
+		{
+			source: "select id from orders o where not exists (select 1 from users where users.id = o.uid);",
+			rows:   [][]string{{"13"}},
+		},
+		{
+			// 两层嵌套, 最里面的子查询引用最外层的列
+			source: "select name from users where exists (select 1 from orders where uid = users.id and total = (select max(total) from orders o2 where o2.uid = users.id) and total > 60);",
+			rows:   [][]string{{"alice"}, {"bob"}},
+		},
+		{
+			source: "select s.uid, s.n from (select uid, count(*) as n from orders group by uid) as s where s.n > 1;",
+			rows:   [][]string{{"1", "2"}},
+		},
+		{
+			source: "select u.name, t.total from users u join (select uid, total from orders where total > 60) t on u.id = t.uid order by t.total;",
+			rows:   [][]string{{"bob", "70"}, {"alice", "100"}},
+		},
+		{
+			source: "select uid, (select name from users where id = uid) from orders group by uid order by uid;",
+			rows:   [][]string{{"1", "alice"}, {"2", "bob"}, {"4", "NULL"}},
+		},
+		{
+			source: "select count(*) from users where id in (select id from users union select uid from orders);",
+			rows:   [][]string{{"3"}},
+		},
+		// false tests
+		{
+			source: "select (select id, name from users) from orders;",
+			err:    ErrInvalidSubquery,
+		},
+		{
+			source: "select (select id from users) from orders;",
+			err:    ErrInvalidSubquery,
+		},
+		{
+			source: "select id from users where name in (select uid from orders);",
+			err:    ErrTypeMismatch,
+		},
+		{
+			source: "select id from users where id in (1, 'a');",
+			err:    ErrTypeMismatch,
+		},
+		{
+			source: "select id from users where exists (select missing from orders);",
+			err:    ErrColumnDoesNotExist,
+		},
+		{
+			// FROM 里的子查询不能引用外层查询的列
+			source: "select id from users where exists (select 1 from (select uid from orders where uid = users.id) as o);",
+			err:    ErrColumnDoesNotExist,
+		},
+		{
+			source: "select id from (select id from users) as u, (select uid as id from orders) as u;",
+			err:    ErrDuplicateTableName,
+		},
+	}
+
+	for _, test := range tests {
+		results, err := mb.Select(mustParse(t, test.source).SelectStatement)
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.source)
+			continue
+		}
+		assert.Nil(t, err, test.source)
+		assert.Equal(t, test.rows, resultStrings(results), test.source)
+	}
+
+	// WHERE 里的子查询在UPDATE和DELETE里也能用
+	updated, err := mb.Update(mustParse(t, "update orders set total = 0 where uid not in (select id from users);").UpdateStatement)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1), updated)
+	deleted, err := mb.Delete(mustParse(t, "delete from users where not exists (select 1 from orders where orders.uid = users.id);").DeleteStatement)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1), deleted)
+
+	explain, err := mb.Explain(mustParse(t, "explain select n from (select count(*) as n from orders) as s where n > (select 1);").ExplainStatement)
+	assert.Nil(t, err)
+	plan := []string{}
+	for _, row := range explain.Rows {
+		plan = append(plan, row[0].AsText())
+	}
+	assert.Equal(t, []string{
+		"Filter: n > (select 1)",
+		"  -> Subquery Scan on s",
+		"       -> Aggregate",
+		"            -> Seq Scan on orders",
+	}, plan)
+}
+
+func TestMemoryBackend_null(t *testing.T) {
+	mb := newTestBackend(t)
+	for _, source := range []string{
+		"create table scores (id int, name text, score int, passed bool);",
+		"insert into scores values (1, 'alice', 90, true), (2, '', null, null), (3, null, 60, false);",
+		"insert into scores (id) values (4);",
+	} {
+		stmt := mustParse(t, source)
+		var err error
+		if stmt.Kind == parser.CreateKind {
+			err = mb.CreateTable(stmt.CreateStatement)
+		} else {
+			err = mb.Insert(stmt.InsertStatement)
+		}
+		assert.Nil(t, err, source)
+	}
+
+	tests := []struct {
+		source string
+		rows   [][]string
+		err    error
+	}{
+		{
+			// 空字符串不是NULL
+			source: "select id, name, score, passed from scores;",
+			rows:   [][]string{{"1", "alice", "90", "true"}, {"2", "", "NULL", "NULL"}, {"3", "NULL", "60", "false"}, {"4", "NULL", "NULL", "NULL"}},
+		},
+		{
+			source: "select id from scores where name is null;",
+			rows:   [][]string{{"3"}, {"4"}},
+		},
+		{
+			source: "select id from scores where score is not null and passed is not null;",
+			rows:   [][]string{{"1"}, {"3"}},
+		},
+		{
+			// 和NULL比较的结果是NULL, 不满足WHERE, NOT NULL 也还是NULL
+			source: "select id from scores where score = null or not (score > 70);",
+			rows:   [][]string{{"3"}},
+		},
+		{
+			source: "select id, score + 1, -score, score > 70 from scores where id >= 3;",
+			rows:   [][]string{{"3", "61", "-60", "false"}, {"4", "NULL", "NULL", "NULL"}},
+		},
+		{
+			// 三值逻辑: false AND NULL 是false, true OR NULL 是true, 其他有NULL的情况都是NULL
+			source: "select passed and null, passed or null, null and false, null or true, not passed from scores where id in (1, 3);",
+			rows:   [][]string{{"NULL", "true", "false", "true", "false"}, {"false", "NULL", "false", "true", "true"}},
+		},
+		{
+			source: "select 1 in (1, null), 2 in (1, null), 2 not in (1, null), null in (1), 2 not in (1, 3);",
+			rows:   [][]string{{"true", "NULL", "NULL", "NULL", "true"}},
+		},
+		{
+			source: "select id from scores where score not in (select score from scores where id = 4);",
+			rows:   [][]string{},
+		},
+		{
+			// 聚合函数忽略NULL, COUNT(*) 还是数所有的行
+			source: "select count(*), count(score), sum(score), avg(score), min(name), max(passed) from scores;",
+			rows:   [][]string{{"4", "2", "150", "75", "", "true"}},
+		},
+		{
+			source: "select sum(score), max(name) from scores where score is null;",
+			rows:   [][]string{{"NULL", ""}},
+		},
+		{
+			// 分组和去重的时候所有的NULL算同一个值
+			source: "select passed, count(*) from scores group by passed order by passed;",
+			rows:   [][]string{{"false", "1"}, {"true", "1"}, {"NULL", "2"}},
+		},
+		{
+			source: "select passed from scores group by passed having max(score) is null;",
+			rows:   [][]string{{"NULL"}},
+		},
+		{
+			source: "select distinct score from scores order by score desc;",
+			rows:   [][]string{{"NULL"}, {"90"}, {"60"}},
+		},
+		{
+			source: "select null union select 1;",
+			rows:   [][]string{{"NULL"}, {"1"}},
+		},
+		{
+			source: "select id from scores order by id limit null offset 3;",
+			rows:   [][]string{{"4"}},
+		},
+		// false tests
+		{
+			source: "select name + null from scores;",
+			err:    ErrTypeMismatch,
+		},
+		{
+			source: "select id from scores where score in ('a', null);",
+			err:    ErrTypeMismatch,
+		},
+	}
+
+	for _, test := range tests {
+		results, err := mb.Select(mustParse(t, test.source).SelectStatement)
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.source)
+			continue
+		}
+		assert.Nil(t, err, test.source)
+		assert.Equal(t, test.rows, resultStrings(results), test.source)
+	}
+
+	// NULL也可以写进UPDATE和列的默认值里
+	updated, err := mb.Update(mustParse(t, "update scores set score = null where score < 70;").UpdateStatement)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1), updated)
+	err = mb.AlterTable(mustParse(t, "alter table scores add column note text default null;").AlterTableStatement)
+	assert.Nil(t, err)
+	results, err := mb.Select(mustParse(t, "select count(score), count(note) from scores;").SelectStatement)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"1", "0"}}, resultStrings(results))
+}
+
+func TestMemoryBackend_selectWith(t *testing.T) {
+	mb := newJoinTestBackend(t)
+	err := mb.CreateTable(mustParse(t, "create table staff (id int, name text, manager int);").CreateStatement)
+	assert.Nil(t, err)
+	for _, source := range []string{
+		"insert into staff values (1, 'ceo', 0);",
+		"insert into staff values (2, 'cto', 1);",
+		"insert into staff values (3, 'dev', 2);",
+		"insert into staff values (4, 'cfo', 1);",
+		"insert into staff values (5, 'intern', 3);",
+	} {
+		err = mb.Insert(mustParse(t, source).InsertStatement)
+		assert.Nil(t, err, source)
+	}
+
+	tests := []struct {
+		source  string
+		columns []string
+		rows    [][]string
+		err     error
+	}{
+		{
+			source:  "with big as (select id, total from orders where total > 60) select id from big order by id;",
+			columns: []string{"id"},
+			rows:    [][]string{{"10"}, {"12"}},
+		},
+		{
+			// 后面的CTE可以引用前面的CTE, 主查询里CTE可以和表连接
+			source:  "with t (uid, spent) as (select uid, sum(total) from orders group by uid), rich as (select uid from t where spent > 60) select u.name from users u join rich on u.id = rich.uid;",
+			columns: []string{"name"},
+			rows:    [][]string{{"alice"}, {"bob"}},
+		},
+		{
+			// CTE的名字优先于同名的表
+			source: "with users as (select 42 as id) select id from users;",
+			rows:   [][]string{{"42"}},
+		},
+		{
+			source: "with t as (select uid from orders) select name from users where id in (select uid from t) and exists (select 1 from t);",
+			rows:   [][]string{{"alice"}, {"bob"}},
+		},
+		{
+			source:  "with recursive n (i) as (select 1 union all select i + 1 from n where i < 5) select i from n;",
+			columns: []string{"i"},
+			rows:    [][]string{{"1"}, {"2"}, {"3"}, {"4"}, {"5"}},
+		},
+		{
+			// 组织架构: cto下面的所有人以及他们在第几层
+			source: "with recursive report (id, name, depth) as (select id, name, 0 from staff where name = 'cto' union all select s.id, s.name, r.depth + 1 from staff s join report r on s.manager = r.id) select name, depth from report order by depth, name;",
+			rows:   [][]string{{"cto", "0"}, {"dev", "1"}, {"intern", "2"}},
+		},
+		{
+			// 没有ALL的时候重复的行不会再参与递归, 所以环也能结束
+			source: "with recursive m (i) as (select 0 union select (i + 1) % 3 from m) select i from m;",
+			rows:   [][]string{{"0"}, {"1"}, {"2"}},
+		},
+		{
+			// WITH RECURSIVE 里没有引用自己的CTE就是普通的CTE
+			source: "with recursive a as (select 1 as x union all select 2) select x from a;",
+			rows:   [][]string{{"1"}, {"2"}},
+		},
+		// false tests
+		{
+			source: "with recursive m (i) as (select 0 union all select (i + 1) % 3 from m) select i from m;",
+			err:    ErrInvalidRecursion,
+		},
+		{
+			source: "with recursive n (i) as (select 1 union all select i + 1 from n order by i) select i from n;",
+			err:    ErrInvalidRecursion,
+		},
+		{
+			source: "with recursive n (i) as (select 1 union all select 'x' from n) select i from n;",
+			err:    ErrTypeMismatch,
+		},
+		{
+			source: "with n (i) as (select 1 union all select i + 1 from n where i < 5) select i from n;",
+			err:    ErrTableDoesNotExist,
+		},
+		{
+			source: "with t (a, b) as (select 1) select a from t;",
+			err:    ErrCteColumnMismatch,
+		},
+		{
+			source: "with recursive n (i) as (select 1 union all select i, i from n) select i from n;",
+			err:    ErrCteColumnMismatch,
+		},
+		{
+			source: "with t as (select 1), t as (select 2) select 1;",
+			err:    ErrDuplicateTableName,
+		},
+		{
+			source: "with t as (select id from users) select name from t;",
+			err:    ErrColumnDoesNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		results, err := mb.Select(mustParse(t, test.source).SelectStatement)
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), test.source)
+			continue
+		}
+		assert.Nil(t, err, test.source)
+		assert.Equal(t, test.rows, resultStrings(results), test.source)
+
+		if test.columns != nil {
+			columns := []string{}
+			for _, col := range results.Columns {
+				columns = append(columns, col.Name)
+			}
+			assert.Equal(t, test.columns, columns, test.source)
+		}
+	}
+
+	// 查询结束之后CTE就看不到了
+	_, err = mb.Select(mustParse(t, "select * from big;").SelectStatement)
+	assert.True(t, errors.Is(err, ErrTableDoesNotExist))
+
+	explain, err := mb.Explain(mustParse(t, "explain with recursive n (i) as (select 1 union all select i + 1 from n where i < 5) select i from n where i > 2;").ExplainStatement)
+	assert.Nil(t, err)
+	plan := []string{}
+	for _, row := range explain.Rows {
+		plan = append(plan, row[0].AsText())
+	}
+	assert.Equal(t, []string{
+		"Filter: i > 2",
+		"  -> CTE Scan on n",
+		"CTE n",
+		"  -> Recursive Union All",
+		"       -> Result",
+		"       -> Filter: i < 5",
+		"            -> CTE Scan on n",
+	}, plan)
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/database-from-zero-to-one/parser"
+)
+
+// 物理计划里的算子
+// 上面的算子每次调用next从下面的算子取一行, 所以LIMIT取够了行之后下面的算子就不会再计算后面的行
+// 排序和聚合要先取完下面所有的行才能输出第一行, 连接也要先算出所有的行
+
+type operator interface {
+	// 返回下一行, 没有更多的行时ok为false
+	next() (row []MemoryCell, ok bool, err error)
+	// EXPLAIN 里显示的这个算子和它下面的算子
+	explain() ([]string, error)
+}
+
+// 按FROM的计划输出每一行
+// 扫描表的时候先找出所有的行, 再一行一行地过滤, 这样LIMIT取够了行之后后面的行上的条件就不会再计算
+// 连接要先算出所有的行, 再一行一行地输出
+type fromOperator struct {
+	mb   *MemoryBackend
+	plan *fromPlan
+	scan bool               // 是否还要用扫描上的条件过滤并且裁剪掉不用的列
+	cond *parser.Expression // 下推到扫描上的条件
+	rows [][]MemoryCell     // 还没有输出的行, 为nil时还没有执行
+}
+
+func (op *fromOperator) next() ([]MemoryCell, bool, error) {
+	if op.rows == nil {
+		var rows [][]MemoryCell
+		switch op.plan.kind {
+		case scanPlanKind, cteScanPlanKind, subqueryScanPlanKind:
+			var err error
+			rows, err = op.mb.scanSource(op.plan)
+			if err != nil {
+				return nil, false, err
+			}
+			op.scan = true
+			op.cond = joinConjuncts(op.plan.filters)
+		default:
+			from, err := op.mb.executeFrom(op.plan)
+			if err != nil {
+				return nil, false, err
+			}
+			rows = from.rows
+		}
+		op.rows = append([][]MemoryCell{}, rows...)
+	}
+
+	for len(op.rows) > 0 {
+		row := op.rows[0]
+		op.rows = op.rows[1:]
+		if !op.scan {
+			return row, true, nil
+		}
+
+		ok, err := op.mb.matchScanCondition(op.plan, op.cond, row)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			return op.plan.projectRow(row), true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (op *fromOperator) explain() ([]string, error) {
+	return op.mb.explainFrom(op.plan)
+}
+
+// 只输出满足条件的行
+type filterOperator struct {
+	mb      *MemoryBackend
+	input   operator
+	plan    *logicalPlan
+	columns []contextColumn
+	outer   *rowContext
+}
+
+func (op *filterOperator) next() ([]MemoryCell, bool, error) {
+	for {
+		row, ok, err := op.input.next()
+		if err != nil || !ok {
+			return nil, false, err
+		}
+
+		ok, err = op.mb.matchCondition(&rowContext{
+			columns: op.columns,
+			row:     row,
+			outer:   op.outer,
+		}, op.plan.cond)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			return row, true, nil
+		}
+	}
+}
+
+func (op *filterOperator) explain() ([]string, error) {
+	input, err := op.input.explain()
+	if err != nil {
+		return nil, err
+	}
+	cond := op.plan.cond
+	if op.plan.shown != nil {
+		cond = op.plan.shown
+	}
+	return explainStep("Filter: "+cond.String(), input), nil
+}
+
+// 哈希聚合: 先把下面所有的行累加到各自的分组里, 然后每个分组输出一行
+type aggregateOperator struct {
+	mb      *MemoryBackend
+	input   operator
+	agg     *aggregation
+	columns []contextColumn
+	outer   *rowContext
+	rows    [][]MemoryCell // 还没有输出的分组, 为nil时还没有聚合
+}
+
+func (op *aggregateOperator) next() ([]MemoryCell, bool, error) {
+	if op.rows == nil {
+		for {
+			row, ok, err := op.input.next()
+			if err != nil {
+				return nil, false, err
+			}
+			if !ok {
+				break
+			}
+
+			err = op.mb.accumulate(op.agg, &rowContext{
+				columns: op.columns,
+				row:     row,
+				outer:   op.outer,
+			})
+			if err != nil {
+				return nil, false, err
+			}
+		}
+		rows, err := op.agg.rows()
+		if err != nil {
+			return nil, false, err
+		}
+		op.rows = rows
+	}
+	if len(op.rows) == 0 {
+		return nil, false, nil
+	}
+
+	row := op.rows[0]
+	op.rows = op.rows[1:]
+	return row, true, nil
+}
+
+func (op *aggregateOperator) explain() ([]string, error) {
+	input, err := op.input.explain()
+	if err != nil {
+		return nil, err
+	}
+	step := "Aggregate"
+	if len(op.agg.groupBy) > 0 {
+		step = "Hash Aggregate: group by " + expressionsString(op.agg.groupBy)
+	}
+	return explainStep(step, input), nil
+}
+
+// 计算SELECT的每一列, 有ORDER BY的时候在后面加上排序键的值
+type projectOperator struct {
+	mb      *MemoryBackend
+	input   operator
+	plan    *logicalPlan
+	columns []contextColumn
+	outer   *rowContext
+}
+
+func (op *projectOperator) next() ([]MemoryCell, bool, error) {
+	row, ok, err := op.input.next()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	ctx := &rowContext{
+		columns: op.columns,
+		row:     row,
+		outer:   op.outer,
+	}
+	result := []MemoryCell{}
+	for _, exp := range op.plan.items {
+		cell, _, err := op.mb.evaluateCell(ctx, exp)
+		if err != nil {
+			return nil, false, err
+		}
+		result = append(result, cell)
+	}
+	if len(op.plan.orderBy) > 0 {
+		keys, err := op.mb.evaluateSortKeys(ctx, op.plan.orderBy)
+		if err != nil {
+			return nil, false, err
+		}
+		result = append(result, keys...)
+	}
+	return result, true, nil
+}
+
+// 投影不显示在EXPLAIN里
+func (op *projectOperator) explain() ([]string, error) {
+	return op.input.explain()
+}
+
+// DISTINCT 只保留每种行第一次出现的那一行, 只比较SELECT的列
+type distinctOperator struct {
+	input operator
+	width int
+	seen  map[string]bool
+}
+
+func (op *distinctOperator) next() ([]MemoryCell, bool, error) {
+	for {
+		row, ok, err := op.input.next()
+		if err != nil || !ok {
+			return nil, false, err
+		}
+
+		key := groupKey(row[:op.width])
+		if !op.seen[key] {
+			op.seen[key] = true
+			return row, true, nil
+		}
+	}
+}
+
+func (op *distinctOperator) explain() ([]string, error) {
+	input, err := op.input.explain()
+	if err != nil {
+		return nil, err
+	}
+	return explainStep("Distinct", input), nil
+}
+
+// 按每一行后面的排序键稳定排序, 排序键都相同的行保持原来的顺序
+type sortOperator struct {
+	input operator
+	plan  *logicalPlan
+	width int
+	rows  [][]MemoryCell // 排好序还没有输出的行, 为nil时还没有排序
+}
+
+func (op *sortOperator) next() ([]MemoryCell, bool, error) {
+	if op.rows == nil {
+		op.rows = [][]MemoryCell{}
+		for {
+			row, ok, err := op.input.next()
+			if err != nil {
+				return nil, false, err
+			}
+			if !ok {
+				break
+			}
+			op.rows = append(op.rows, row)
+		}
+		sort.SliceStable(op.rows, func(i, j int) bool {
+			return compareSortKeys(op.plan.keys, op.rows[i][op.width:], op.rows[j][op.width:]) < 0
+		})
+	}
+	if len(op.rows) == 0 {
+		return nil, false, nil
+	}
+
+	row := op.rows[0]
+	op.rows = op.rows[1:]
+	return row, true, nil
+}
+
+func (op *sortOperator) explain() ([]string, error) {
+	input, err := op.input.explain()
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for _, item := range op.plan.sortBy {
+		key := item.Exp.String()
+		if item.Desc {
+			key += " desc"
+		}
+		keys = append(keys, key)
+	}
+	return explainStep("Sort: "+strings.Join(keys, ", "), input), nil
+}
+
+// 跳过前offset行, 最多输出limit行, limit为-1时不限制
+type limitOperator struct {
+	input    operator
+	plan     *logicalPlan
+	skipped  int
+	returned int
+}
+
+func (op *limitOperator) next() ([]MemoryCell, bool, error) {
+	for {
+		if op.plan.limit >= 0 && op.returned >= op.plan.limit {
+			return nil, false, nil
+		}
+
+		row, ok, err := op.input.next()
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		if op.skipped < op.plan.offset {
+			op.skipped++
+			continue
+		}
+		op.returned++
+		return row, true, nil
+	}
+}
+
+func (op *limitOperator) explain() ([]string, error) {
+	input, err := op.input.explain()
+	if err != nil {
+		return nil, err
+	}
+	step := "Limit"
+	if op.plan.limitExp != nil {
+		step += " " + op.plan.limitExp.String()
+	}
+	if op.plan.offsetExp != nil {
+		step += " offset " + op.plan.offsetExp.String()
+	}
+	return explainStep(step, input), nil
+}
@@ -0,0 +1,658 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/database-from-zero-to-one/lexer"
+	"github.com/database-from-zero-to-one/parser"
+)
+
+// 查询计划
+// SELECT 先被转换成逻辑计划: 由扫描, 连接, 过滤, 聚合, 投影, 去重, 排序和LIMIT组成的一棵树, 只描述要算什么
+// 扫描和连接就是FROM的计划(fromPlan), 见join.go
+// 然后按规则改写逻辑计划, 改写不会改变查询的结果:
+// 常量折叠: 不引用任何列的表达式先算出值, 比如 a <= 2 * 40 变成 a <= 80
+// 谓词下推: WHERE 和 ON 里的条件放到只引用到的那张表的扫描或者那个连接上, 越早过滤, 后面要处理的行就越少
+// 投影裁剪: 扫描表的时候只保留上面用得到的列
+// 最后生成物理计划: 给每个连接选择执行方式, 给每个扫描选择索引, 每个节点变成一个算子, 见operator.go
+// 表有统计信息时, 按估算的代价选择索引和内连接的顺序, 见cost.go
+
+// 逻辑计划的节点
+type logicalPlanKind uint
+
+const (
+	fromLogicalKind      logicalPlanKind = iota // 扫描和连接
+	filterLogicalKind                           // WHERE 或者 HAVING
+	aggregateLogicalKind                        // 聚合, 见aggregate.go
+	projectLogicalKind                          // 计算SELECT的每一列
+	distinctLogicalKind
+	sortLogicalKind
+	limitLogicalKind
+)
+
+type logicalPlan struct {
+	kind  logicalPlanKind
+	input *logicalPlan
+
+	// 扫描和连接
+	from *fromPlan
+
+	// 过滤, shown是EXPLAIN里显示的条件, HAVING 显示的是改写成引用聚合结果之前的条件
+	cond  *parser.Expression
+	shown *parser.Expression
+
+	// 聚合
+	agg *aggregation
+
+	// 投影: 每一行先是SELECT的每一列, 后面跟着排序键的值, 排序键可以引用SELECT里没有的列
+	items   []*parser.Expression
+	orderBy []*parser.OrderByItem
+
+	// 排序, 按投影之后每一行后面的排序键排序, sortBy是EXPLAIN里显示的ORDER BY
+	keys   []sortKey
+	sortBy []*parser.OrderByItem
+
+	// LIMIT 和 OFFSET 的值, 没有LIMIT时limit为-1, 表达式用于EXPLAIN
+	limit, offset       int
+	limitExp, offsetExp *parser.Expression
+}
+
+// 一个SELECT的计划, root最上面的节点输出的每一行, 前len(columns)个值就是结果的一行
+type queryPlan struct {
+	root    *logicalPlan
+	columns []ResultColumn
+}
+
+// 把SELECT转换成逻辑计划, 同时检查每个表达式的类型, 然后改写逻辑计划
+func (mb *MemoryBackend) planSelect(slct *parser.SelectStatement, outer *rowContext) (*queryPlan, error) {
+	plan, err := mb.logicalPlan(slct, outer)
+	if err != nil {
+		return nil, err
+	}
+
+	mb.foldPlanConstants(plan.root)
+	plan.root = pushDownPredicates(plan.root)
+	plan.root.pruneColumns()
+	return plan, nil
+}
+
+func (mb *MemoryBackend) logicalPlan(slct *parser.SelectStatement, outer *rowContext) (*queryPlan, error) {
+	from, err := mb.planFrom(slct.From)
+	if err != nil {
+		return nil, err
+	}
+	node := &logicalPlan{
+		kind: fromLogicalKind,
+		from: from,
+	}
+
+	tableColumns := scopeColumns(from.columns, outer)
+	if err := mb.checkCondition(tableColumns, slct.Where, "WHERE"); err != nil {
+		return nil, err
+	}
+	if slct.Where != nil {
+		node = &logicalPlan{
+			kind:  filterLogicalKind,
+			input: node,
+			cond:  slct.Where,
+		}
+	}
+
+	// 默认直接在FROM的每一行上计算SELECT的每一列
+	// 需要聚合的时候, 改成在聚合之后的每一行(也就是每个分组)上计算
+	sourceColumns := tableColumns
+	items, names, err := expandSelectItems(slct, from.columns)
+	if err != nil {
+		return nil, err
+	}
+	orderBy, err := resolveOrderBy(slct.Item, items, slct.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+	if slct.Distinct {
+		if err := checkDistinctOrderBy(tableColumns, items, orderBy); err != nil {
+			return nil, err
+		}
+	}
+	if isAggregateSelect(slct) {
+		agg, err := mb.newAggregation(tableColumns, slct.GroupBy)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, exp := range items {
+			items[i], err = mb.rewriteAggregate(agg, exp)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var having *parser.Expression
+		if slct.Having != nil {
+			having, err = mb.rewriteAggregate(agg, slct.Having)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for i, item := range orderBy {
+			exp, err := mb.rewriteAggregate(agg, item.Exp)
+			if err != nil {
+				return nil, err
+			}
+			orderBy[i] = &parser.OrderByItem{
+				Exp:   exp,
+				Desc:  item.Desc,
+				Nulls: item.Nulls,
+			}
+		}
+
+		sourceColumns = scopeColumns(agg.outputColumns(), outer)
+		if err := mb.checkCondition(sourceColumns, having, "HAVING"); err != nil {
+			return nil, err
+		}
+
+		node = &logicalPlan{
+			kind:  aggregateLogicalKind,
+			input: node,
+			agg:   agg,
+		}
+		if having != nil {
+			node = &logicalPlan{
+				kind:  filterLogicalKind,
+				input: node,
+				cond:  having,
+				shown: slct.Having,
+			}
+		}
+	}
+
+	// 先做类型检查, 这样就算一行数据都没有也能知道结果每一列的名字和类型
+	columns := []ResultColumn{}
+	for i, exp := range items {
+		typ, err := mb.expressionType(sourceColumns, exp)
+		if err != nil {
+			return nil, err
+		}
+
+		columns = append(columns, ResultColumn{
+			Type: typ,
+			Name: names[i],
+		})
+	}
+
+	keys, err := mb.orderByKeys(sourceColumns, orderBy)
+	if err != nil {
+		return nil, err
+	}
+	limit, offset, err := mb.limitAndOffset(slct)
+	if err != nil {
+		return nil, err
+	}
+
+	node = &logicalPlan{
+		kind:    projectLogicalKind,
+		input:   node,
+		items:   items,
+		orderBy: orderBy,
+	}
+	if slct.Distinct {
+		node = &logicalPlan{
+			kind:  distinctLogicalKind,
+			input: node,
+		}
+	}
+	if len(orderBy) > 0 {
+		node = &logicalPlan{
+			kind:   sortLogicalKind,
+			input:  node,
+			keys:   keys,
+			sortBy: slct.OrderBy,
+		}
+	}
+	if slct.Limit != nil || slct.Offset != nil {
+		node = &logicalPlan{
+			kind:      limitLogicalKind,
+			input:     node,
+			limit:     limit,
+			offset:    offset,
+			limitExp:  slct.Limit,
+			offsetExp: slct.Offset,
+		}
+	}
+
+	return &queryPlan{
+		root:    node,
+		columns: columns,
+	}, nil
+}
+
+// 常量折叠: 把逻辑计划里所有的表达式中不引用任何列的部分换成算出来的值
+func (mb *MemoryBackend) foldPlanConstants(plan *logicalPlan) {
+	for node := plan; node != nil; node = node.input {
+		switch node.kind {
+		case fromLogicalKind:
+			mb.foldJoinConstants(node.from)
+		case filterLogicalKind:
+			node.cond = mb.foldCondition(node.cond)
+			if node.shown != nil {
+				node.shown = mb.foldCondition(node.shown)
+			}
+		case aggregateLogicalKind:
+			groupBy := []*parser.Expression{}
+			for _, exp := range node.agg.groupBy {
+				groupBy = append(groupBy, mb.foldConstants(exp))
+			}
+			node.agg.groupBy = groupBy
+			for _, call := range node.agg.calls {
+				call.fn = mb.foldConstants(&parser.Expression{
+					Function: call.fn,
+					Kind:     parser.FunctionKind,
+				}).Function
+			}
+		case projectLogicalKind:
+			for i, exp := range node.items {
+				node.items[i] = mb.foldConstants(exp)
+			}
+			for i, item := range node.orderBy {
+				node.orderBy[i] = &parser.OrderByItem{
+					Exp:   mb.foldConstants(item.Exp),
+					Desc:  item.Desc,
+					Nulls: item.Nulls,
+				}
+			}
+		case limitLogicalKind:
+			if node.limitExp != nil {
+				node.limitExp = mb.foldConstants(node.limitExp)
+			}
+			if node.offsetExp != nil {
+				node.offsetExp = mb.foldConstants(node.offsetExp)
+			}
+		}
+	}
+}
+
+func (mb *MemoryBackend) foldJoinConstants(plan *fromPlan) {
+	if plan.kind != joinPlanKind {
+		return
+	}
+	if plan.on != nil {
+		plan.on = mb.foldCondition(plan.on)
+	}
+	mb.foldJoinConstants(plan.left)
+	mb.foldJoinConstants(plan.right)
+}
+
+// 折叠条件里的常量, 去掉AND连起来的条件里一定是true的部分, 全都是true时返回nil
+func (mb *MemoryBackend) foldCondition(cond *parser.Expression) *parser.Expression {
+	kept := []*parser.Expression{}
+	for _, exp := range splitConjuncts(mb.foldConstants(cond)) {
+		if exp.Kind == parser.LiteralKind && exp.Literal.Kind == lexer.BoolKind && exp.Literal.Value == string(lexer.TrueKeyword) {
+			continue
+		}
+		kept = append(kept, exp)
+	}
+	return joinConjuncts(kept)
+}
+
+// 把表达式里不引用任何列的子表达式换成它的值, 原来的表达式不会被修改
+// 值是NULL的时候不折叠, 因为NULL字面量的类型和原来的表达式不一样
+// 计算出错的时候也不折叠, 等到真的要计算的时候再报错, 比如表是空的时候 1 / 0 不会报错
+func (mb *MemoryBackend) foldConstants(exp *parser.Expression) *parser.Expression {
+	switch exp.Kind {
+	case parser.UnaryKind:
+		exp = &parser.Expression{
+			Unary: &parser.UnaryExpression{
+				Operand: *mb.foldConstants(&exp.Unary.Operand),
+				Op:      exp.Unary.Op,
+			},
+			Kind: parser.UnaryKind,
+		}
+	case parser.BinaryKind:
+		exp = &parser.Expression{
+			Binary: &parser.BinaryExpression{
+				A:  *mb.foldConstants(&exp.Binary.A),
+				B:  *mb.foldConstants(&exp.Binary.B),
+				Op: exp.Binary.Op,
+			},
+			Kind: parser.BinaryKind,
+		}
+	case parser.InKind:
+		list := []*parser.Expression{}
+		for _, value := range exp.In.List {
+			list = append(list, mb.foldConstants(value))
+		}
+		exp = &parser.Expression{
+			In: &parser.InExpression{
+				Left:   *mb.foldConstants(&exp.In.Left),
+				List:   list,
+				Select: exp.In.Select,
+				Not:    exp.In.Not,
+			},
+			Kind: parser.InKind,
+		}
+	case parser.IsNullKind:
+		exp = &parser.Expression{
+			IsNull: &parser.IsNullExpression{
+				Operand: *mb.foldConstants(&exp.IsNull.Operand),
+				Not:     exp.IsNull.Not,
+			},
+			Kind: parser.IsNullKind,
+		}
+	case parser.FunctionKind:
+		// 函数调用本身不折叠, 只折叠参数, 比如 sum(a * (1 + 1))
+		args := []*parser.Expression{}
+		for _, arg := range exp.Function.Args {
+			args = append(args, mb.foldConstants(arg))
+		}
+		return &parser.Expression{
+			Function: &parser.FunctionCall{
+				Name: exp.Function.Name,
+				Args: args,
+				Star: exp.Function.Star,
+			},
+			Kind: parser.FunctionKind,
+		}
+	default:
+		// 字面量和子查询
+		return exp
+	}
+
+	// 不引用任何列, 没有子查询和函数调用, 并且类型正确的表达式才是常量
+	// 先检查类型是因为AND和OR是短路求值的, 比如 true OR 1 = 'a' 能算出值, 但是类型是错的
+	refs, err := referencedColumns(exp, nil)
+	if err != nil || len(refs) > 0 {
+		return exp
+	}
+	if _, err := mb.expressionType(nil, exp); err != nil {
+		return exp
+	}
+	cell, typ, err := mb.evaluateCell(&rowContext{}, exp)
+	if err != nil || cell.IsNull() {
+		return exp
+	}
+	return literalExpression(cell, typ)
+}
+
+// 值对应的字面量表达式
+func literalExpression(cell MemoryCell, typ ColumnType) *parser.Expression {
+	literal := &lexer.Token{}
+	switch typ {
+	case IntType:
+		literal.Kind = lexer.NumericKind
+		literal.Value = strconv.Itoa(int(cell.AsInt()))
+	case TextType:
+		literal.Kind = lexer.StringKind
+		literal.Value = cell.AsText()
+	case BoolType:
+		literal.Kind = lexer.BoolKind
+		literal.Value = string(lexer.FalseKeyword)
+		if cell.AsBool() {
+			literal.Value = string(lexer.TrueKeyword)
+		}
+	}
+	return &parser.Expression{
+		Literal: literal,
+		Kind:    parser.LiteralKind,
+	}
+}
+
+// 谓词下推: 把直接在FROM上面的WHERE按AND拆开, 每个条件尽量往下放, 放不下去的条件留在原来的位置
+// 连接条件里只引用一边的条件也可以放到那一边去
+func pushDownPredicates(plan *logicalPlan) *logicalPlan {
+	if plan.kind == fromLogicalKind {
+		pushDownJoinConditions(plan.from)
+		return plan
+	}
+
+	plan.input = pushDownPredicates(plan.input)
+	if plan.kind != filterLogicalKind || plan.input.kind != fromLogicalKind || plan.cond == nil {
+		return plan
+	}
+
+	kept := []*parser.Expression{}
+	for _, cond := range splitConjuncts(plan.cond) {
+		if !pushDownCondition(plan.input.from, cond) {
+			kept = append(kept, cond)
+		}
+	}
+	plan.cond = joinConjuncts(kept)
+	return plan
+}
+
+// 条件引用的列都在连接的哪一边, 引用了外层查询的列, 有子查询或者一列都没有引用的条件不能下推
+func conditionSide(plan *fromPlan, cond *parser.Expression) (bool, bool, bool) {
+	refs, err := referencedColumns(cond, plan.columns)
+	if err != nil || len(refs) == 0 {
+		return false, false, false
+	}
+	if plan.kind != joinPlanKind {
+		return false, false, true
+	}
+
+	left, right := true, true
+	for _, i := range refs {
+		if i < len(plan.left.columns) {
+			right = false
+		} else {
+			left = false
+		}
+	}
+	return left, right, true
+}
+
+// 把WHERE里的一个条件放到FROM里尽量下面的位置, 放不下去时返回false
+// 扫描上的条件在扫描的时候过滤, 内连接上的条件变成连接条件的一部分
+// 外连接里补NULL的一边不能提前过滤, 因为没有匹配上的行会变成NULL而不是消失
+func pushDownCondition(plan *fromPlan, cond *parser.Expression) bool {
+	left, right, ok := conditionSide(plan, cond)
+	if !ok {
+		return false
+	}
+
+	switch plan.kind {
+	case scanPlanKind, cteScanPlanKind, subqueryScanPlanKind:
+		plan.filters = append(plan.filters, cond)
+		return true
+	case joinPlanKind:
+		if left && plan.joinType != parser.RightJoin && plan.joinType != parser.FullJoin && pushDownCondition(plan.left, cond) {
+			return true
+		}
+		if right && plan.joinType != parser.LeftJoin && plan.joinType != parser.FullJoin && pushDownCondition(plan.right, cond) {
+			return true
+		}
+		if plan.joinType == parser.InnerJoin || plan.joinType == parser.CrossJoin {
+			conds := []*parser.Expression{}
+			if plan.on != nil {
+				conds = splitConjuncts(plan.on)
+			}
+			plan.on = joinConjuncts(append(conds, cond))
+			plan.joinType = parser.InnerJoin
+			return true
+		}
+	}
+	return false
+}
+
+// 连接条件里只引用一边的条件, 在那一边不会补NULL的时候可以放到那一边去:
+// 内连接的两边都可以, LEFT JOIN 只能放到右边, RIGHT JOIN 只能放到左边
+// 比如 LEFT JOIN 的条件只引用右边时, 不满足条件的右边的行反正也匹配不上
+func pushDownJoinConditions(plan *fromPlan) {
+	if plan.kind != joinPlanKind {
+		return
+	}
+
+	if plan.on != nil {
+		kept := []*parser.Expression{}
+		for _, cond := range splitConjuncts(plan.on) {
+			left, right, _ := conditionSide(plan, cond)
+			if left && (plan.joinType == parser.InnerJoin || plan.joinType == parser.RightJoin) && pushDownCondition(plan.left, cond) {
+				continue
+			}
+			if right && (plan.joinType == parser.InnerJoin || plan.joinType == parser.LeftJoin) && pushDownCondition(plan.right, cond) {
+				continue
+			}
+			kept = append(kept, cond)
+		}
+		plan.on = joinConjuncts(kept)
+	}
+	pushDownJoinConditions(plan.left)
+	pushDownJoinConditions(plan.right)
+}
+
+// 投影裁剪: FROM 里扫描的每张表只输出在FROM上面计算的表达式和连接条件里用到的列
+// 有子查询, 引用了外层查询的列或者列名有歧义的时候不裁剪, 出错的情况留给执行的时候报错
+func (plan *logicalPlan) pruneColumns() {
+	exps := []*parser.Expression{}
+	aggregated := false
+	for node := plan; node != nil; node = node.input {
+		if node.kind == aggregateLogicalKind {
+			aggregated = true
+		}
+	}
+
+	// 聚合上面的表达式引用的是聚合之后的列
+	var from *fromPlan
+	for node := plan; node != nil; node = node.input {
+		switch node.kind {
+		case fromLogicalKind:
+			from = node.from
+		case aggregateLogicalKind:
+			exps = append(exps, node.agg.groupBy...)
+			for _, call := range node.agg.calls {
+				exps = append(exps, call.fn.Args...)
+			}
+			aggregated = false
+		case filterLogicalKind:
+			if !aggregated && node.cond != nil {
+				exps = append(exps, node.cond)
+			}
+		case projectLogicalKind:
+			if aggregated {
+				continue
+			}
+			exps = append(exps, node.items...)
+			for _, item := range node.orderBy {
+				exps = append(exps, item.Exp)
+			}
+		}
+	}
+	exps = append(exps, from.joinConditions()...)
+
+	needed := make([]bool, len(from.columns))
+	for _, exp := range exps {
+		refs, err := referencedColumns(exp, from.columns)
+		if err != nil {
+			return
+		}
+		for _, i := range refs {
+			needed[i] = true
+		}
+	}
+	from.prune(needed)
+}
+
+// FROM 里所有的连接条件
+func (plan *fromPlan) joinConditions() []*parser.Expression {
+	if plan.kind != joinPlanKind {
+		return nil
+	}
+
+	conds := append(plan.left.joinConditions(), plan.right.joinConditions()...)
+	if plan.on != nil {
+		conds = append(conds, plan.on)
+	}
+	return conds
+}
+
+// 扫描表和CTE时去掉不需要的列, needed对应plan.columns里的每一列
+// 子查询的结果已经只有SELECT的列了, 所以不裁剪
+func (plan *fromPlan) prune(needed []bool) {
+	switch plan.kind {
+	case scanPlanKind, cteScanPlanKind:
+		output := []int{}
+		columns := []contextColumn{}
+		for i, ok := range needed {
+			if ok {
+				output = append(output, i)
+				columns = append(columns, plan.columns[i])
+			}
+		}
+		if len(output) < len(plan.columns) {
+			plan.output = output
+			plan.columns = columns
+		}
+	case joinPlanKind:
+		n := len(plan.left.columns)
+		plan.left.prune(needed[:n])
+		plan.right.prune(needed[n:])
+		plan.columns = append(append([]contextColumn{}, plan.left.columns...), plan.right.columns...)
+	}
+}
+
+// 生成物理计划, 返回最上面的算子和它输出的每一行里的列(包括外层查询的列)
+// 投影之后的行里只有值没有列名, 所以返回的列是nil
+func (mb *MemoryBackend) physicalPlan(plan *logicalPlan, outer *rowContext) (operator, []contextColumn) {
+	if plan.kind == fromLogicalKind {
+		plan.from = mb.orderJoins(plan.from)
+		mb.chooseFromStrategies(plan.from)
+		return &fromOperator{mb: mb, plan: plan.from}, scopeColumns(plan.from.columns, outer)
+	}
+
+	// 没有排序和去重的时候, LIMIT 放到投影的下面, 这样跳过的行和取够之后的行都不用计算SELECT的列
+	if plan.kind == limitLogicalKind && plan.input.kind == projectLogicalKind {
+		project := plan.input
+		input, columns := mb.physicalPlan(project.input, outer)
+		limit := &limitOperator{input: input, plan: plan}
+		return &projectOperator{mb: mb, input: limit, plan: project, columns: columns, outer: outer}, nil
+	}
+
+	input, columns := mb.physicalPlan(plan.input, outer)
+	switch plan.kind {
+	case filterLogicalKind:
+		// 条件都被下推或者折叠掉了
+		if plan.cond == nil {
+			return input, columns
+		}
+		return &filterOperator{mb: mb, input: input, plan: plan, columns: columns, outer: outer}, columns
+	case aggregateLogicalKind:
+		op := &aggregateOperator{mb: mb, input: input, agg: plan.agg, columns: columns, outer: outer}
+		return op, scopeColumns(plan.agg.outputColumns(), outer)
+	case projectLogicalKind:
+		return &projectOperator{mb: mb, input: input, plan: plan, columns: columns, outer: outer}, nil
+	case distinctLogicalKind:
+		return &distinctOperator{input: input, width: plan.width(), seen: map[string]bool{}}, nil
+	case sortLogicalKind:
+		return &sortOperator{input: input, plan: plan, width: plan.width()}, nil
+	}
+	return &limitOperator{input: input, plan: plan}, nil
+}
+
+// 投影之后每一行里SELECT的列数, 后面是排序键
+func (plan *logicalPlan) width() int {
+	for node := plan; node != nil; node = node.input {
+		if node.kind == projectLogicalKind {
+			return len(node.items)
+		}
+	}
+	return 0
+}
+
+// FROM 的物理计划: 给每个扫描表的计划选择要用的索引, 给每个连接选择执行方式
+// 先选两边的, 因为归并连接要看两边用的索引能不能按连接的列有序输出
+// 索引连接用索引里的位置找右边的行, 所以右边一定要扫描整张表
+func (mb *MemoryBackend) chooseFromStrategies(plan *fromPlan) {
+	switch plan.kind {
+	case scanPlanKind:
+		if len(plan.filters) > 0 {
+			plan.scan = mb.chooseIndex(plan, plan.filters)
+		}
+	case joinPlanKind:
+		mb.chooseFromStrategies(plan.left)
+		mb.chooseFromStrategies(plan.right)
+		plan.chooseJoinStrategy()
+		if plan.strategy == indexJoin {
+			plan.right.scan = nil
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/database-from-zero-to-one/lexer"
+	"github.com/database-from-zero-to-one/parser"
+)
+
+// ORDER BY 排序
+
+// 一个排序键的比较规则
+type sortKey struct {
+	Type       ColumnType
+	Desc       bool
+	NullsFirst bool
+}
+
+// 等待排序的一行, keys是这一行每个排序键的值
+type sortRow struct {
+	keys   []MemoryCell
+	result []Cell
+}
+
+// ORDER BY 里可以直接用SELECT里的别名, 比如 SELECT count(*) AS n ... ORDER BY n
+// 和PostgreSQL一样, 别名和表里的列重名时优先用别名
+// ORDER BY 里的整数是SELECT的第几列(从1开始, * 展开之后算), 比如 ORDER BY 2 DESC, 没有这一列时报错
+// exps是展开之后SELECT的每一列的表达式
+func resolveOrderBy(items []*parser.SelectItem, exps []*parser.Expression, orderBy []*parser.OrderByItem) ([]*parser.OrderByItem, error) {
+	resolved := []*parser.OrderByItem{}
+	for _, item := range orderBy {
+		resolved = append(resolved, item)
+		exp := item.Exp
+		if exp.Kind != parser.LiteralKind {
+			continue
+		}
+
+		var target *parser.Expression
+		switch {
+		case exp.Literal.Kind == lexer.NumericKind:
+			position, err := strconv.Atoi(exp.Literal.Value)
+			if err != nil || position < 1 || position > len(exps) {
+				return nil, fmt.Errorf("%w: ORDER BY position %s is not in select list", ErrInvalidOrderBy, exp.Literal.Value)
+			}
+			target = exps[position-1]
+		case exp.Literal.Kind == lexer.IdentifierKind && exp.Table == nil:
+			for _, selectItem := range items {
+				if selectItem.As != nil && selectItem.As.Value == exp.Literal.Value {
+					target = selectItem.Exp
+					break
+				}
+			}
+		}
+		if target != nil {
+			resolved[len(resolved)-1] = &parser.OrderByItem{
+				Exp:   target,
+				Desc:  item.Desc,
+				Nulls: item.Nulls,
+			}
+		}
+	}
+	return resolved, nil
+}
+
+// SELECT DISTINCT 去重之后只剩下SELECT里的列, 所以和PostgreSQL一样, ORDER BY 只能用SELECT里的表达式
+// 表达式一样, 或者都是引用同一列的列名(比如 id 和 users.id)才算同一个
+func checkDistinctOrderBy(columns []contextColumn, exps []*parser.Expression, orderBy []*parser.OrderByItem) error {
+	for _, item := range orderBy {
+		found := false
+		for _, exp := range exps {
+			if sameExpression(columns, item.Exp, exp) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: for SELECT DISTINCT, ORDER BY expressions must appear in select list: %s", ErrInvalidOrderBy, item.Exp)
+		}
+	}
+	return nil
+}
+
+func sameExpression(columns []contextColumn, a, b *parser.Expression) bool {
+	if a.String() == b.String() {
+		return true
+	}
+	isIdentifier := func(exp *parser.Expression) bool {
+		return exp.Kind == parser.LiteralKind && exp.Literal.Kind == lexer.IdentifierKind
+	}
+	if !isIdentifier(a) || !isIdentifier(b) {
+		return false
+	}
+	i, err := lookupIdentifier(columns, a)
+	if err != nil {
+		return false
+	}
+	j, err := lookupIdentifier(columns, b)
+	return err == nil && i == j
+}
+
+// 检查ORDER BY中每个表达式的类型, 并确定每个排序键的比较规则
+func (mb *MemoryBackend) orderByKeys(columns []contextColumn, orderBy []*parser.OrderByItem) ([]sortKey, error) {
+	keys := []sortKey{}
+	for _, item := range orderBy {
+		typ, err := mb.expressionType(columns, item.Exp)
+		if err != nil {
+			return nil, err
+		}
+
+		// 和PostgreSQL一样, 默认把NULL当作最大的值
+		nullsFirst := item.Desc
+		switch item.Nulls {
+		case parser.NullsFirstOrder:
+			nullsFirst = true
+		case parser.NullsLastOrder:
+			nullsFirst = false
+		}
+
+		keys = append(keys, sortKey{
+			Type:       typ,
+			Desc:       item.Desc,
+			NullsFirst: nullsFirst,
+		})
+	}
+	return keys, nil
+}
+
+// 计算某一行的所有排序键
+func (mb *MemoryBackend) evaluateSortKeys(ctx *rowContext, orderBy []*parser.OrderByItem) ([]MemoryCell, error) {
+	values := []MemoryCell{}
+	for _, item := range orderBy {
+		cell, _, err := mb.evaluateCell(ctx, item.Exp)
+		if err != nil {
+			return nil, fmt.Errorf("ORDER BY: %w", err)
+		}
+		values = append(values, cell)
+	}
+	return values, nil
+}
+
+// 按排序键逐个比较两行, a排在b前面返回负数, 相同返回0, 否则返回正数
+func compareSortKeys(keys []sortKey, a, b []MemoryCell) int {
+	for i, key := range keys {
+		// NULL(没有值)的位置只由NULLS FIRST/LAST决定, 和升序降序无关
+		aNull, bNull := a[i].IsNull(), b[i].IsNull()
+		if aNull || bNull {
+			if aNull && bNull {
+				continue
+			}
+			if aNull == key.NullsFirst {
+				return -1
+			}
+			return 1
+		}
+
+		cmp := compareCells(a[i], b[i], key.Type)
+		if key.Desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// 稳定排序, 排序键都相同的行保持原来的顺序
+func sortRows(keys []sortKey, rows []sortRow) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		return compareSortKeys(keys, rows[i].keys, rows[j].keys) < 0
+	})
+}
+
+// 排序之后再跳过前offset行, 最多保留limit行, limit为-1时不限制
+func sortAndLimit(keys []sortKey, rows []sortRow, limit, offset int) [][]Cell {
+	sortRows(keys, rows)
+
+	results := [][]Cell{}
+	for i, row := range rows {
+		if i < offset {
+			continue
+		}
+		if limit >= 0 && len(results) >= limit {
+			break
+		}
+		results = append(results, row.result)
+	}
+	return results
+}
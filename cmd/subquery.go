@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/database-from-zero-to-one/parser"
+)
+
+// 子查询
+// 子查询在外层查询的每一行上执行一次, 子查询里可以引用外层查询的列(相关子查询)
+// 类型检查的时候只检查子查询的类型, 不执行子查询
+
+// 标量子查询只能有一列, 结果的类型就是这一列的类型
+func (mb *MemoryBackend) scalarSubqueryType(columns []contextColumn, slct *parser.SelectStatement) (ColumnType, error) {
+	results, err := mb.query(slct, &rowContext{columns: columns}, true)
+	if err != nil {
+		return 0, err
+	}
+	if len(results.Columns) != 1 {
+		return 0, fmt.Errorf("%w: subquery must return only one column, got %d", ErrInvalidSubquery, len(results.Columns))
+	}
+	return results.Columns[0].Type, nil
+}
+
+// 标量子查询最多只能返回一行, 一行都没有的时候结果是NULL
+func (mb *MemoryBackend) evaluateScalarSubquery(ctx *rowContext, slct *parser.SelectStatement) (MemoryCell, ColumnType, error) {
+	results, err := mb.query(slct, ctx, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(results.Columns) != 1 {
+		return nil, 0, fmt.Errorf("%w: subquery must return only one column, got %d", ErrInvalidSubquery, len(results.Columns))
+	}
+
+	typ := results.Columns[0].Type
+	switch len(results.Rows) {
+	case 0:
+		return nullCell(), typ, nil
+	case 1:
+		return results.Rows[0][0].(MemoryCell), typ, nil
+	}
+	return nil, 0, fmt.Errorf("%w: more than one row returned by a subquery used as an expression", ErrInvalidSubquery)
+}
+
+// IN 右边的每一个值(或者子查询的那一列)都要和左边的类型一样, 结果是bool
+func (mb *MemoryBackend) inType(columns []contextColumn, in *parser.InExpression) (ColumnType, error) {
+	left, err := mb.expressionType(columns, &in.Left)
+	if err != nil {
+		return 0, err
+	}
+
+	types := []ColumnType{}
+	for _, exp := range in.List {
+		typ, err := mb.expressionType(columns, exp)
+		if err != nil {
+			return 0, err
+		}
+		types = append(types, typ)
+	}
+	if in.Select != nil {
+		typ, err := mb.scalarSubqueryType(columns, in.Select)
+		if err != nil {
+			return 0, err
+		}
+		types = append(types, typ)
+	}
+
+	for _, typ := range types {
+		if _, ok := commonType(left, typ); !ok {
+			return 0, fmt.Errorf("%w: cannot compare %s with %s in IN", ErrTypeMismatch, left, typ)
+		}
+	}
+	return BoolType, nil
+}
+
+// 左边的值和右边的任意一个值相等时IN的结果为true, NOT IN 正好相反
+// 和 = 一样, 没有相等的值但是左边或者右边有NULL时, 不知道到底相不相等, 结果是NULL
+func (mb *MemoryBackend) evaluateIn(ctx *rowContext, in *parser.InExpression) (MemoryCell, ColumnType, error) {
+	left, typ, err := mb.evaluateCell(ctx, &in.Left)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	values := []MemoryCell{}
+	for _, exp := range in.List {
+		cell, _, err := mb.evaluateCell(ctx, exp)
+		if err != nil {
+			return nil, 0, err
+		}
+		values = append(values, cell)
+	}
+	if in.Select != nil {
+		results, err := mb.query(in.Select, ctx, false)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, row := range results.Rows {
+			values = append(values, row[0].(MemoryCell))
+		}
+	}
+
+	null := left.IsNull()
+	for _, value := range values {
+		if value.IsNull() {
+			null = true
+			continue
+		}
+		if !left.IsNull() && compareCells(left, value, typ) == 0 {
+			return boolCell(!in.Not), BoolType, nil
+		}
+	}
+	if null {
+		return nullCell(), BoolType, nil
+	}
+	return boolCell(in.Not), BoolType, nil
+}
@@ -18,18 +18,78 @@ type Keyword string
 
 // 定义默认的关键字
 const (
-	SelectKeyword Keyword = "select"
-	IntoKeyword   Keyword = "into"
-	FromKeyword   Keyword = "from"
-	CreateKeyword Keyword = "create"
-	CreatedKeyword Keyword = "created"
-	AsKeyword     Keyword = "as"
-	TableKeyword  Keyword = "table"
-	InsertKeyword Keyword = "insert"
-	WhereKeyword  Keyword = "where"
-	ValuesKeyword Keyword = "values"
-	IntKeyword    Keyword = "int"  // 代表支持int类型
-	TextKeyword   Keyword = "text" // 代表支持text类型
+	SelectKeyword     Keyword = "select"
+	IntoKeyword       Keyword = "into"
+	FromKeyword       Keyword = "from"
+	CreateKeyword     Keyword = "create"
+	CreatedKeyword    Keyword = "created"
+	AsKeyword         Keyword = "as"
+	TableKeyword      Keyword = "table"
+	InsertKeyword     Keyword = "insert"
+	WhereKeyword      Keyword = "where"
+	ValuesKeyword     Keyword = "values"
+	IntKeyword        Keyword = "int"  // 代表支持int类型
+	TextKeyword       Keyword = "text" // 代表支持text类型
+	AndKeyword        Keyword = "and"
+	OrKeyword         Keyword = "or"
+	NotKeyword        Keyword = "not"
+	BoolKeyword       Keyword = "bool"  // 代表支持bool类型
+	TrueKeyword       Keyword = "true"  // 布尔字面量
+	FalseKeyword      Keyword = "false" // 布尔字面量
+	UpdateKeyword     Keyword = "update"
+	SetKeyword        Keyword = "set"
+	DeleteKeyword     Keyword = "delete"
+	DropKeyword       Keyword = "drop"
+	IfKeyword         Keyword = "if"
+	ExistsKeyword     Keyword = "exists"
+	AlterKeyword      Keyword = "alter"
+	AddKeyword        Keyword = "add"
+	ColumnKeyword     Keyword = "column"
+	RenameKeyword     Keyword = "rename"
+	ToKeyword         Keyword = "to"
+	DefaultKeyword    Keyword = "default"
+	OrderKeyword      Keyword = "order"
+	ByKeyword         Keyword = "by"
+	AscKeyword        Keyword = "asc"
+	DescKeyword       Keyword = "desc"
+	NullsKeyword      Keyword = "nulls"
+	FirstKeyword      Keyword = "first"
+	LastKeyword       Keyword = "last"
+	LimitKeyword      Keyword = "limit"
+	OffsetKeyword     Keyword = "offset"
+	GroupKeyword      Keyword = "group"
+	HavingKeyword     Keyword = "having"
+	JoinKeyword       Keyword = "join"
+	InnerKeyword      Keyword = "inner"
+	LeftKeyword       Keyword = "left"
+	RightKeyword      Keyword = "right"
+	FullKeyword       Keyword = "full"
+	OuterKeyword      Keyword = "outer"
+	CrossKeyword      Keyword = "cross"
+	OnKeyword         Keyword = "on"
+	ExplainKeyword    Keyword = "explain"
+	DistinctKeyword   Keyword = "distinct"
+	UnionKeyword      Keyword = "union"
+	AllKeyword        Keyword = "all"
+	IntersectKeyword  Keyword = "intersect"
+	ExceptKeyword     Keyword = "except"
+	InKeyword         Keyword = "in"
+	WithKeyword       Keyword = "with"
+	RecursiveKeyword  Keyword = "recursive"
+	NullKeyword       Keyword = "null" // 空值字面量
+	IsKeyword         Keyword = "is"
+	UniqueKeyword     Keyword = "unique"
+	CheckKeyword      Keyword = "check"
+	ConstraintKeyword Keyword = "constraint"
+	PrimaryKeyword    Keyword = "primary"
+	KeyKeyword        Keyword = "key"
+	ForeignKeyword    Keyword = "foreign"
+	ReferencesKeyword Keyword = "references"
+	CascadeKeyword    Keyword = "cascade"
+	RestrictKeyword   Keyword = "restrict"
+	IndexKeyword      Keyword = "index"
+	UsingKeyword      Keyword = "using"
+	AnalyzeKeyword    Keyword = "analyze"
 )
 
 // 定义标志(比如括号这种)
@@ -41,6 +101,17 @@ const (
 	CommaSymbol        Symbol = ","
 	LeftBracketSymbol  Symbol = "("
 	RightBracketSymbol Symbol = ")"
+	EqualSymbol        Symbol = "="
+	NotEqualSymbol     Symbol = "<>"
+	LessSymbol         Symbol = "<"
+	LessEqualSymbol    Symbol = "<="
+	GreaterSymbol      Symbol = ">"
+	GreaterEqualSymbol Symbol = ">="
+	PlusSymbol         Symbol = "+"
+	MinusSymbol        Symbol = "-"
+	SlashSymbol        Symbol = "/"
+	PercentSymbol      Symbol = "%"
+	DotSymbol          Symbol = "." // 限定列名, 比如 t.col
 )
 
 // 定义token的各种类型
@@ -52,6 +123,8 @@ const (
 	IdentifierKind                  // 标识符
 	StringKind                      // 字符串
 	NumericKind                     // 数字
+	BoolKind                        // 布尔值(true/false)
+	NullKind                        // 空值(null)
 )
 
 // 定义Token,一个token必须有值 类型 位置
@@ -208,7 +281,68 @@ func lexKeyword(source string, ic cursor) (*Token, cursor, bool) {
 		TextKeyword,
 		CreateKeyword,
 		CreatedKeyword,
+		AsKeyword,
 		IntKeyword,
+		AndKeyword,
+		OrKeyword,
+		NotKeyword,
+		BoolKeyword,
+		TrueKeyword,
+		FalseKeyword,
+		UpdateKeyword,
+		SetKeyword,
+		DeleteKeyword,
+		DropKeyword,
+		IfKeyword,
+		ExistsKeyword,
+		AlterKeyword,
+		AddKeyword,
+		ColumnKeyword,
+		RenameKeyword,
+		ToKeyword,
+		DefaultKeyword,
+		OrderKeyword,
+		ByKeyword,
+		AscKeyword,
+		DescKeyword,
+		NullsKeyword,
+		FirstKeyword,
+		LastKeyword,
+		LimitKeyword,
+		OffsetKeyword,
+		GroupKeyword,
+		HavingKeyword,
+		JoinKeyword,
+		InnerKeyword,
+		LeftKeyword,
+		RightKeyword,
+		FullKeyword,
+		OuterKeyword,
+		CrossKeyword,
+		OnKeyword,
+		ExplainKeyword,
+		DistinctKeyword,
+		UnionKeyword,
+		AllKeyword,
+		IntersectKeyword,
+		ExceptKeyword,
+		InKeyword,
+		WithKeyword,
+		RecursiveKeyword,
+		NullKeyword,
+		IsKeyword,
+		UniqueKeyword,
+		CheckKeyword,
+		ConstraintKeyword,
+		PrimaryKeyword,
+		KeyKeyword,
+		ForeignKeyword,
+		ReferencesKeyword,
+		CascadeKeyword,
+		RestrictKeyword,
+		IndexKeyword,
+		UsingKeyword,
+		AnalyzeKeyword,
 	}
 	var options []string
 	for _, k := range Keywords {
@@ -221,13 +355,27 @@ func lexKeyword(source string, ic cursor) (*Token, cursor, bool) {
 		return nil, ic, false
 	}
 
+	// 关键字后面不能紧跟着标识符字符, 否则像order这样的标识符会被拆成or和der
+	if next := ic.pointer + uint(len(match)); next < uint(len(source)) && isIdentifierChar(source[next]) {
+		return nil, ic, false
+	}
+
 	// 比如match == "create"， 那pointer就要从原来的值(初始为0)增加到len("create"), ic.loc.Col也要增加
 	cur.pointer = ic.pointer + uint(len(match))
 	cur.loc.Col = ic.loc.Col + uint(len(match))
 
+	// true和false虽然按关键字的方式解析, 但它们其实是布尔字面量, null也一样是字面量
+	kind := KeywordKind
+	switch match {
+	case string(TrueKeyword), string(FalseKeyword):
+		kind = BoolKind
+	case string(NullKeyword):
+		kind = NullKind
+	}
+
 	return &Token{
 		Value: match,
-		Kind:  KeywordKind,
+		Kind:  kind,
 		Loc:   ic.loc,
 	}, cur, true
 }
@@ -251,15 +399,31 @@ func lexSymbol(source string, ic cursor) (*Token, cursor, bool) {
 		fallthrough
 	case ' ':
 		return nil, cur, true // 这样并不算错,但是得不到有效的token
+	case '.':
+		// .001 这样的是数字, 留给lexNumeric解析
+		if cur.pointer < uint(len(source)) && source[cur.pointer] >= '0' && source[cur.pointer] <= '9' {
+			return nil, ic, false
+		}
 	}
 	// 应该被保留的语法
 	// 有效的symbol集合
 	symbols := []Symbol{
-		CommaSymbol, 
-		AsterisSymbol, 
-		SemicolonSymbol, 
-		LeftBracketSymbol, 
+		CommaSymbol,
+		AsterisSymbol,
+		SemicolonSymbol,
+		LeftBracketSymbol,
 		RightBracketSymbol,
+		EqualSymbol,
+		NotEqualSymbol,
+		LessSymbol,
+		LessEqualSymbol,
+		GreaterSymbol,
+		GreaterEqualSymbol,
+		PlusSymbol,
+		MinusSymbol,
+		SlashSymbol,
+		PercentSymbol,
+		DotSymbol,
 	}
 	// TODO
 	var options []string
@@ -311,9 +475,7 @@ func lexIdentifier(source string, ic cursor) (*Token, cursor, bool) {
 		c = source[cur.pointer]
 
 		// 其他的字符也算
-		isAlphabetical := (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
-		isNumeric := c >= '0' && c <= '9'
-		if isAlphabetical || isNumeric || c == '$' || c == '_' {
+		if isIdentifierChar(c) {
 			value = append(value, c)
 			cur.loc.Col++
 			continue
@@ -333,6 +495,13 @@ func lexIdentifier(source string, ic cursor) (*Token, cursor, bool) {
 	}, cur, true
 }
 
+// 判断字符能否出现在标识符中(首字符除外)
+func isIdentifierChar(c byte) bool {
+	isAlphabetical := (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+	isNumeric := c >= '0' && c <= '9'
+	return isAlphabetical || isNumeric || c == '$' || c == '_'
+}
+
 // function lexString 代表字符串解析
 // 字符串必须以单引号开头,单引号结尾
 func lexString(source string, ic cursor) (*Token, cursor, bool) {
@@ -371,7 +540,7 @@ func lexCharacterDelimited(source string, ic cursor, delimiter byte) (*Token, cu
 				cur.loc.Col++
 				return &Token{
 					Value: string(value),
-					Loc:   ic.loc,  // 注意
+					Loc:   ic.loc, // 注意
 					Kind:  StringKind,
 				}, cur, true
 			}
@@ -434,8 +603,5 @@ func longestMatch(source string, ic cursor, options []string) string {
 			break
 		}
 	}
-	fmt.Printf("+++++++skipList 的值是%v\n", skipList)
-	fmt.Printf("-----------------------------------------------------------------------------------------------------cur.Pointer的值是 %d\n", cur.pointer)
-	fmt.Printf("===============================================match的结果值是%s\n", match)
 	return match
 }
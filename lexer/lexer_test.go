@@ -143,10 +143,34 @@ func TestToken_lexSymbol(t *testing.T) {
 		symbol bool
 		value  string
 	}{
-		// {
-		// 	symbol: true,
-		// 	value:  "= ",
-		// },
+		{
+			symbol: true,
+			value:  "= ",
+		},
+		{
+			symbol: true,
+			value:  "<>",
+		},
+		{
+			symbol: true,
+			value:  "<=",
+		},
+		{
+			symbol: true,
+			value:  ">=",
+		},
+		{
+			symbol: true,
+			value:  "<",
+		},
+		{
+			symbol: true,
+			value:  "%",
+		},
+		{
+			symbol: true,
+			value:  ".",
+		},
 		// {
 		// 	symbol: true,
 		// 	value:  "||",
@@ -159,6 +183,11 @@ func TestToken_lexSymbol(t *testing.T) {
 			symbol: true,
 			value:  ";",
 		},
+		// false tests
+		{
+			symbol: false,
+			value:  ".001",
+		},
 	}
 
 	for _, test := range tests {
@@ -253,10 +282,10 @@ func TestToken_lexKeyword(t *testing.T) {
 			keyword: true,
 			value:   "from",
 		},
-		// {
-		// 	keyword: true,
-		// 	value:   "as",
-		// },
+		{
+			keyword: true,
+			value:   "as",
+		},
 		{
 			keyword: true,
 			value:   "SELECT",
@@ -265,11 +294,119 @@ func TestToken_lexKeyword(t *testing.T) {
 			keyword: true,
 			value:   "into",
 		},
+		{
+			keyword: true,
+			value:   "and",
+		},
+		{
+			keyword: true,
+			value:   "or ",
+		},
+		{
+			keyword: true,
+			value:   "order",
+		},
+		{
+			keyword: true,
+			value:   "LEFT ",
+		},
+		{
+			keyword: true,
+			value:   "on",
+		},
+		{
+			keyword: true,
+			value:   "in ",
+		},
+		{
+			keyword: true,
+			value:   "WITH ",
+		},
+		{
+			keyword: true,
+			value:   "is ",
+		},
+		{
+			keyword: true,
+			value:   "UNIQUE ",
+		},
+		{
+			keyword: true,
+			value:   "check ",
+		},
+		{
+			keyword: true,
+			value:   "constraint ",
+		},
+		{
+			keyword: true,
+			value:   "PRIMARY ",
+		},
+		{
+			keyword: true,
+			value:   "key",
+		},
+		{
+			keyword: true,
+			value:   "references ",
+		},
+		{
+			keyword: true,
+			value:   "INDEX ",
+		},
+		{
+			keyword: true,
+			value:   "using ",
+		},
+		{
+			keyword: true,
+			value:   "ANALYZE ",
+		},
 		// false tests
 		{
 			keyword: false,
 			value:   " into",
 		},
+		{
+			keyword: false,
+			value:   "orders",
+		},
+		{
+			keyword: false,
+			value:   "integer",
+		},
+		{
+			keyword: false,
+			value:   "online",
+		},
+		{
+			keyword: false,
+			value:   "income",
+		},
+		{
+			keyword: false,
+			value:   "indexes",
+		},
+		{
+			keyword: false,
+			value:   "width",
+		},
+		{
+			keyword: false,
+			value:   "island",
+		},
+		{
+			keyword: false,
+			value:   "nullable",
+		},
+		{
+			keyword: false,
+			value:   "checked",
+		},
+		{
+			keyword: false,
+			value:   "keys",
+		},
 		// {
 		// 	keyword: false,
 		// 	value:   "flubbrety",
@@ -307,21 +444,76 @@ func TestLex(t *testing.T) {
 				},
 			},
 		},
-		// {
-		// 	input: "select true",
-		// 	Tokens: []Token{
-		// 		{
-		// 			Loc:   Location{Col: 0, Line: 0},
-		// 			Value: string(SelectKeyword),
-		// 			Kind:  KeywordKind,
-		// 		},
-		// 		{
-		// 			Loc:   Location{Col: 7, Line: 0},
-		// 			Value: "true",
-		// 			Kind:  BoolKind,
-		// 		},
-		// 	},
-		// },
+		{
+			input: "select true",
+			Tokens: []Token{
+				{
+					Loc:   Location{Col: 0, Line: 0},
+					Value: string(SelectKeyword),
+					Kind:  KeywordKind,
+				},
+				{
+					Loc:   Location{Col: 7, Line: 0},
+					Value: "true",
+					Kind:  BoolKind,
+				},
+			},
+		},
+		{
+			input: "select NULL",
+			Tokens: []Token{
+				{
+					Loc:   Location{Col: 0, Line: 0},
+					Value: string(SelectKeyword),
+					Kind:  KeywordKind,
+				},
+				{
+					Loc:   Location{Col: 7, Line: 0},
+					Value: "null",
+					Kind:  NullKind,
+				},
+			},
+		},
+		{
+			input: "select u.id",
+			Tokens: []Token{
+				{
+					Loc:   Location{Col: 0, Line: 0},
+					Value: string(SelectKeyword),
+					Kind:  KeywordKind,
+				},
+				{
+					Loc:   Location{Col: 7, Line: 0},
+					Value: "u",
+					Kind:  IdentifierKind,
+				},
+				{
+					Loc:   Location{Col: 8, Line: 0},
+					Value: string(DotSymbol),
+					Kind:  SymbolKind,
+				},
+				{
+					Loc:   Location{Col: 9, Line: 0},
+					Value: "id",
+					Kind:  IdentifierKind,
+				},
+			},
+		},
+		{
+			input: "select .5",
+			Tokens: []Token{
+				{
+					Loc:   Location{Col: 0, Line: 0},
+					Value: string(SelectKeyword),
+					Kind:  KeywordKind,
+				},
+				{
+					Loc:   Location{Col: 7, Line: 0},
+					Value: ".5",
+					Kind:  NumericKind,
+				},
+			},
+		},
 		{
 			input: "select 1",
 			Tokens: []Token{
@@ -3,6 +3,7 @@ package parser
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/database-from-zero-to-one/lexer"
 )
@@ -18,50 +19,579 @@ const (
 	SelectKind AstKind = iota
 	CreateKind
 	InsertKind
+	UpdateKind
+	DeleteKind
+	DropTableKind
+	AlterTableKind
+	ExplainKind
+	CreateIndexKind
+	DropIndexKind
+	AnalyzeKind
 )
 
 type Statement struct {
-	SelectStatement *SelectStatement
-	CreateStatement *CreateStatement
-	InsertStatement *InsertStatement
-	Kind            AstKind
+	SelectStatement      *SelectStatement
+	CreateStatement      *CreateStatement
+	InsertStatement      *InsertStatement
+	UpdateStatement      *UpdateStatement
+	DeleteStatement      *DeleteStatement
+	DropTableStatement   *DropTableStatement
+	AlterTableStatement  *AlterTableStatement
+	ExplainStatement     *ExplainStatement
+	CreateIndexStatement *CreateIndexStatement
+	DropIndexStatement   *DropIndexStatement
+	AnalyzeStatement     *AnalyzeStatement
+	Kind                 AstKind
 }
 
-// Insert语句目前只有一个表名和一列值来插入
+// Insert语句有一个表名, 可选的列名, 以及要插入的多行值或者一个查询
 type InsertStatement struct {
-	Table  lexer.Token
-	Values *[]*Expression
+	Table   lexer.Token
+	Columns []*lexer.Token   // 要插入的列, 没有写时按建表的顺序插入所有的列
+	Values  [][]*Expression  // VALUES 后面的每一行, INSERT ... SELECT 时为空
+	Select  *SelectStatement // INSERT ... SELECT 里的查询, 没有时为nil
 }
 
 type ExpressionKind uint
 
 const (
-	LiteralKind ExpressionKind = iota
+	LiteralKind  ExpressionKind = iota
+	BinaryKind                  // 二元表达式, 比如 a = 1
+	UnaryKind                   // 一元表达式, 比如 NOT a, -1
+	FunctionKind                // 函数调用, 比如 COUNT(*), SUM(a)
+	SubqueryKind                // 标量子查询, 比如 (SELECT max(id) FROM t)
+	ExistsKind                  // EXISTS (SELECT ...)
+	InKind                      // a IN (1, 2, 3) 或者 a IN (SELECT ...)
+	IsNullKind                  // a IS NULL 或者 a IS NOT NULL
 )
 
+// 二元表达式由左右两个操作数和一个操作符组成
+type BinaryExpression struct {
+	A  Expression
+	B  Expression
+	Op lexer.Token
+}
+
+// 一元表达式由一个前缀操作符和一个操作数组成
+type UnaryExpression struct {
+	Operand Expression
+	Op      lexer.Token
+}
+
+// 函数调用由函数名和参数组成, COUNT(*) 这样的写法没有参数而是Star为true
+type FunctionCall struct {
+	Name lexer.Token
+	Args []*Expression
+	Star bool
+}
+
+// IN 由左边的表达式和右边的一组值组成, 右边的值可以直接列出来, 也可以是一个子查询的结果
+type InExpression struct {
+	Left   Expression
+	List   []*Expression    // IN (1, 2, 3) 里的每一个值, 是子查询时为空
+	Select *SelectStatement // IN (SELECT ...) 里的子查询, 直接列出值时为nil
+	Not    bool             // NOT IN
+}
+
+// IS [NOT] NULL 判断一个表达式是不是NULL
+type IsNullExpression struct {
+	Operand Expression
+	Not     bool // IS NOT NULL
+}
+
 // 一个表达式就是一系列的字面token或者未来可能加入的函数调用或者内联操作
 type Expression struct {
-	Literal *lexer.Token
-	Kind    ExpressionKind
+	Literal  *lexer.Token
+	Table    *lexer.Token // 限定列名里的表名, 比如 t.col 里的 t, 没有限定时为nil
+	Binary   *BinaryExpression
+	Unary    *UnaryExpression
+	Function *FunctionCall
+	Select   *SelectStatement // SubqueryKind 和 ExistsKind 里的子查询
+	In       *InExpression
+	IsNull   *IsNullExpression
+	Kind     ExpressionKind
+}
+
+// 把表达式转换回SQL, 比如EXPLAIN的输出里会用到
+// 只在需要的地方加括号, 比如 (a + b) * c
+func (exp *Expression) String() string {
+	switch exp.Kind {
+	case LiteralKind:
+		switch exp.Literal.Kind {
+		case lexer.StringKind:
+			// 词法解析时字符串里的 '' 是原样保留的, 所以不用再转义
+			return "'" + exp.Literal.Value + "'"
+		case lexer.IdentifierKind:
+			if exp.Table != nil {
+				return exp.Table.Value + "." + exp.Literal.Value
+			}
+		}
+		return exp.Literal.Value
+	case UnaryKind:
+		operand := exp.Unary.Operand.String()
+		if exp.Unary.Operand.Kind == BinaryKind {
+			operand = "(" + operand + ")"
+		}
+		if exp.Unary.Op.Kind == lexer.KeywordKind {
+			return exp.Unary.Op.Value + " " + operand
+		}
+		return exp.Unary.Op.Value + operand
+	case BinaryKind:
+		power := binaryPower(&exp.Binary.Op)
+		a := exp.Binary.A.String()
+		if p := expressionPower(&exp.Binary.A); p != noPower && p < power {
+			a = "(" + a + ")"
+		}
+		// 同级的操作符是左结合的, 所以右边同级的也要加括号, 比如 a - (b - c)
+		b := exp.Binary.B.String()
+		if p := expressionPower(&exp.Binary.B); p != noPower && p <= power {
+			b = "(" + b + ")"
+		}
+		return a + " " + exp.Binary.Op.Value + " " + b
+	case FunctionKind:
+		if exp.Function.Star {
+			return exp.Function.Name.Value + "(*)"
+		}
+		args := []string{}
+		for _, arg := range exp.Function.Args {
+			args = append(args, arg.String())
+		}
+		return exp.Function.Name.Value + "(" + strings.Join(args, ", ") + ")"
+	case SubqueryKind:
+		return "(" + exp.Select.String() + ")"
+	case ExistsKind:
+		return string(lexer.ExistsKeyword) + " (" + exp.Select.String() + ")"
+	case InKind:
+		left := exp.In.Left.String()
+		if p := expressionPower(&exp.In.Left); p != noPower && p < comparisonPower {
+			left = "(" + left + ")"
+		}
+		op := string(lexer.InKeyword)
+		if exp.In.Not {
+			op = string(lexer.NotKeyword) + " " + op
+		}
+
+		values := []string{}
+		for _, value := range exp.In.List {
+			values = append(values, value.String())
+		}
+		if exp.In.Select != nil {
+			values = append(values, exp.In.Select.String())
+		}
+		return left + " " + op + " (" + strings.Join(values, ", ") + ")"
+	case IsNullKind:
+		operand := exp.IsNull.Operand.String()
+		if p := expressionPower(&exp.IsNull.Operand); p != noPower && p < comparisonPower {
+			operand = "(" + operand + ")"
+		}
+		op := string(lexer.IsKeyword) + " "
+		if exp.IsNull.Not {
+			op += string(lexer.NotKeyword) + " "
+		}
+		return operand + " " + op + string(lexer.NullKeyword)
+	}
+	return "?"
+}
+
+// 表达式最外层的操作符的优先级, 不是二元操作符、IN或者IS NULL时返回noPower, 转换回SQL时用来决定要不要加括号
+func expressionPower(exp *Expression) uint {
+	switch exp.Kind {
+	case BinaryKind:
+		return binaryPower(&exp.Binary.Op)
+	case InKind, IsNullKind:
+		return comparisonPower
+	}
+	return noPower
+}
+
+// 把查询转换回SQL, 子查询转换回SQL时会用到
+func (slct *SelectStatement) String() string {
+	var s string
+	if slct.With != nil {
+		s = string(lexer.WithKeyword) + " "
+		if slct.With.Recursive {
+			s += string(lexer.RecursiveKeyword) + " "
+		}
+		ctes := []string{}
+		for _, cte := range slct.With.Ctes {
+			ctes = append(ctes, cte.String())
+		}
+		s += strings.Join(ctes, ", ") + " "
+	}
+	if slct.Compound != nil {
+		s += slct.Compound.Left.String() + " " + slct.Compound.Operator.String()
+		if slct.Compound.All {
+			s += " " + string(lexer.AllKeyword)
+		}
+		s += " " + slct.Compound.Right.String()
+	} else {
+		s += string(lexer.SelectKeyword)
+		if slct.Distinct {
+			s += " " + string(lexer.DistinctKeyword)
+		}
+
+		items := []string{}
+		for _, item := range slct.Item {
+			items = append(items, item.String())
+		}
+		s += " " + strings.Join(items, ", ")
+
+		if len(slct.From) > 0 {
+			refs := []string{}
+			for _, ref := range slct.From {
+				refs = append(refs, ref.String())
+			}
+			s += " " + string(lexer.FromKeyword) + " " + strings.Join(refs, ", ")
+		}
+		if slct.Where != nil {
+			s += " " + string(lexer.WhereKeyword) + " " + slct.Where.String()
+		}
+		if len(slct.GroupBy) > 0 {
+			groupBy := []string{}
+			for _, exp := range slct.GroupBy {
+				groupBy = append(groupBy, exp.String())
+			}
+			s += " " + string(lexer.GroupKeyword) + " " + string(lexer.ByKeyword) + " " + strings.Join(groupBy, ", ")
+		}
+		if slct.Having != nil {
+			s += " " + string(lexer.HavingKeyword) + " " + slct.Having.String()
+		}
+	}
+
+	if len(slct.OrderBy) > 0 {
+		orderBy := []string{}
+		for _, item := range slct.OrderBy {
+			orderBy = append(orderBy, item.String())
+		}
+		s += " " + string(lexer.OrderKeyword) + " " + string(lexer.ByKeyword) + " " + strings.Join(orderBy, ", ")
+	}
+	if slct.Limit != nil {
+		s += " " + string(lexer.LimitKeyword) + " " + slct.Limit.String()
+	}
+	if slct.Offset != nil {
+		s += " " + string(lexer.OffsetKeyword) + " " + slct.Offset.String()
+	}
+	return s
 }
 
 // Create语句有一个表名和一列列名和类型
 type CreateStatement struct {
-	Table lexer.Token          // 表名
-	Cols  *[]*ColumnDefinition // 列的信息
+	Table       lexer.Token          // 表名
+	Cols        *[]*ColumnDefinition // 列的信息
+	Constraints []*Constraint        // 和列一起写在括号里的表约束, 比如 UNIQUE (a, b)
+	IfNotExists bool                 // CREATE TABLE IF NOT EXISTS, 表已经存在时不报错
 }
 
 type ColumnDefinition struct {
-	Name     lexer.Token // 列名
-	Datatype lexer.Token // 每列的类型
+	Name        lexer.Token   // 列名
+	Datatype    lexer.Token   // 每列的类型
+	Default     *Expression   // 默认值, 没有DEFAULT时为nil
+	Constraints []*Constraint // 写在列后面的约束, 只约束这一列
+}
+
+type ConstraintKind uint
+
+const (
+	NotNullConstraint    ConstraintKind = iota // NOT NULL, 只能写在列的后面
+	UniqueConstraint                           // UNIQUE
+	CheckConstraint                            // CHECK ($expression)
+	PrimaryKeyConstraint                       // PRIMARY KEY
+	ForeignKeyConstraint                       // REFERENCES, 写成表约束时是 FOREIGN KEY ($column [, ...]) REFERENCES
+)
+
+// 被引用的行被删除或者被引用的列被修改时, 引用它的行要怎么办
+type ReferentialAction uint
+
+const (
+	RestrictAction ReferentialAction = iota // 默认, 还有行引用它的时候不允许删除或修改
+	CascadeAction                           // 引用它的行也一起删除, 或者一起改成新的值
+	SetNullAction                           // 引用它的列改成NULL
+)
+
+// 外键引用的表和列, 以及被引用的行变化时要执行的动作
+type ForeignKeyReference struct {
+	Table    lexer.Token
+	Columns  []*lexer.Token // 被引用的列, 没有写时引用的是那张表的主键
+	OnDelete ReferentialAction
+	OnUpdate ReferentialAction
+}
+
+// 约束可以写在列的后面, 也可以作为表的一项单独写
+// 表约束要写出约束的是哪些列, 列约束约束的就是它所在的那一列
+type Constraint struct {
+	Name       *lexer.Token // CONSTRAINT $name 给约束起的名字, 没有时为nil
+	Kind       ConstraintKind
+	Columns    []*lexer.Token       // 表约束 UNIQUE/PRIMARY KEY/FOREIGN KEY ($column [, ...]) 里的列, 列约束时为空
+	Check      *Expression          // CHECK 的条件
+	References *ForeignKeyReference // 外键引用的表和列
 }
 
 // Select语句有一个表名和一列列的名字
 type SelectStatement struct {
 	// table lexer.Token // 表的名字
 	// colnames *[]*Token // 列的名字集合
-	Item []*Expression //列的名字
-	From lexer.Token   // 表名
+	With     *WithClause       // WITH 定义的公共表表达式, 没有WITH时为nil
+	Compound *CompoundSelect   // 用UNION, INTERSECT, EXCEPT 组合起来的查询, 这时只有ORDER BY, LIMIT, OFFSET有意义
+	Distinct bool              // SELECT DISTINCT, 去掉重复的行
+	Item     []*SelectItem     // 要查询的每一项
+	From     []*TableReference // FROM 里的每一项, 逗号隔开的多项相当于CROSS JOIN
+	Where    *Expression       // 过滤条件,没有WHERE时为nil
+	GroupBy  []*Expression     // 分组, 没有GROUP BY时为空
+	Having   *Expression       // 分组之后的过滤条件, 没有HAVING时为nil
+	OrderBy  []*OrderByItem    // 排序, 没有ORDER BY时为空
+	Limit    *Expression       // 最多返回多少行, 没有LIMIT时为nil
+	Offset   *Expression       // 跳过前面多少行, 没有OFFSET时为nil
+}
+
+// WITH 后面定义的所有公共表表达式(CTE), 后面的CTE和主查询都可以像表一样引用前面的CTE
+type WithClause struct {
+	Recursive bool // WITH RECURSIVE, 这时CTE可以引用它自己
+	Ctes      []*CommonTableExpression
+}
+
+// 一个公共表表达式, 也就是 $name [($column [, ...])] AS ($select-statement)
+type CommonTableExpression struct {
+	Name    lexer.Token
+	Columns []*lexer.Token // 结果每一列的名字, 没有写时为空, 这时用查询结果的列名
+	Select  *SelectStatement
+}
+
+func (cte *CommonTableExpression) String() string {
+	s := cte.Name.Value
+	if len(cte.Columns) > 0 {
+		columns := []string{}
+		for _, col := range cte.Columns {
+			columns = append(columns, col.Value)
+		}
+		s += " (" + strings.Join(columns, ", ") + ")"
+	}
+	return s + " " + string(lexer.AsKeyword) + " (" + cte.Select.String() + ")"
+}
+
+// 集合操作
+type SetOperator uint
+
+const (
+	UnionOperator     SetOperator = iota // UNION
+	IntersectOperator                    // INTERSECT
+	ExceptOperator                       // EXCEPT
+)
+
+func (op SetOperator) String() string {
+	switch op {
+	case IntersectOperator:
+		return string(lexer.IntersectKeyword)
+	case ExceptOperator:
+		return string(lexer.ExceptKeyword)
+	}
+	return string(lexer.UnionKeyword)
+}
+
+// 两个查询的结果按集合操作组合起来, 比如 SELECT a FROM t UNION ALL SELECT b FROM s
+type CompoundSelect struct {
+	Left     *SelectStatement
+	Right    *SelectStatement
+	Operator SetOperator
+	All      bool // 有ALL时保留重复的行
+}
+
+// SELECT 后面的一项, 也就是 $expression [[AS] $alias], * 或者 $table.*
+type SelectItem struct {
+	Exp      *Expression
+	As       *lexer.Token // 别名, 没有别名时为nil
+	Asterisk bool         // * 或者 t.*, 这时Exp为nil
+	Table    *lexer.Token // t.* 里的t, 只有*时为nil
+}
+
+func (item *SelectItem) String() string {
+	if item.Asterisk {
+		if item.Table != nil {
+			return item.Table.Value + ".*"
+		}
+		return "*"
+	}
+	if item.As != nil {
+		return item.Exp.String() + " " + string(lexer.AsKeyword) + " " + item.As.Value
+	}
+	return item.Exp.String()
+}
+
+// FROM 里的一项是一张表或者连接(JOIN)的结果
+type TableReferenceKind uint
+
+const (
+	TableNameKind    TableReferenceKind = iota // 一张表, 比如 users u
+	JoinedTableKind                            // 两个表引用连接之后的结果
+	DerivedTableKind                           // 子查询的结果, 比如 (SELECT ...) AS t, 必须有别名
+)
+
+type TableReference struct {
+	Table  lexer.Token  // 表名
+	Alias  *lexer.Token // 表的别名, 没有别名时为nil
+	Join   *JoinClause
+	Select *SelectStatement // 子查询
+	Kind   TableReferenceKind
+}
+
+func (ref *TableReference) String() string {
+	var s string
+	switch ref.Kind {
+	case JoinedTableKind:
+		s = ref.Join.Left.String() + " " + ref.Join.Type.String() + " " + ref.Join.Right.String()
+		if ref.Join.On != nil {
+			s += " " + string(lexer.OnKeyword) + " " + ref.Join.On.String()
+		}
+		return s
+	case DerivedTableKind:
+		s = "(" + ref.Select.String() + ")"
+	default:
+		s = ref.Table.Value
+	}
+	if ref.Alias != nil {
+		s += " " + string(lexer.AsKeyword) + " " + ref.Alias.Value
+	}
+	return s
+}
+
+// 连接的种类
+type JoinType uint
+
+const (
+	InnerJoin JoinType = iota // [INNER] JOIN
+	LeftJoin                  // LEFT [OUTER] JOIN
+	RightJoin                 // RIGHT [OUTER] JOIN
+	FullJoin                  // FULL [OUTER] JOIN
+	CrossJoin                 // CROSS JOIN
+)
+
+func (typ JoinType) String() string {
+	switch typ {
+	case LeftJoin:
+		return string(lexer.LeftKeyword) + " " + string(lexer.JoinKeyword)
+	case RightJoin:
+		return string(lexer.RightKeyword) + " " + string(lexer.JoinKeyword)
+	case FullJoin:
+		return string(lexer.FullKeyword) + " " + string(lexer.JoinKeyword)
+	case CrossJoin:
+		return string(lexer.CrossKeyword) + " " + string(lexer.JoinKeyword)
+	}
+	return string(lexer.JoinKeyword)
+}
+
+// 连接由左右两边的表引用, 连接的种类和连接条件组成
+type JoinClause struct {
+	Left  *TableReference
+	Right *TableReference
+	Type  JoinType
+	On    *Expression // 连接条件, CROSS JOIN 时为nil
+}
+
+// NULL值排在前面还是后面
+type NullsOrder uint
+
+const (
+	DefaultNullsOrder NullsOrder = iota // 没有指定, 升序时NULL在最后, 降序时NULL在最前
+	NullsFirstOrder                     // NULLS FIRST
+	NullsLastOrder                      // NULLS LAST
+)
+
+// ORDER BY 中的一项
+type OrderByItem struct {
+	Exp   *Expression
+	Desc  bool // DESC 为true, ASC或者没有指定时为false
+	Nulls NullsOrder
+}
+
+func (item *OrderByItem) String() string {
+	s := item.Exp.String()
+	if item.Desc {
+		s += " " + string(lexer.DescKeyword)
+	}
+	switch item.Nulls {
+	case NullsFirstOrder:
+		s += " " + string(lexer.NullsKeyword) + " " + string(lexer.FirstKeyword)
+	case NullsLastOrder:
+		s += " " + string(lexer.NullsKeyword) + " " + string(lexer.LastKeyword)
+	}
+	return s
+}
+
+// Update语句有一个表名, 一组要修改的列和新值, 以及可选的过滤条件
+type UpdateStatement struct {
+	Table lexer.Token
+	Set   []*UpdateSetItem
+	Where *Expression // 没有WHERE时为nil, 代表修改所有的行
+}
+
+// SET 后面的一项, 也就是 列名 = 表达式
+type UpdateSetItem struct {
+	Column lexer.Token
+	Value  *Expression
+}
+
+// Delete语句有一个表名和可选的过滤条件
+type DeleteStatement struct {
+	Table lexer.Token
+	Where *Expression // 没有WHERE时为nil, 代表删除所有的行
+}
+
+// Drop语句只有一个表名
+type DropTableStatement struct {
+	Table    lexer.Token
+	IfExists bool // DROP TABLE IF EXISTS, 表不存在时不报错
+}
+
+// ALTER TABLE 支持的几种修改
+type AlterTableAction uint
+
+const (
+	AddColumnAction    AlterTableAction = iota // ADD COLUMN
+	DropColumnAction                           // DROP COLUMN
+	RenameColumnAction                         // RENAME COLUMN a TO b
+	RenameTableAction                          // RENAME TO
+)
+
+// Alter语句有一个表名和一种修改
+type AlterTableStatement struct {
+	Table   lexer.Token
+	Action  AlterTableAction
+	Column  *ColumnDefinition // ADD COLUMN 要加的列
+	Name    *lexer.Token      // DROP COLUMN 和 RENAME COLUMN 的列名
+	NewName *lexer.Token      // RENAME 之后的新名字
+}
+
+// Explain语句只显示一个Select语句会怎么执行, 并不真的执行它
+type ExplainStatement struct {
+	Select *SelectStatement
+}
+
+// 索引的实现方式
+type IndexMethod uint
+
+const (
+	OrderedIndex IndexMethod = iota // 默认, 也可以写成 USING BTREE, 按顺序保存, 可以用于等值和范围条件
+	HashIndex                       // USING HASH, 只能用于所有的列都是等值条件的时候
+)
+
+// CREATE INDEX 在一张表的几列上建索引
+type CreateIndexStatement struct {
+	Name        lexer.Token
+	Table       lexer.Token
+	Columns     []*lexer.Token
+	Method      IndexMethod
+	Unique      bool // CREATE UNIQUE INDEX, 索引的列不能有重复的值
+	IfNotExists bool
+}
+
+// DROP INDEX 只有一个索引名
+type DropIndexStatement struct {
+	Name     lexer.Token
+	IfExists bool
+}
+
+// ANALYZE 收集表的统计信息, 给查询计划估算代价用
+type AnalyzeStatement struct {
+	Table *lexer.Token // 没有写表名时为nil, 收集所有表的统计信息
 }
 
 // parseing
@@ -142,7 +672,7 @@ func Parse(source string) (*Ast, error) {
 	return &a, nil
 }
 
-// 解析语句辅助函数,每个statement将会是SELECT, INSERT, CREATE
+// 解析语句辅助函数,每个statement将会是SELECT, INSERT, CREATE, UPDATE, DELETE, DROP, ALTER, EXPLAIN
 func parseStatement(tokens []*lexer.Token, initialCursor uint, delimiter lexer.Token) (*Statement, uint, bool) {
 	// 分别调动每个statement类型的解析函数
 	cursor := initialCursor
@@ -158,6 +688,15 @@ func parseStatement(tokens []*lexer.Token, initialCursor uint, delimiter lexer.T
 		}, newCursor, true
 	}
 
+	// 寻找WITH, 也就是带公共表表达式的SELECT
+	with, newCursor, ok := parseWithStatement(tokens, cursor, semicolonToken)
+	if ok {
+		return &Statement{
+			Kind:            SelectKind,
+			SelectStatement: with,
+		}, newCursor, true
+	}
+
 	// 不是SELECT语句，寻找INSERT
 	insert, newCursor, ok := parseInsertStatement(tokens, cursor, semicolonToken)
 	if ok {
@@ -178,6 +717,78 @@ func parseStatement(tokens []*lexer.Token, initialCursor uint, delimiter lexer.T
 		}, newCursor, true
 	}
 
+	// 寻找UPDATE
+	update, newCursor, ok := parseUpdateStatement(tokens, cursor, semicolonToken)
+	if ok {
+		return &Statement{
+			Kind:            UpdateKind,
+			UpdateStatement: update,
+		}, newCursor, true
+	}
+
+	// 寻找DELETE
+	del, newCursor, ok := parseDeleteStatement(tokens, cursor, semicolonToken)
+	if ok {
+		return &Statement{
+			Kind:            DeleteKind,
+			DeleteStatement: del,
+		}, newCursor, true
+	}
+
+	// 寻找DROP
+	drop, newCursor, ok := parseDropTableStatement(tokens, cursor, semicolonToken)
+	if ok {
+		return &Statement{
+			Kind:               DropTableKind,
+			DropTableStatement: drop,
+		}, newCursor, true
+	}
+
+	// 寻找ALTER
+	alter, newCursor, ok := parseAlterTableStatement(tokens, cursor, semicolonToken)
+	if ok {
+		return &Statement{
+			Kind:                AlterTableKind,
+			AlterTableStatement: alter,
+		}, newCursor, true
+	}
+
+	// 寻找EXPLAIN
+	explain, newCursor, ok := parseExplainStatement(tokens, cursor, semicolonToken)
+	if ok {
+		return &Statement{
+			Kind:             ExplainKind,
+			ExplainStatement: explain,
+		}, newCursor, true
+	}
+
+	// 寻找CREATE INDEX
+	createIndex, newCursor, ok := parseCreateIndexStatement(tokens, cursor, semicolonToken)
+	if ok {
+		return &Statement{
+			Kind:                 CreateIndexKind,
+			CreateIndexStatement: createIndex,
+		}, newCursor, true
+	}
+
+	// 寻找DROP INDEX
+	dropIndex, newCursor, ok := parseDropIndexStatement(tokens, cursor, semicolonToken)
+	if ok {
+		return &Statement{
+			Kind:               DropIndexKind,
+			DropIndexStatement: dropIndex,
+		}, newCursor, true
+	}
+
+	// 寻找ANALYZE
+	analyze, newCursor, ok := parseAnalyzeStatement(tokens, cursor, semicolonToken)
+	if ok {
+		return &Statement{
+			Kind:             AnalyzeKind,
+			AnalyzeStatement: analyze,
+		}, newCursor, true
+	}
+
 	return nil, initialCursor, false
 }
 
@@ -185,12 +796,118 @@ func parseStatement(tokens []*lexer.Token, initialCursor uint, delimiter lexer.T
 // 解析select 语句
 // Parsing SELECT statements is easy. We'll look for the following token pattern:
 
-// SELECT
-// $expression [, ...]
-// FROM
-// $table-name
+// $select-core
+// [{UNION | INTERSECT | EXCEPT} [ALL] $select-core] ...
+// [ORDER BY $expression [ASC | DESC] [NULLS FIRST | NULLS LAST] [, ...]]
+// [LIMIT $expression]
+// [OFFSET $expression]
 func parseSelectStatement(tokens []*lexer.Token, initialCursor uint, delimiter lexer.Token) (*SelectStatement, uint, bool) {
 	cursor := initialCursor
+
+	slct, newCursor, ok := parseSetOperation(tokens, cursor, delimiter, false)
+	if !ok {
+		return nil, initialCursor, false
+	}
+	cursor = newCursor
+
+	// ORDER BY, LIMIT, OFFSET 作用于组合之后的整个结果
+	// 检查有没有ORDER BY
+	orderBy, newCursor, ok := parseOrderBy(tokens, cursor)
+	if !ok {
+		return nil, initialCursor, false
+	}
+	slct.OrderBy = orderBy
+	cursor = newCursor
+
+	// 检查有没有LIMIT
+	limit, newCursor, ok := parseKeywordExpression(tokens, cursor, lexer.LimitKeyword, delimiter)
+	if !ok {
+		return nil, initialCursor, false
+	}
+	slct.Limit = limit
+	cursor = newCursor
+
+	// 检查有没有OFFSET
+	offset, newCursor, ok := parseKeywordExpression(tokens, cursor, lexer.OffsetKeyword, delimiter)
+	if !ok {
+		return nil, initialCursor, false
+	}
+	slct.Offset = offset
+	cursor = newCursor
+
+	return slct, cursor, true
+}
+
+// 辅助函数,用于找到用集合操作组合起来的查询
+// 和SQL标准一样, INTERSECT 比 UNION 和 EXCEPT 结合得更紧, 同级的集合操作是左结合的
+// intersectOnly为true时只找INTERSECT
+func parseSetOperation(tokens []*lexer.Token, initialCursor uint, delimiter lexer.Token, intersectOnly bool) (*SelectStatement, uint, bool) {
+	cursor := initialCursor
+
+	var slct *SelectStatement
+	var newCursor uint
+	var ok bool
+	if intersectOnly {
+		slct, newCursor, ok = parseSelectCore(tokens, cursor, delimiter)
+	} else {
+		slct, newCursor, ok = parseSetOperation(tokens, cursor, delimiter, true)
+	}
+	if !ok {
+		return nil, initialCursor, false
+	}
+	cursor = newCursor
+
+	for cursor < uint(len(tokens)) {
+		var operator SetOperator
+		switch {
+		case expectToken(tokens, cursor, TokenFromKeyword(lexer.IntersectKeyword)):
+			operator = IntersectOperator
+		case !intersectOnly && expectToken(tokens, cursor, TokenFromKeyword(lexer.UnionKeyword)):
+			operator = UnionOperator
+		case !intersectOnly && expectToken(tokens, cursor, TokenFromKeyword(lexer.ExceptKeyword)):
+			operator = ExceptOperator
+		default:
+			return slct, cursor, true
+		}
+		cursor++
+
+		compound := CompoundSelect{
+			Left:     slct,
+			Operator: operator,
+		}
+		if expectToken(tokens, cursor, TokenFromKeyword(lexer.AllKeyword)) {
+			compound.All = true
+			cursor++
+		}
+
+		var right *SelectStatement
+		if intersectOnly {
+			right, newCursor, ok = parseSelectCore(tokens, cursor, delimiter)
+		} else {
+			right, newCursor, ok = parseSetOperation(tokens, cursor, delimiter, true)
+		}
+		if !ok {
+			helpMessage(tokens, cursor, "Expected SELECT")
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+		compound.Right = right
+
+		slct = &SelectStatement{Compound: &compound}
+	}
+
+	return slct, cursor, true
+}
+
+// 解析一个不带集合操作的查询
+// SELECT [DISTINCT]
+// {* | $table.* | $expression [[AS] $alias]} [, ...]
+// [FROM $table-reference [, ...]]
+// [WHERE $expression]
+// [GROUP BY $expression [, ...]]
+// [HAVING $expression]
+func parseSelectCore(tokens []*lexer.Token, initialCursor uint, delimiter lexer.Token) (*SelectStatement, uint, bool) {
+	cursor := initialCursor
 	// 如果token数组中当前索引对应的这个token不是Select的话,就返回错误
 	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.SelectKeyword)) {
 		// return nil, cursor, false //错误 2021年4月25日21:16:31
@@ -203,28 +920,178 @@ func parseSelectStatement(tokens []*lexer.Token, initialCursor uint, delimiter l
 	// 这就是我们要返回的结果
 	slct := SelectStatement{}
 
-	exps, newCursor, ok := parseExpressions(tokens, cursor, []lexer.Token{TokenFromKeyword(lexer.FromKeyword), delimiter})
+	// 检查有没有DISTINCT
+	if expectToken(tokens, cursor, TokenFromKeyword(lexer.DistinctKeyword)) {
+		slct.Distinct = true
+		cursor++
+	}
+
+	items, newCursor, ok := parseSelectItems(tokens, cursor)
 	if !ok {
 		return nil, initialCursor, false
 	}
 
-	slct.Item = *exps // 列名
+	slct.Item = items
 	cursor = newCursor
 
 	// 检查是不是from关键字
 	if expectToken(tokens, cursor, TokenFromKeyword(lexer.FromKeyword)) {
 		cursor++
 
-		from, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
-		if !ok {
-			helpMessage(tokens, cursor, "Expected FROM token")
-			return nil, initialCursor, false
+		for {
+			// 每一项之间用逗号隔开
+			if len(slct.From) > 0 {
+				if !expectToken(tokens, cursor, TokenFromSymbol(lexer.CommaSymbol)) {
+					break
+				}
+				cursor++
+			}
+
+			ref, newCursor, ok := parseTableReference(tokens, cursor)
+			if !ok {
+				return nil, initialCursor, false
+			}
+			cursor = newCursor
+
+			slct.From = append(slct.From, ref)
 		}
-		slct.From = *from
-		cursor = newCursor
 	}
 
-	return &slct, cursor, true
+	// 检查有没有WHERE
+	where, newCursor, ok := parseWhere(tokens, cursor, delimiter)
+	if !ok {
+		return nil, initialCursor, false
+	}
+	slct.Where = where
+	cursor = newCursor
+
+	// 检查有没有GROUP BY
+	groupBy, newCursor, ok := parseGroupBy(tokens, cursor)
+	if !ok {
+		return nil, initialCursor, false
+	}
+	slct.GroupBy = groupBy
+	cursor = newCursor
+
+	// 检查有没有HAVING
+	having, newCursor, ok := parseKeywordExpression(tokens, cursor, lexer.HavingKeyword, delimiter)
+	if !ok {
+		return nil, initialCursor, false
+	}
+	slct.Having = having
+	cursor = newCursor
+
+	return &slct, cursor, true
+}
+
+////////////////////////////////
+// 解析Explain语句
+// We'll look for the following token pattern:
+// EXPLAIN
+// $select-statement
+func parseExplainStatement(tokens []*lexer.Token, initialCursor uint, delimiter lexer.Token) (*ExplainStatement, uint, bool) {
+	cursor := initialCursor
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.ExplainKeyword)) {
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	slct, newCursor, ok := parseWithStatement(tokens, cursor, delimiter)
+	if !ok {
+		slct, newCursor, ok = parseSelectStatement(tokens, cursor, delimiter)
+	}
+	if !ok {
+		helpMessage(tokens, cursor, "Expected SELECT statement")
+		return nil, initialCursor, false
+	}
+
+	return &ExplainStatement{Select: slct}, newCursor, true
+}
+
+////////////////////////////////
+// 解析带WITH的Select语句
+// We'll look for the following token pattern:
+// WITH [RECURSIVE] $name [($column [, ...])] AS ($select-statement) [, ...]
+// $select-statement
+func parseWithStatement(tokens []*lexer.Token, initialCursor uint, delimiter lexer.Token) (*SelectStatement, uint, bool) {
+	cursor := initialCursor
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.WithKeyword)) {
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	with := WithClause{}
+	if expectToken(tokens, cursor, TokenFromKeyword(lexer.RecursiveKeyword)) {
+		with.Recursive = true
+		cursor++
+	}
+
+	for {
+		// 每个CTE之间用逗号隔开
+		if len(with.Ctes) > 0 {
+			if !expectToken(tokens, cursor, TokenFromSymbol(lexer.CommaSymbol)) {
+				break
+			}
+			cursor++
+		}
+
+		cte, newCursor, ok := parseCommonTableExpression(tokens, cursor)
+		if !ok {
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+		with.Ctes = append(with.Ctes, cte)
+	}
+
+	slct, newCursor, ok := parseSelectStatement(tokens, cursor, delimiter)
+	if !ok {
+		helpMessage(tokens, cursor, "Expected SELECT statement")
+		return nil, initialCursor, false
+	}
+	slct.With = &with
+
+	return slct, newCursor, true
+}
+
+// 辅助函数,用于找到WITH里的一个公共表表达式
+// $name [($column [, ...])] AS ($select-statement)
+func parseCommonTableExpression(tokens []*lexer.Token, initialCursor uint) (*CommonTableExpression, uint, bool) {
+	cursor := initialCursor
+
+	name, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+	if !ok {
+		helpMessage(tokens, cursor, "Expected CTE name")
+		return nil, initialCursor, false
+	}
+	cursor = newCursor
+	cte := CommonTableExpression{Name: *name}
+
+	// 找可选的列名
+	if expectToken(tokens, cursor, TokenFromSymbol(lexer.LeftBracketSymbol)) {
+		cursor++
+		columns, newCursor, ok := parseColumnNames(tokens, cursor)
+		if !ok {
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+		cte.Columns = columns
+	}
+
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.AsKeyword)) {
+		helpMessage(tokens, cursor, "Expected AS")
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	slct, newCursor, ok := parseSubquery(tokens, cursor)
+	if !ok {
+		helpMessage(tokens, cursor, "Expected subquery")
+		return nil, initialCursor, false
+	}
+	cursor = newCursor
+	cte.Select = slct
+
+	return &cte, cursor, true
 }
 
 ////////////////////////////////
@@ -232,11 +1099,8 @@ func parseSelectStatement(tokens []*lexer.Token, initialCursor uint, delimiter l
 // We'll look for the following token pattern:
 // INSERT
 // INTO
-// $table-name
-// VALUES
-// (
-// $expression [, ...]
-// )
+// $table-name [($column [, ...])]
+// {VALUES ($expression [, ...]) [, ...] | $select-statement}
 func parseInsertStatement(tokens []*lexer.Token, initialCursor uint, delimiter lexer.Token) (*InsertStatement, uint, bool) {
 	cursor := initialCursor
 	// 找打INSERT
@@ -257,35 +1121,66 @@ func parseInsertStatement(tokens []*lexer.Token, initialCursor uint, delimiter l
 	}
 	cursor = newCursor
 
-	// 找到VALUES
-	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.ValuesKeyword)) {
-		helpMessage(tokens, cursor, "Expected VALUES")
-		return nil, initialCursor, false
+	insert := InsertStatement{Table: *table}
+
+	// 找可选的列名
+	if expectToken(tokens, cursor, TokenFromSymbol(lexer.LeftBracketSymbol)) {
+		cursor++
+		columns, newCursor, ok := parseColumnNames(tokens, cursor)
+		if !ok {
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+		insert.Columns = columns
 	}
-	cursor++
-	// 找到"("
-	if !expectToken(tokens, cursor, TokenFromSymbol(lexer.LeftBracketSymbol)) {
-		helpMessage(tokens, cursor, "Expected '(' ")
-		return nil, initialCursor, false
+
+	// 不是VALUES的话就是INSERT ... SELECT
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.ValuesKeyword)) {
+		slct, newCursor, ok := parseWithStatement(tokens, cursor, delimiter)
+		if !ok {
+			slct, newCursor, ok = parseSelectStatement(tokens, cursor, delimiter)
+		}
+		if !ok {
+			helpMessage(tokens, cursor, "Expected VALUES or SELECT")
+			return nil, initialCursor, false
+		}
+		insert.Select = slct
+		return &insert, newCursor, true
 	}
 	cursor++
-	// 找到表达式list
-	values, newCursor, ok := parseExpressions(tokens, cursor, []lexer.Token{TokenFromSymbol(lexer.RightBracketSymbol)})
-	if !ok {
-		return nil, initialCursor, false
-	}
-	cursor = newCursor
-	// 找到 ")"
-	if !expectToken(tokens, cursor, TokenFromSymbol(lexer.RightBracketSymbol)) {
-		helpMessage(tokens, cursor, "Expected ')'")
-		return nil, initialCursor, false
+
+	// 每一行之间用逗号隔开
+	for {
+		if len(insert.Values) > 0 {
+			if !expectToken(tokens, cursor, TokenFromSymbol(lexer.CommaSymbol)) {
+				break
+			}
+			cursor++
+		}
+
+		// 找到"("
+		if !expectToken(tokens, cursor, TokenFromSymbol(lexer.LeftBracketSymbol)) {
+			helpMessage(tokens, cursor, "Expected '(' ")
+			return nil, initialCursor, false
+		}
+		cursor++
+		// 找到表达式list
+		values, newCursor, ok := parseExpressions(tokens, cursor, []lexer.Token{TokenFromSymbol(lexer.RightBracketSymbol)})
+		if !ok {
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+		// 找到 ")"
+		if !expectToken(tokens, cursor, TokenFromSymbol(lexer.RightBracketSymbol)) {
+			helpMessage(tokens, cursor, "Expected ')'")
+			return nil, initialCursor, false
+		}
+		cursor++ // 别忘了最后找到)的时候cursor要往后加一个
+
+		insert.Values = append(insert.Values, *values)
 	}
 
-	cursor++ // 别忘了最后找到)的时候cursor要往后加一个
-	return &InsertStatement{
-		Table:  *table,
-		Values: values,
-	}, cursor, true
+	return &insert, cursor, true
 }
 
 ////////////////////////////////
@@ -293,6 +1188,8 @@ func parseInsertStatement(tokens []*lexer.Token, initialCursor uint, delimiter l
 // Finally, for create statements we'll look for the following token pattern:
 
 // CREATE
+// TABLE
+// [IF NOT EXISTS]
 // $table-name
 // (
 // [$column-name $column-type [, ...]]
@@ -310,6 +1207,24 @@ func parseCreateStatement(tokens []*lexer.Token, initialCursor uint, delimiter l
 		return nil, initialCursor, false
 	}
 	cursor++
+
+	// 找到可选的IF NOT EXISTS
+	ifNotExists := false
+	if expectToken(tokens, cursor, TokenFromKeyword(lexer.IfKeyword)) {
+		cursor++
+		if !expectToken(tokens, cursor, TokenFromKeyword(lexer.NotKeyword)) {
+			helpMessage(tokens, cursor, "Expected NOT")
+			return nil, initialCursor, false
+		}
+		cursor++
+		if !expectToken(tokens, cursor, TokenFromKeyword(lexer.ExistsKeyword)) {
+			helpMessage(tokens, cursor, "Expected EXISTS")
+			return nil, initialCursor, false
+		}
+		cursor++
+		ifNotExists = true
+	}
+
 	// 找打tablename
 	// table, newCursor, ok := parseExpression(tokens, cursor, delimiter)
 	name, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
@@ -324,8 +1239,8 @@ func parseCreateStatement(tokens []*lexer.Token, initialCursor uint, delimiter l
 		return nil, initialCursor, false
 	}
 	cursor++
-	// 找到column list
-	cloums, newCursor, ok := parseColumnDefinitions(tokens, cursor, TokenFromSymbol(lexer.RightBracketSymbol))
+	// 找到column list, 表约束可以和列混在一起写
+	cloums, constraints, newCursor, ok := parseColumnDefinitions(tokens, cursor, TokenFromSymbol(lexer.RightBracketSymbol))
 	if !ok {
 		return nil, initialCursor, false
 	}
@@ -339,116 +1254,1546 @@ func parseCreateStatement(tokens []*lexer.Token, initialCursor uint, delimiter l
 	cursor++
 
 	return &CreateStatement{
-		Table: *name,
-		Cols:  cloums,
+		Table:       *name,
+		Cols:        cloums,
+		Constraints: constraints,
+		IfNotExists: ifNotExists,
 	}, cursor, true
 }
 
-// 辅助函数,用于找到列名和跟在后面的列类型
-func parseColumnDefinitions(tokens []*lexer.Token, initialCursor uint, delimiter lexer.Token) (*[]*ColumnDefinition, uint, bool) {
+////////////////////////////////
+// 解析Update语句
+// We'll look for the following token pattern:
+// UPDATE
+// $table-name
+// SET
+// $column-name = $expression [, ...]
+// [WHERE $expression]
+func parseUpdateStatement(tokens []*lexer.Token, initialCursor uint, delimiter lexer.Token) (*UpdateStatement, uint, bool) {
 	cursor := initialCursor
-	cds := []*ColumnDefinition{}
-	// 循环找, 直到遇到分隔符(delimiter)位置
-	for {
-		// 每次循环都要检查cursor是否越界
-		if cursor >= uint(len(tokens)) {
-			return nil, initialCursor, false
-		}
-		// 查找delimiter
-		current := tokens[cursor]
-		// 找到delimiter，跳出循环
-		if delimiter.Equals(current) {
-			break
-		}
+	// 找到UPDATE
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.UpdateKeyword)) {
+		return nil, initialCursor, false
+	}
+	cursor++
 
-		// 看看有么有逗号，有逗号的情景下证明cds数组里面已经有了一个元素
-		if len(cds) > 0 {
-			// check if there is a comma
+	// 找到tablename
+	table, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+	if !ok {
+		helpMessage(tokens, cursor, "Expected table name")
+		return nil, initialCursor, false
+	}
+	cursor = newCursor
+
+	// 找到SET
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.SetKeyword)) {
+		helpMessage(tokens, cursor, "Expected SET")
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	update := UpdateStatement{Table: *table}
+	for {
+		// 每一项之间用逗号隔开
+		if len(update.Set) > 0 {
 			if !expectToken(tokens, cursor, TokenFromSymbol(lexer.CommaSymbol)) {
-				helpMessage(tokens, cursor, "Expected comma")
-				return nil, initialCursor, false
+				break
 			}
 			cursor++
 		}
 
-		// 找列名
-		id, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+		// 找到列名
+		column, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
 		if !ok {
 			helpMessage(tokens, cursor, "Expected column name")
 			return nil, initialCursor, false
 		}
 		cursor = newCursor
-		// 找列的类型
-		ty, newCursor, ok := parseToken(tokens, cursor, lexer.KeywordKind)
+
+		// 找到 =
+		if !expectToken(tokens, cursor, TokenFromSymbol(lexer.EqualSymbol)) {
+			helpMessage(tokens, cursor, "Expected '='")
+			return nil, initialCursor, false
+		}
+		cursor++
+
+		// 找到新的值
+		value, newCursor, ok := parseExpression(tokens, cursor, TokenFromSymbol(lexer.CommaSymbol))
 		if !ok {
+			helpMessage(tokens, cursor, "Expected expression")
 			return nil, initialCursor, false
 		}
 		cursor = newCursor
 
-		cds = append(cds, &ColumnDefinition{
-			Name:     *id,
-			Datatype: *ty,
+		update.Set = append(update.Set, &UpdateSetItem{
+			Column: *column,
+			Value:  value,
 		})
 	}
-	return &cds, cursor, true
+
+	// 检查有没有WHERE
+	where, newCursor, ok := parseWhere(tokens, cursor, delimiter)
+	if !ok {
+		return nil, initialCursor, false
+	}
+	update.Where = where
+	cursor = newCursor
+
+	return &update, cursor, true
 }
 
-// The parseExpressions helper will look for tokens separated by a comma until a delimiter is found.
-// It will use existing helpers plus parseExpression.
-func parseExpressions(tokens []*lexer.Token, initialCursor uint, delimiters []lexer.Token) (*[]*Expression, uint, bool) {
+////////////////////////////////
+// 解析Delete语句
+// We'll look for the following token pattern:
+// DELETE
+// [FROM $table-reference [, ...]]
+// [WHERE $expression]
+func parseDeleteStatement(tokens []*lexer.Token, initialCursor uint, delimiter lexer.Token) (*DeleteStatement, uint, bool) {
 	cursor := initialCursor
-	exps := []*Expression{}
-outer:
-	for {
-		// 先判断索引cursor有么有越界
-		if cursor >= uint(len(tokens)) {
-			return nil, initialCursor, false
-		}
-		// 寻找分隔符
-		current := tokens[cursor]
-		for _, d := range delimiters {
-			// 如果发现这个token就是分隔符,直接退出循环
-			if d.Equals(current) {
-				break outer
-			}
-		}
+	// 找到DELETE
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.DeleteKeyword)) {
+		return nil, initialCursor, false
+	}
+	cursor++
 
-		// 找逗号(前提是有逗号)
-		if len(exps) > 0 {
-			// 不是逗号
-			if !expectToken(tokens, cursor, TokenFromSymbol(lexer.CommaSymbol)) {
-				helpMessage(tokens, cursor, "Expected comma")
-				return nil, initialCursor, false
-			}
+	// 找到FROM
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.FromKeyword)) {
+		helpMessage(tokens, cursor, "Expected FROM")
+		return nil, initialCursor, false
+	}
+	cursor++
 
-			cursor++
-		}
-		// 找expression
-		exp, newCursor, ok := parseExpression(tokens, cursor, TokenFromSymbol(lexer.CommaSymbol))
-		// 说明氮
-		if !ok {
-			helpMessage(tokens, cursor, "Expected expression")
-			return nil, initialCursor, false
-		}
-		// 说明遇到了逗号
-		cursor = newCursor
+	// 找到tablename
+	table, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+	if !ok {
+		helpMessage(tokens, cursor, "Expected table name")
+		return nil, initialCursor, false
+	}
+	cursor = newCursor
 
-		exps = append(exps, exp)
+	// 检查有没有WHERE
+	where, newCursor, ok := parseWhere(tokens, cursor, delimiter)
+	if !ok {
+		return nil, initialCursor, false
 	}
+	cursor = newCursor
 
-	return &exps, cursor, true
+	return &DeleteStatement{
+		Table: *table,
+		Where: where,
+	}, cursor, true
 }
 
-// parseExpression 会找到数字, 字符串, 标识符等等
-func parseExpression(tokens []*lexer.Token, initialCursor uint, _ lexer.Token) (*Expression, uint, bool) {
+////////////////////////////////
+// 解析Drop语句
+// We'll look for the following token pattern:
+// DROP
+// TABLE
+// [IF EXISTS]
+// $table-name
+func parseDropTableStatement(tokens []*lexer.Token, initialCursor uint, delimiter lexer.Token) (*DropTableStatement, uint, bool) {
 	cursor := initialCursor
+	// 找到DROP
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.DropKeyword)) {
+		return nil, initialCursor, false
+	}
+	cursor++
 
-	// 下面就是要找的种类
-	kinds := []lexer.TokenKind{lexer.IdentifierKind, lexer.NumericKind, lexer.StringKind}
-	for _, kind := range kinds {
+	// 找到TABLE
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.TableKeyword)) {
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	// 找到可选的IF EXISTS
+	ifExists := false
+	if expectToken(tokens, cursor, TokenFromKeyword(lexer.IfKeyword)) {
+		cursor++
+		if !expectToken(tokens, cursor, TokenFromKeyword(lexer.ExistsKeyword)) {
+			helpMessage(tokens, cursor, "Expected EXISTS")
+			return nil, initialCursor, false
+		}
+		cursor++
+		ifExists = true
+	}
+
+	// 找到tablename
+	table, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+	if !ok {
+		helpMessage(tokens, cursor, "Expected table name")
+		return nil, initialCursor, false
+	}
+	cursor = newCursor
+
+	return &DropTableStatement{
+		Table:    *table,
+		IfExists: ifExists,
+	}, cursor, true
+}
+
+////////////////////////////////
+// 解析Create Index语句
+// We'll look for the following token pattern:
+// CREATE
+// [UNIQUE]
+// INDEX
+// [IF NOT EXISTS]
+// $index-name
+// ON
+// $table-name
+// [USING {BTREE | HASH}]
+// ($column-name [, ...])
+func parseCreateIndexStatement(tokens []*lexer.Token, initialCursor uint, delimiter lexer.Token) (*CreateIndexStatement, uint, bool) {
+	cursor := initialCursor
+	// 找到CREATE
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.CreateKeyword)) {
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	// 找到可选的UNIQUE
+	unique := false
+	if expectToken(tokens, cursor, TokenFromKeyword(lexer.UniqueKeyword)) {
+		cursor++
+		unique = true
+	}
+
+	// 找到INDEX
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.IndexKeyword)) {
+		if unique {
+			helpMessage(tokens, cursor, "Expected INDEX")
+		}
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	// 找到可选的IF NOT EXISTS
+	ifNotExists := false
+	if expectToken(tokens, cursor, TokenFromKeyword(lexer.IfKeyword)) {
+		cursor++
+		if !expectToken(tokens, cursor, TokenFromKeyword(lexer.NotKeyword)) {
+			helpMessage(tokens, cursor, "Expected NOT")
+			return nil, initialCursor, false
+		}
+		cursor++
+		if !expectToken(tokens, cursor, TokenFromKeyword(lexer.ExistsKeyword)) {
+			helpMessage(tokens, cursor, "Expected EXISTS")
+			return nil, initialCursor, false
+		}
+		cursor++
+		ifNotExists = true
+	}
+
+	// 找到索引名
+	name, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+	if !ok {
+		helpMessage(tokens, cursor, "Expected index name")
+		return nil, initialCursor, false
+	}
+	cursor = newCursor
+
+	// 找到ON
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.OnKeyword)) {
+		helpMessage(tokens, cursor, "Expected ON")
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	// 找到tablename
+	table, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+	if !ok {
+		helpMessage(tokens, cursor, "Expected table name")
+		return nil, initialCursor, false
+	}
+	cursor = newCursor
+
+	// 找到可选的USING, 索引的实现方式写成一个名字
+	method := OrderedIndex
+	if expectToken(tokens, cursor, TokenFromKeyword(lexer.UsingKeyword)) {
+		cursor++
+		name, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+		if !ok || (name.Value != "btree" && name.Value != "hash") {
+			helpMessage(tokens, cursor, "Expected BTREE or HASH")
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+		if name.Value == "hash" {
+			method = HashIndex
+		}
+	}
+
+	// 找到索引的列
+	if !expectToken(tokens, cursor, TokenFromSymbol(lexer.LeftBracketSymbol)) {
+		helpMessage(tokens, cursor, "Expected '('")
+		return nil, initialCursor, false
+	}
+	cursor++
+	columns, newCursor, ok := parseColumnNames(tokens, cursor)
+	if !ok {
+		return nil, initialCursor, false
+	}
+	cursor = newCursor
+
+	return &CreateIndexStatement{
+		Name:        *name,
+		Table:       *table,
+		Columns:     columns,
+		Method:      method,
+		Unique:      unique,
+		IfNotExists: ifNotExists,
+	}, cursor, true
+}
+
+////////////////////////////////
+// 解析Drop Index语句
+// We'll look for the following token pattern:
+// DROP
+// INDEX
+// [IF EXISTS]
+// $index-name
+func parseDropIndexStatement(tokens []*lexer.Token, initialCursor uint, delimiter lexer.Token) (*DropIndexStatement, uint, bool) {
+	cursor := initialCursor
+	// 找到DROP
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.DropKeyword)) {
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	// 找到INDEX
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.IndexKeyword)) {
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	// 找到可选的IF EXISTS
+	ifExists := false
+	if expectToken(tokens, cursor, TokenFromKeyword(lexer.IfKeyword)) {
+		cursor++
+		if !expectToken(tokens, cursor, TokenFromKeyword(lexer.ExistsKeyword)) {
+			helpMessage(tokens, cursor, "Expected EXISTS")
+			return nil, initialCursor, false
+		}
+		cursor++
+		ifExists = true
+	}
+
+	// 找到索引名
+	name, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+	if !ok {
+		helpMessage(tokens, cursor, "Expected index name")
+		return nil, initialCursor, false
+	}
+	cursor = newCursor
+
+	return &DropIndexStatement{
+		Name:     *name,
+		IfExists: ifExists,
+	}, cursor, true
+}
+
+////////////////////////////////
+// 解析Analyze语句
+// We'll look for the following token pattern:
+// ANALYZE
+// [$table-name]
+func parseAnalyzeStatement(tokens []*lexer.Token, initialCursor uint, delimiter lexer.Token) (*AnalyzeStatement, uint, bool) {
+	cursor := initialCursor
+	// 找到ANALYZE
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.AnalyzeKeyword)) {
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	// 找到可选的表名
+	table, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+	if ok {
+		cursor = newCursor
+	}
+
+	return &AnalyzeStatement{
+		Table: table,
+	}, cursor, true
+}
+
+////////////////////////////////
+// 解析Alter语句
+// We'll look for the following token pattern:
+// ALTER
+// TABLE
+// $table-name
+// ADD [COLUMN] $column-name $column-type [DEFAULT $expression]
+// | DROP [COLUMN] $column-name
+// | RENAME [COLUMN] $column-name TO $column-name
+// | RENAME TO $table-name
+func parseAlterTableStatement(tokens []*lexer.Token, initialCursor uint, delimiter lexer.Token) (*AlterTableStatement, uint, bool) {
+	cursor := initialCursor
+	// 找到ALTER
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.AlterKeyword)) {
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	// 找到TABLE
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.TableKeyword)) {
+		helpMessage(tokens, cursor, "Expected TABLE")
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	// 找到tablename
+	table, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+	if !ok {
+		helpMessage(tokens, cursor, "Expected table name")
+		return nil, initialCursor, false
+	}
+	cursor = newCursor
+
+	alter := AlterTableStatement{Table: *table}
+	// COLUMN关键字都是可以省略的
+	skipColumnKeyword := func() {
+		if expectToken(tokens, cursor, TokenFromKeyword(lexer.ColumnKeyword)) {
+			cursor++
+		}
+	}
+
+	switch {
+	case expectToken(tokens, cursor, TokenFromKeyword(lexer.AddKeyword)):
+		cursor++
+		skipColumnKeyword()
+
+		cd, newCursor, ok := parseColumnDefinition(tokens, cursor)
+		if !ok {
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+
+		alter.Action = AddColumnAction
+		alter.Column = cd
+	case expectToken(tokens, cursor, TokenFromKeyword(lexer.DropKeyword)):
+		cursor++
+		skipColumnKeyword()
+
+		name, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+		if !ok {
+			helpMessage(tokens, cursor, "Expected column name")
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+
+		alter.Action = DropColumnAction
+		alter.Name = name
+	case expectToken(tokens, cursor, TokenFromKeyword(lexer.RenameKeyword)):
+		cursor++
+
+		// RENAME TO 是修改表名, 否则是修改列名
+		alter.Action = RenameTableAction
+		if !expectToken(tokens, cursor, TokenFromKeyword(lexer.ToKeyword)) {
+			skipColumnKeyword()
+
+			name, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+			if !ok {
+				helpMessage(tokens, cursor, "Expected column name")
+				return nil, initialCursor, false
+			}
+			cursor = newCursor
+
+			alter.Action = RenameColumnAction
+			alter.Name = name
+		}
+
+		if !expectToken(tokens, cursor, TokenFromKeyword(lexer.ToKeyword)) {
+			helpMessage(tokens, cursor, "Expected TO")
+			return nil, initialCursor, false
+		}
+		cursor++
+
+		newName, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+		if !ok {
+			helpMessage(tokens, cursor, "Expected new name")
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+
+		alter.NewName = newName
+	default:
+		helpMessage(tokens, cursor, "Expected ADD, DROP or RENAME")
+		return nil, initialCursor, false
+	}
+
+	return &alter, cursor, true
+}
+
+// 辅助函数,用于找到可选的 WHERE $expression
+// 没有WHERE的时候返回nil, 但这不算失败
+func parseWhere(tokens []*lexer.Token, initialCursor uint, delimiter lexer.Token) (*Expression, uint, bool) {
+	cursor := initialCursor
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.WhereKeyword)) {
+		return nil, initialCursor, true
+	}
+	cursor++
+
+	where, newCursor, ok := parseExpression(tokens, cursor, delimiter)
+	if !ok {
+		helpMessage(tokens, cursor, "Expected WHERE conditionals")
+		return nil, initialCursor, false
+	}
+	return where, newCursor, true
+}
+
+// 辅助函数,用于找到可选的 $keyword $expression, 比如 LIMIT 10
+// 没有这个关键字的时候返回nil, 但这不算失败
+func parseKeywordExpression(tokens []*lexer.Token, initialCursor uint, keyword lexer.Keyword, delimiter lexer.Token) (*Expression, uint, bool) {
+	cursor := initialCursor
+	if !expectToken(tokens, cursor, TokenFromKeyword(keyword)) {
+		return nil, initialCursor, true
+	}
+	cursor++
+
+	exp, newCursor, ok := parseExpression(tokens, cursor, delimiter)
+	if !ok {
+		helpMessage(tokens, cursor, "Expected "+strings.ToUpper(string(keyword))+" expression")
+		return nil, initialCursor, false
+	}
+	return exp, newCursor, true
+}
+
+// 辅助函数,用于找到SELECT后面用逗号隔开的每一项
+// {* | $table.* | $expression [[AS] $alias]} [, ...]
+func parseSelectItems(tokens []*lexer.Token, initialCursor uint) ([]*SelectItem, uint, bool) {
+	cursor := initialCursor
+
+	items := []*SelectItem{}
+	for {
+		// 每一项之间用逗号隔开
+		if len(items) > 0 {
+			if !expectToken(tokens, cursor, TokenFromSymbol(lexer.CommaSymbol)) {
+				break
+			}
+			cursor++
+		}
+
+		// * 代表所有的列, t.* 代表t的所有列, 它们都不能有别名
+		if expectToken(tokens, cursor, TokenFromSymbol(lexer.AsterisSymbol)) {
+			cursor++
+			items = append(items, &SelectItem{Asterisk: true})
+			continue
+		}
+		if table, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind); ok &&
+			expectToken(tokens, newCursor, TokenFromSymbol(lexer.DotSymbol)) &&
+			expectToken(tokens, newCursor+1, TokenFromSymbol(lexer.AsterisSymbol)) {
+			cursor = newCursor + 2
+			items = append(items, &SelectItem{
+				Asterisk: true,
+				Table:    table,
+			})
+			continue
+		}
+
+		exp, newCursor, ok := parseExpression(tokens, cursor, TokenFromSymbol(lexer.CommaSymbol))
+		if !ok {
+			helpMessage(tokens, cursor, "Expected expression")
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+		item := SelectItem{Exp: exp}
+
+		// 找可选的别名, AS 可以省略
+		if expectToken(tokens, cursor, TokenFromKeyword(lexer.AsKeyword)) {
+			cursor++
+			as, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+			if !ok {
+				helpMessage(tokens, cursor, "Expected alias")
+				return nil, initialCursor, false
+			}
+			cursor = newCursor
+			item.As = as
+		} else if as, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind); ok {
+			cursor = newCursor
+			item.As = as
+		}
+
+		items = append(items, &item)
+	}
+
+	return items, cursor, true
+}
+
+// 辅助函数,用于找到FROM里的一项, 也就是一张表(或者子查询)以及跟在后面的任意多个连接
+// $table-primary
+// [[INNER | LEFT [OUTER] | RIGHT [OUTER] | FULL [OUTER] | CROSS] JOIN $table-primary [ON $expression]] ...
+func parseTableReference(tokens []*lexer.Token, initialCursor uint) (*TableReference, uint, bool) {
+	cursor := initialCursor
+
+	ref, newCursor, ok := parseTablePrimary(tokens, cursor)
+	if !ok {
+		return nil, initialCursor, false
+	}
+	cursor = newCursor
+
+	// 连接是左结合的, a JOIN b JOIN c 就是 (a JOIN b) JOIN c
+	for {
+		joinType, newCursor, ok := parseJoinType(tokens, cursor)
+		if !ok {
+			break
+		}
+		cursor = newCursor
+
+		right, newCursor, ok := parseTablePrimary(tokens, cursor)
+		if !ok {
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+
+		join := JoinClause{
+			Left:  ref,
+			Right: right,
+			Type:  joinType,
+		}
+
+		// 除了CROSS JOIN, 其他的连接都必须有ON
+		if joinType != CrossJoin {
+			if !expectToken(tokens, cursor, TokenFromKeyword(lexer.OnKeyword)) {
+				helpMessage(tokens, cursor, "Expected ON")
+				return nil, initialCursor, false
+			}
+			cursor++
+
+			on, newCursor, ok := parseExpression(tokens, cursor, TokenFromKeyword(lexer.JoinKeyword))
+			if !ok {
+				helpMessage(tokens, cursor, "Expected ON conditionals")
+				return nil, initialCursor, false
+			}
+			cursor = newCursor
+			join.On = on
+		}
+
+		ref = &TableReference{
+			Join: &join,
+			Kind: JoinedTableKind,
+		}
+	}
+
+	return ref, cursor, true
+}
+
+// 辅助函数,用于找到表名或者子查询, 以及别名
+// {$table-name [[AS] $alias] | ($select-statement) [AS] $alias}
+func parseTablePrimary(tokens []*lexer.Token, initialCursor uint) (*TableReference, uint, bool) {
+	cursor := initialCursor
+
+	ref := TableReference{}
+	if slct, newCursor, ok := parseSubquery(tokens, cursor); ok {
+		cursor = newCursor
+		ref.Select = slct
+		ref.Kind = DerivedTableKind
+	} else {
+		table, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+		if !ok {
+			helpMessage(tokens, cursor, "Expected table name")
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+		ref.Table = *table
+		ref.Kind = TableNameKind
+	}
+
+	// 找可选的别名, AS 可以省略
+	if expectToken(tokens, cursor, TokenFromKeyword(lexer.AsKeyword)) {
+		cursor++
+		alias, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+		if !ok {
+			helpMessage(tokens, cursor, "Expected table alias")
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+		ref.Alias = alias
+	} else if alias, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind); ok {
+		cursor = newCursor
+		ref.Alias = alias
+	}
+
+	// 子查询的结果没有名字, 所以必须有别名
+	if ref.Kind == DerivedTableKind && ref.Alias == nil {
+		helpMessage(tokens, cursor, "Expected subquery alias")
+		return nil, initialCursor, false
+	}
+
+	return &ref, cursor, true
+}
+
+// 辅助函数,用于找到JOIN以及它前面表示连接种类的关键字
+func parseJoinType(tokens []*lexer.Token, initialCursor uint) (JoinType, uint, bool) {
+	cursor := initialCursor
+
+	joinType := InnerJoin
+	switch {
+	case expectToken(tokens, cursor, TokenFromKeyword(lexer.InnerKeyword)):
+		cursor++
+	case expectToken(tokens, cursor, TokenFromKeyword(lexer.CrossKeyword)):
+		joinType = CrossJoin
+		cursor++
+	case expectToken(tokens, cursor, TokenFromKeyword(lexer.LeftKeyword)),
+		expectToken(tokens, cursor, TokenFromKeyword(lexer.RightKeyword)),
+		expectToken(tokens, cursor, TokenFromKeyword(lexer.FullKeyword)):
+		switch lexer.Keyword(tokens[cursor].Value) {
+		case lexer.LeftKeyword:
+			joinType = LeftJoin
+		case lexer.RightKeyword:
+			joinType = RightJoin
+		case lexer.FullKeyword:
+			joinType = FullJoin
+		}
+		cursor++
+
+		// OUTER 可以省略
+		if expectToken(tokens, cursor, TokenFromKeyword(lexer.OuterKeyword)) {
+			cursor++
+		}
+	}
+
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.JoinKeyword)) {
+		return InnerJoin, initialCursor, false
+	}
+	cursor++
+
+	return joinType, cursor, true
+}
+
+// 辅助函数,用于找到可选的 GROUP BY
+// 没有GROUP BY的时候返回nil, 但这不算失败
+func parseGroupBy(tokens []*lexer.Token, initialCursor uint) ([]*Expression, uint, bool) {
+	cursor := initialCursor
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.GroupKeyword)) {
+		return nil, initialCursor, true
+	}
+	cursor++
+
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.ByKeyword)) {
+		helpMessage(tokens, cursor, "Expected BY")
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	exps := []*Expression{}
+	for {
+		// 每一项之间用逗号隔开
+		if len(exps) > 0 {
+			if !expectToken(tokens, cursor, TokenFromSymbol(lexer.CommaSymbol)) {
+				break
+			}
+			cursor++
+		}
+
+		exp, newCursor, ok := parseExpression(tokens, cursor, TokenFromSymbol(lexer.CommaSymbol))
+		if !ok {
+			helpMessage(tokens, cursor, "Expected GROUP BY expression")
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+
+		exps = append(exps, exp)
+	}
+
+	return exps, cursor, true
+}
+
+// 辅助函数,用于找到可选的 ORDER BY
+// 没有ORDER BY的时候返回nil, 但这不算失败
+func parseOrderBy(tokens []*lexer.Token, initialCursor uint) ([]*OrderByItem, uint, bool) {
+	cursor := initialCursor
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.OrderKeyword)) {
+		return nil, initialCursor, true
+	}
+	cursor++
+
+	if !expectToken(tokens, cursor, TokenFromKeyword(lexer.ByKeyword)) {
+		helpMessage(tokens, cursor, "Expected BY")
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	items := []*OrderByItem{}
+	for {
+		// 每一项之间用逗号隔开
+		if len(items) > 0 {
+			if !expectToken(tokens, cursor, TokenFromSymbol(lexer.CommaSymbol)) {
+				break
+			}
+			cursor++
+		}
+
+		exp, newCursor, ok := parseExpression(tokens, cursor, TokenFromSymbol(lexer.CommaSymbol))
+		if !ok {
+			helpMessage(tokens, cursor, "Expected ORDER BY expression")
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+		item := OrderByItem{Exp: exp}
+
+		// 找可选的ASC或者DESC
+		if expectToken(tokens, cursor, TokenFromKeyword(lexer.DescKeyword)) {
+			item.Desc = true
+			cursor++
+		} else if expectToken(tokens, cursor, TokenFromKeyword(lexer.AscKeyword)) {
+			cursor++
+		}
+
+		// 找可选的NULLS FIRST或者NULLS LAST
+		if expectToken(tokens, cursor, TokenFromKeyword(lexer.NullsKeyword)) {
+			cursor++
+			switch {
+			case expectToken(tokens, cursor, TokenFromKeyword(lexer.FirstKeyword)):
+				item.Nulls = NullsFirstOrder
+			case expectToken(tokens, cursor, TokenFromKeyword(lexer.LastKeyword)):
+				item.Nulls = NullsLastOrder
+			default:
+				helpMessage(tokens, cursor, "Expected FIRST or LAST")
+				return nil, initialCursor, false
+			}
+			cursor++
+		}
+
+		items = append(items, &item)
+	}
+
+	return items, cursor, true
+}
+
+// 辅助函数,用于找到列名和跟在后面的列类型, 以及夹在列中间的表约束
+func parseColumnDefinitions(tokens []*lexer.Token, initialCursor uint, delimiter lexer.Token) (*[]*ColumnDefinition, []*Constraint, uint, bool) {
+	cursor := initialCursor
+	cds := []*ColumnDefinition{}
+	constraints := []*Constraint{}
+	// 循环找, 直到遇到分隔符(delimiter)位置
+	for {
+		// 每次循环都要检查cursor是否越界
+		if cursor >= uint(len(tokens)) {
+			return nil, nil, initialCursor, false
+		}
+		// 查找delimiter
+		current := tokens[cursor]
+		// 找到delimiter，跳出循环
+		if delimiter.Equals(current) {
+			break
+		}
+
+		// 看看有么有逗号，有逗号的情景下证明cds数组里面已经有了一个元素
+		if len(cds) > 0 || len(constraints) > 0 {
+			// check if there is a comma
+			if !expectToken(tokens, cursor, TokenFromSymbol(lexer.CommaSymbol)) {
+				helpMessage(tokens, cursor, "Expected comma")
+				return nil, nil, initialCursor, false
+			}
+			cursor++
+		}
+
+		// 列名都是标识符, 表约束以关键字开头
+		if cursor < uint(len(tokens)) && tokens[cursor].Kind == lexer.KeywordKind {
+			c, newCursor, ok := parseConstraint(tokens, cursor, true)
+			if !ok {
+				helpMessage(tokens, cursor, "Expected column definition or table constraint")
+				return nil, nil, initialCursor, false
+			}
+			cursor = newCursor
+
+			constraints = append(constraints, c)
+			continue
+		}
+
+		cd, newCursor, ok := parseColumnDefinition(tokens, cursor)
+		if !ok {
+			return nil, nil, initialCursor, false
+		}
+		cursor = newCursor
+
+		cds = append(cds, cd)
+	}
+	return &cds, constraints, cursor, true
+}
+
+// 解析外键引用的表和列, 以及ON DELETE和ON UPDATE, 两个都可以不写, 顺序也可以随便写
+// REFERENCES $table [($column [, ...])] [ON {DELETE | UPDATE} {CASCADE | SET NULL | RESTRICT}] ...
+func parseReferences(tokens []*lexer.Token, initialCursor uint) (*ForeignKeyReference, uint, bool) {
+	cursor := initialCursor
+
+	// 跳过REFERENCES
+	cursor++
+
+	table, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+	if !ok {
+		helpMessage(tokens, cursor, "Expected table name")
+		return nil, initialCursor, false
+	}
+	cursor = newCursor
+
+	ref := ForeignKeyReference{Table: *table}
+	if expectToken(tokens, cursor, TokenFromSymbol(lexer.LeftBracketSymbol)) {
+		cursor++
+		columns, newCursor, ok := parseColumnNames(tokens, cursor)
+		if !ok {
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+		ref.Columns = columns
+	}
+
+	onDelete, onUpdate := false, false
+	for expectToken(tokens, cursor, TokenFromKeyword(lexer.OnKeyword)) {
+		cursor++
+
+		var action *ReferentialAction
+		switch {
+		case !onDelete && expectToken(tokens, cursor, TokenFromKeyword(lexer.DeleteKeyword)):
+			onDelete = true
+			action = &ref.OnDelete
+		case !onUpdate && expectToken(tokens, cursor, TokenFromKeyword(lexer.UpdateKeyword)):
+			onUpdate = true
+			action = &ref.OnUpdate
+		default:
+			helpMessage(tokens, cursor, "Expected DELETE or UPDATE")
+			return nil, initialCursor, false
+		}
+		cursor++
+
+		switch {
+		case expectToken(tokens, cursor, TokenFromKeyword(lexer.CascadeKeyword)):
+			*action = CascadeAction
+		case expectToken(tokens, cursor, TokenFromKeyword(lexer.RestrictKeyword)):
+			*action = RestrictAction
+		case expectToken(tokens, cursor, TokenFromKeyword(lexer.SetKeyword)):
+			cursor++
+			if cursor >= uint(len(tokens)) || tokens[cursor].Kind != lexer.NullKind {
+				helpMessage(tokens, cursor, "Expected NULL")
+				return nil, initialCursor, false
+			}
+			*action = SetNullAction
+		default:
+			helpMessage(tokens, cursor, "Expected CASCADE, SET NULL or RESTRICT")
+			return nil, initialCursor, false
+		}
+		cursor++
+	}
+
+	return &ref, cursor, true
+}
+
+// 辅助函数,用于找到括号里用逗号隔开的列名, 左括号已经跳过了, 右括号也会一起跳过
+// $column-name [, ...] )
+func parseColumnNames(tokens []*lexer.Token, initialCursor uint) ([]*lexer.Token, uint, bool) {
+	cursor := initialCursor
+	columns := []*lexer.Token{}
+	for {
+		if len(columns) > 0 {
+			if !expectToken(tokens, cursor, TokenFromSymbol(lexer.CommaSymbol)) {
+				break
+			}
+			cursor++
+		}
+
+		column, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+		if !ok {
+			helpMessage(tokens, cursor, "Expected column name")
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+		columns = append(columns, column)
+	}
+
+	if !expectToken(tokens, cursor, TokenFromSymbol(lexer.RightBracketSymbol)) {
+		helpMessage(tokens, cursor, "Expected ')'")
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	return columns, cursor, true
+}
+
+// 辅助函数,用于找到一个列的定义
+// $column-name $column-type [DEFAULT $expression | [CONSTRAINT $name] {NOT NULL | UNIQUE | PRIMARY KEY | CHECK ($expression) | REFERENCES ...}] ...
+func parseColumnDefinition(tokens []*lexer.Token, initialCursor uint) (*ColumnDefinition, uint, bool) {
+	cursor := initialCursor
+
+	// 找列名
+	id, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+	if !ok {
+		helpMessage(tokens, cursor, "Expected column name")
+		return nil, initialCursor, false
+	}
+	cursor = newCursor
+	// 找列的类型
+	ty, newCursor, ok := parseToken(tokens, cursor, lexer.KeywordKind)
+	if !ok {
+		helpMessage(tokens, cursor, "Expected column type")
+		return nil, initialCursor, false
+	}
+	cursor = newCursor
+
+	cd := ColumnDefinition{
+		Name:     *id,
+		Datatype: *ty,
+	}
+
+	// 默认值和约束都是可选的, 顺序也可以随便写
+	for {
+		// 找可选的默认值
+		if expectToken(tokens, cursor, TokenFromKeyword(lexer.DefaultKeyword)) {
+			if cd.Default != nil {
+				helpMessage(tokens, cursor, "Multiple DEFAULT values")
+				return nil, initialCursor, false
+			}
+			cursor++
+			exp, newCursor, ok := parseExpression(tokens, cursor, TokenFromSymbol(lexer.CommaSymbol))
+			if !ok {
+				helpMessage(tokens, cursor, "Expected DEFAULT expression")
+				return nil, initialCursor, false
+			}
+			cursor = newCursor
+			cd.Default = exp
+			continue
+		}
+
+		c, newCursor, ok := parseConstraint(tokens, cursor, false)
+		if !ok {
+			break
+		}
+		cursor = newCursor
+		cd.Constraints = append(cd.Constraints, c)
+	}
+
+	return &cd, cursor, true
+}
+
+// 解析一个约束, table为true时解析的是表约束, 否则是写在列后面的列约束
+// [CONSTRAINT $name] {NOT NULL | UNIQUE [($column [, ...])] | PRIMARY KEY [($column [, ...])] | CHECK ($expression) |
+// [FOREIGN KEY ($column [, ...])] REFERENCES $table [($column [, ...])] [ON {DELETE | UPDATE} $action] ...}
+// 只有表约束的UNIQUE和PRIMARY KEY要写出列名, NOT NULL只能是列约束
+// 外键写成表约束时以FOREIGN KEY开头, 写成列约束时直接以REFERENCES开头
+func parseConstraint(tokens []*lexer.Token, initialCursor uint, table bool) (*Constraint, uint, bool) {
+	cursor := initialCursor
+
+	c := Constraint{}
+	named := expectToken(tokens, cursor, TokenFromKeyword(lexer.ConstraintKeyword))
+	if named {
+		cursor++
+		name, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+		if !ok {
+			helpMessage(tokens, cursor, "Expected constraint name")
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+		c.Name = name
+	}
+
+	switch {
+	case !table && expectToken(tokens, cursor, TokenFromKeyword(lexer.NotKeyword)):
+		cursor++
+		if cursor >= uint(len(tokens)) || tokens[cursor].Kind != lexer.NullKind {
+			helpMessage(tokens, cursor, "Expected NULL")
+			return nil, initialCursor, false
+		}
+		cursor++
+		c.Kind = NotNullConstraint
+	case expectToken(tokens, cursor, TokenFromKeyword(lexer.UniqueKeyword)),
+		expectToken(tokens, cursor, TokenFromKeyword(lexer.PrimaryKeyword)):
+		c.Kind = UniqueConstraint
+		if expectToken(tokens, cursor, TokenFromKeyword(lexer.PrimaryKeyword)) {
+			cursor++
+			if !expectToken(tokens, cursor, TokenFromKeyword(lexer.KeyKeyword)) {
+				helpMessage(tokens, cursor, "Expected KEY")
+				return nil, initialCursor, false
+			}
+			c.Kind = PrimaryKeyConstraint
+		}
+		cursor++
+		if !table {
+			break
+		}
+
+		if !expectToken(tokens, cursor, TokenFromSymbol(lexer.LeftBracketSymbol)) {
+			helpMessage(tokens, cursor, "Expected '('")
+			return nil, initialCursor, false
+		}
+		cursor++
+		columns, newCursor, ok := parseColumnNames(tokens, cursor)
+		if !ok {
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+		c.Columns = columns
+	case table && expectToken(tokens, cursor, TokenFromKeyword(lexer.ForeignKeyword)):
+		cursor++
+		if !expectToken(tokens, cursor, TokenFromKeyword(lexer.KeyKeyword)) {
+			helpMessage(tokens, cursor, "Expected KEY")
+			return nil, initialCursor, false
+		}
+		cursor++
+		if !expectToken(tokens, cursor, TokenFromSymbol(lexer.LeftBracketSymbol)) {
+			helpMessage(tokens, cursor, "Expected '('")
+			return nil, initialCursor, false
+		}
+		cursor++
+		columns, newCursor, ok := parseColumnNames(tokens, cursor)
+		if !ok {
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+
+		if !expectToken(tokens, cursor, TokenFromKeyword(lexer.ReferencesKeyword)) {
+			helpMessage(tokens, cursor, "Expected REFERENCES")
+			return nil, initialCursor, false
+		}
+		ref, newCursor, ok := parseReferences(tokens, cursor)
+		if !ok {
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+		c.Kind = ForeignKeyConstraint
+		c.Columns = columns
+		c.References = ref
+	case !table && expectToken(tokens, cursor, TokenFromKeyword(lexer.ReferencesKeyword)):
+		ref, newCursor, ok := parseReferences(tokens, cursor)
+		if !ok {
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+		c.Kind = ForeignKeyConstraint
+		c.References = ref
+	case expectToken(tokens, cursor, TokenFromKeyword(lexer.CheckKeyword)):
+		cursor++
+		c.Kind = CheckConstraint
+		if !expectToken(tokens, cursor, TokenFromSymbol(lexer.LeftBracketSymbol)) {
+			helpMessage(tokens, cursor, "Expected '('")
+			return nil, initialCursor, false
+		}
+		cursor++
+		exp, newCursor, ok := parseExpression(tokens, cursor, TokenFromSymbol(lexer.RightBracketSymbol))
+		if !ok {
+			helpMessage(tokens, cursor, "Expected CHECK expression")
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+		if !expectToken(tokens, cursor, TokenFromSymbol(lexer.RightBracketSymbol)) {
+			helpMessage(tokens, cursor, "Expected ')'")
+			return nil, initialCursor, false
+		}
+		cursor++
+		c.Check = exp
+	default:
+		if named {
+			helpMessage(tokens, cursor, "Expected constraint")
+		}
+		return nil, initialCursor, false
+	}
+
+	return &c, cursor, true
+}
+
+// The parseExpressions helper will look for tokens separated by a comma until a delimiter is found.
+// It will use existing helpers plus parseExpression.
+func parseExpressions(tokens []*lexer.Token, initialCursor uint, delimiters []lexer.Token) (*[]*Expression, uint, bool) {
+	cursor := initialCursor
+	exps := []*Expression{}
+outer:
+	for {
+		// 先判断索引cursor有么有越界
+		if cursor >= uint(len(tokens)) {
+			return nil, initialCursor, false
+		}
+		// 寻找分隔符
+		current := tokens[cursor]
+		for _, d := range delimiters {
+			// 如果发现这个token就是分隔符,直接退出循环
+			if d.Equals(current) {
+				break outer
+			}
+		}
+
+		// 找逗号(前提是有逗号)
+		if len(exps) > 0 {
+			// 不是逗号
+			if !expectToken(tokens, cursor, TokenFromSymbol(lexer.CommaSymbol)) {
+				helpMessage(tokens, cursor, "Expected comma")
+				return nil, initialCursor, false
+			}
+
+			cursor++
+		}
+		// 找expression
+		exp, newCursor, ok := parseExpression(tokens, cursor, TokenFromSymbol(lexer.CommaSymbol))
+		// 说明氮
+		if !ok {
+			helpMessage(tokens, cursor, "Expected expression")
+			return nil, initialCursor, false
+		}
+		// 说明遇到了逗号
+		cursor = newCursor
+
+		exps = append(exps, exp)
+	}
+
+	return &exps, cursor, true
+}
+
+// 操作符的优先级(binding power), 数值越大结合得越紧
+const (
+	noPower         uint = iota
+	orPower              // OR
+	andPower             // AND
+	notPower             // NOT (前缀)
+	comparisonPower      // = <> < <= > >=
+	additivePower        // + -
+	multiplyPower        // * / %
+	unaryPower           // - + (前缀)
+)
+
+// 二元操作符对应的优先级, 不是二元操作符就返回noPower
+func binaryPower(t *lexer.Token) uint {
+	switch t.Kind {
+	case lexer.KeywordKind:
+		switch lexer.Keyword(t.Value) {
+		case lexer.OrKeyword:
+			return orPower
+		case lexer.AndKeyword:
+			return andPower
+		}
+	case lexer.SymbolKind:
+		switch lexer.Symbol(t.Value) {
+		case lexer.EqualSymbol, lexer.NotEqualSymbol,
+			lexer.LessSymbol, lexer.LessEqualSymbol,
+			lexer.GreaterSymbol, lexer.GreaterEqualSymbol:
+			return comparisonPower
+		case lexer.PlusSymbol, lexer.MinusSymbol:
+			return additivePower
+		case lexer.AsterisSymbol, lexer.SlashSymbol, lexer.PercentSymbol:
+			return multiplyPower
+		}
+	}
+	return noPower
+}
+
+// parseExpression 会找到数字, 字符串, 标识符等等,
+// 以及由它们和操作符(+ - * / %, = <> < <= > >=, AND OR NOT)、括号组成的表达式
+func parseExpression(tokens []*lexer.Token, initialCursor uint, _ lexer.Token) (*Expression, uint, bool) {
+	return parseExpressionWithPower(tokens, initialCursor, noPower)
+}
+
+// 只解析优先级比minPower高的操作符, 这样同级的操作符就是左结合的
+// 比如 a - b - c 会被解析成 (a - b) - c
+func parseExpressionWithPower(tokens []*lexer.Token, initialCursor uint, minPower uint) (*Expression, uint, bool) {
+	cursor := initialCursor
+
+	exp, newCursor, ok := parseUnaryExpression(tokens, cursor)
+	if !ok {
+		return nil, initialCursor, false
+	}
+	cursor = newCursor
+
+	for cursor < uint(len(tokens)) {
+		// [NOT] IN 和比较操作符的优先级一样
+		if isInOperator(tokens, cursor) {
+			if comparisonPower <= minPower {
+				break
+			}
+			in, newCursor, ok := parseInExpression(tokens, cursor, exp)
+			if !ok {
+				return nil, initialCursor, false
+			}
+			cursor = newCursor
+			exp = in
+			continue
+		}
+
+		// IS [NOT] NULL 是后缀的, 优先级也和比较操作符一样
+		if expectToken(tokens, cursor, TokenFromKeyword(lexer.IsKeyword)) {
+			if comparisonPower <= minPower {
+				break
+			}
+			isNull, newCursor, ok := parseIsNullExpression(tokens, cursor, exp)
+			if !ok {
+				return nil, initialCursor, false
+			}
+			cursor = newCursor
+			exp = isNull
+			continue
+		}
+
+		op := tokens[cursor]
+		power := binaryPower(op)
+		if power == noPower || power <= minPower {
+			break
+		}
+
+		b, newCursor, ok := parseExpressionWithPower(tokens, cursor+1, power)
+		if !ok {
+			helpMessage(tokens, cursor+1, "Expected right operand")
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+
+		exp = &Expression{
+			Binary: &BinaryExpression{
+				A:  *exp,
+				B:  *b,
+				Op: *op,
+			},
+			Kind: BinaryKind,
+		}
+	}
+
+	return exp, cursor, true
+}
+
+// 当前位置是不是 IN 或者 NOT IN
+func isInOperator(tokens []*lexer.Token, cursor uint) bool {
+	if expectToken(tokens, cursor, TokenFromKeyword(lexer.NotKeyword)) {
+		cursor++
+	}
+	return expectToken(tokens, cursor, TokenFromKeyword(lexer.InKeyword))
+}
+
+// 解析IN以及它右边的一组值, left是IN左边已经解析好的表达式
+// [NOT] IN ({$select-statement | $expression [, ...]})
+func parseInExpression(tokens []*lexer.Token, initialCursor uint, left *Expression) (*Expression, uint, bool) {
+	cursor := initialCursor
+
+	in := InExpression{Left: *left}
+	if expectToken(tokens, cursor, TokenFromKeyword(lexer.NotKeyword)) {
+		in.Not = true
+		cursor++
+	}
+	// 跳过IN
+	cursor++
+
+	if slct, newCursor, ok := parseSubquery(tokens, cursor); ok {
+		in.Select = slct
+		return &Expression{
+			In:   &in,
+			Kind: InKind,
+		}, newCursor, true
+	}
+
+	if !expectToken(tokens, cursor, TokenFromSymbol(lexer.LeftBracketSymbol)) {
+		helpMessage(tokens, cursor, "Expected '('")
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	list, newCursor, ok := parseExpressions(tokens, cursor, []lexer.Token{TokenFromSymbol(lexer.RightBracketSymbol)})
+	if !ok {
+		return nil, initialCursor, false
+	}
+	cursor = newCursor
+	if len(*list) == 0 {
+		helpMessage(tokens, cursor, "Expected expression")
+		return nil, initialCursor, false
+	}
+	in.List = *list
+
+	if !expectToken(tokens, cursor, TokenFromSymbol(lexer.RightBracketSymbol)) {
+		helpMessage(tokens, cursor, "Expected ')'")
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	return &Expression{
+		In:   &in,
+		Kind: InKind,
+	}, cursor, true
+}
+
+// 解析 IS [NOT] NULL, operand是IS左边已经解析好的表达式
+func parseIsNullExpression(tokens []*lexer.Token, initialCursor uint, operand *Expression) (*Expression, uint, bool) {
+	cursor := initialCursor
+
+	// 跳过IS
+	cursor++
+
+	isNull := IsNullExpression{Operand: *operand}
+	if expectToken(tokens, cursor, TokenFromKeyword(lexer.NotKeyword)) {
+		isNull.Not = true
+		cursor++
+	}
+
+	if cursor >= uint(len(tokens)) || tokens[cursor].Kind != lexer.NullKind {
+		helpMessage(tokens, cursor, "Expected NULL")
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	return &Expression{
+		IsNull: &isNull,
+		Kind:   IsNullKind,
+	}, cursor, true
+}
+
+// 解析前缀操作符(NOT, -, +)以及操作数
+func parseUnaryExpression(tokens []*lexer.Token, initialCursor uint) (*Expression, uint, bool) {
+	cursor := initialCursor
+
+	var power uint
+	switch {
+	case expectToken(tokens, cursor, TokenFromKeyword(lexer.NotKeyword)):
+		power = notPower
+	case expectToken(tokens, cursor, TokenFromSymbol(lexer.MinusSymbol)),
+		expectToken(tokens, cursor, TokenFromSymbol(lexer.PlusSymbol)):
+		power = unaryPower
+	default:
+		return parsePrimaryExpression(tokens, cursor)
+	}
+
+	op := tokens[cursor]
+	// NOT a = b 是 NOT (a = b), 而 -a * b 是 (-a) * b
+	operand, newCursor, ok := parseExpressionWithPower(tokens, cursor+1, power-1)
+	if !ok {
+		helpMessage(tokens, cursor+1, "Expected operand")
+		return nil, initialCursor, false
+	}
+
+	return &Expression{
+		Unary: &UnaryExpression{
+			Operand: *operand,
+			Op:      *op,
+		},
+		Kind: UnaryKind,
+	}, newCursor, true
+}
+
+// 解析字面量, 括号括起来的表达式或者子查询
+func parsePrimaryExpression(tokens []*lexer.Token, initialCursor uint) (*Expression, uint, bool) {
+	cursor := initialCursor
+
+	// EXISTS (SELECT ...)
+	if expectToken(tokens, cursor, TokenFromKeyword(lexer.ExistsKeyword)) {
+		slct, newCursor, ok := parseSubquery(tokens, cursor+1)
+		if !ok {
+			helpMessage(tokens, cursor+1, "Expected subquery")
+			return nil, initialCursor, false
+		}
+		return &Expression{
+			Select: slct,
+			Kind:   ExistsKind,
+		}, newCursor, true
+	}
+
+	// 括号里是SELECT时就是标量子查询
+	if slct, newCursor, ok := parseSubquery(tokens, cursor); ok {
+		return &Expression{
+			Select: slct,
+			Kind:   SubqueryKind,
+		}, newCursor, true
+	}
+
+	if !expectToken(tokens, cursor, TokenFromSymbol(lexer.LeftBracketSymbol)) {
+		// 标识符后面紧跟着 ( 就是函数调用
+		if fn, newCursor, ok := parseFunctionCall(tokens, cursor); ok {
+			return fn, newCursor, true
+		}
+		return parseLiteralExpression(tokens, cursor)
+	}
+	cursor++
+
+	exp, newCursor, ok := parseExpressionWithPower(tokens, cursor, noPower)
+	if !ok {
+		return nil, initialCursor, false
+	}
+	cursor = newCursor
+
+	if !expectToken(tokens, cursor, TokenFromSymbol(lexer.RightBracketSymbol)) {
+		helpMessage(tokens, cursor, "Expected ')'")
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	return exp, cursor, true
+}
+
+// 解析括号括起来的子查询, 括号里不是SELECT时直接返回false
+// ($select-statement)
+func parseSubquery(tokens []*lexer.Token, initialCursor uint) (*SelectStatement, uint, bool) {
+	cursor := initialCursor
+
+	if !expectToken(tokens, cursor, TokenFromSymbol(lexer.LeftBracketSymbol)) ||
+		!expectToken(tokens, cursor+1, TokenFromKeyword(lexer.SelectKeyword)) {
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	slct, newCursor, ok := parseSelectStatement(tokens, cursor, TokenFromSymbol(lexer.RightBracketSymbol))
+	if !ok {
+		return nil, initialCursor, false
+	}
+	cursor = newCursor
+
+	if !expectToken(tokens, cursor, TokenFromSymbol(lexer.RightBracketSymbol)) {
+		helpMessage(tokens, cursor, "Expected ')'")
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	return slct, cursor, true
+}
+
+// 解析函数调用
+// $function-name ( [* | $expression [, ...]] )
+func parseFunctionCall(tokens []*lexer.Token, initialCursor uint) (*Expression, uint, bool) {
+	cursor := initialCursor
+
+	name, newCursor, ok := parseToken(tokens, cursor, lexer.IdentifierKind)
+	if !ok || !expectToken(tokens, newCursor, TokenFromSymbol(lexer.LeftBracketSymbol)) {
+		return nil, initialCursor, false
+	}
+	cursor = newCursor + 1
+
+	fn := FunctionCall{Name: *name}
+	if expectToken(tokens, cursor, TokenFromSymbol(lexer.AsterisSymbol)) {
+		// COUNT(*)
+		fn.Star = true
+		cursor++
+	} else {
+		args, newCursor, ok := parseExpressions(tokens, cursor, []lexer.Token{TokenFromSymbol(lexer.RightBracketSymbol)})
+		if !ok {
+			return nil, initialCursor, false
+		}
+		cursor = newCursor
+		fn.Args = *args
+	}
+
+	if !expectToken(tokens, cursor, TokenFromSymbol(lexer.RightBracketSymbol)) {
+		helpMessage(tokens, cursor, "Expected ')'")
+		return nil, initialCursor, false
+	}
+	cursor++
+
+	return &Expression{
+		Function: &fn,
+		Kind:     FunctionKind,
+	}, cursor, true
+}
+
+// parseLiteralExpression 只找单个的数字, 字符串或者标识符
+func parseLiteralExpression(tokens []*lexer.Token, initialCursor uint) (*Expression, uint, bool) {
+	cursor := initialCursor
+
+	// 下面就是要找的种类
+	kinds := []lexer.TokenKind{lexer.IdentifierKind, lexer.NumericKind, lexer.StringKind, lexer.BoolKind, lexer.NullKind}
+	for _, kind := range kinds {
 		t, newCursor, ok := parseToken(tokens, cursor, kind)
 		// 如果找到了特定kind的token
 		if ok {
+			// 标识符后面跟着 . 和另一个标识符, 就是 表名.列名
+			if kind == lexer.IdentifierKind && expectToken(tokens, newCursor, TokenFromSymbol(lexer.DotSymbol)) {
+				column, newCursor, ok := parseToken(tokens, newCursor+1, lexer.IdentifierKind)
+				if !ok {
+					helpMessage(tokens, newCursor+1, "Expected column name")
+					return nil, initialCursor, false
+				}
+				return &Expression{
+					Literal: column,
+					Table:   t,
+					Kind:    LiteralKind,
+				}, newCursor, true
+			}
+
 			return &Expression{
 				Literal: t,
 				Kind:    LiteralKind, // 字面量,目前只有一种ExpressionKind
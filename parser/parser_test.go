@@ -1,2 +1,1684 @@
 package parser
 
+import (
+	"strings"
+	"testing"
+
+	"github.com/database-from-zero-to-one/lexer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse_selectWhere(t *testing.T) {
+	tests := []struct {
+		source string
+		where  *Expression
+		ok     bool
+	}{
+		{
+			source: "select a from t;",
+			where:  nil,
+			ok:     true,
+		},
+		{
+			source: "select a from t where a = 1;",
+			where: &Expression{
+				Binary: &BinaryExpression{
+					A: Expression{
+						Literal: &lexer.Token{Value: "a", Kind: lexer.IdentifierKind, Loc: lexer.Location{Col: 22}},
+						Kind:    LiteralKind,
+					},
+					B: Expression{
+						Literal: &lexer.Token{Value: "1", Kind: lexer.NumericKind, Loc: lexer.Location{Col: 26}},
+						Kind:    LiteralKind,
+					},
+					Op: lexer.Token{Value: "=", Kind: lexer.SymbolKind, Loc: lexer.Location{Col: 24}},
+				},
+				Kind: BinaryKind,
+			},
+			ok: true,
+		},
+		{
+			source: "select a from t where b <> 'x';",
+			where: &Expression{
+				Binary: &BinaryExpression{
+					A: Expression{
+						Literal: &lexer.Token{Value: "b", Kind: lexer.IdentifierKind, Loc: lexer.Location{Col: 22}},
+						Kind:    LiteralKind,
+					},
+					B: Expression{
+						Literal: &lexer.Token{Value: "x", Kind: lexer.StringKind, Loc: lexer.Location{Col: 27}},
+						Kind:    LiteralKind,
+					},
+					Op: lexer.Token{Value: "<>", Kind: lexer.SymbolKind, Loc: lexer.Location{Col: 24}},
+				},
+				Kind: BinaryKind,
+			},
+			ok: true,
+		},
+		// false tests
+		{
+			source: "select a from t where;",
+			ok:     false,
+		},
+		{
+			source: "select a from t where a =;",
+			ok:     false,
+		},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse(test.source)
+		assert.Equal(t, test.ok, err == nil, test.source)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, 1, len(ast.Statements), test.source)
+		assert.Equal(t, SelectKind, ast.Statements[0].Kind, test.source)
+		assert.Equal(t, test.where, ast.Statements[0].SelectStatement.Where, test.source)
+	}
+}
+
+// 把表达式转换成前缀形式的字符串, 方便检查优先级和结合性
+func expressionString(exp *Expression) string {
+	switch exp.Kind {
+	case LiteralKind:
+		if exp.Table != nil {
+			return exp.Table.Value + "." + exp.Literal.Value
+		}
+		return exp.Literal.Value
+	case BinaryKind:
+		return "(" + exp.Binary.Op.Value + " " + expressionString(&exp.Binary.A) + " " + expressionString(&exp.Binary.B) + ")"
+	case UnaryKind:
+		return "(" + exp.Unary.Op.Value + " " + expressionString(&exp.Unary.Operand) + ")"
+	case FunctionKind:
+		if exp.Function.Star {
+			return exp.Function.Name.Value + "(*)"
+		}
+		args := []string{}
+		for _, arg := range exp.Function.Args {
+			args = append(args, expressionString(arg))
+		}
+		return exp.Function.Name.Value + "(" + strings.Join(args, ", ") + ")"
+	case SubqueryKind:
+		return "(" + exp.Select.String() + ")"
+	case ExistsKind:
+		return "(exists " + exp.Select.String() + ")"
+	case InKind:
+		op := "in"
+		if exp.In.Not {
+			op = "not-in"
+		}
+		s := "(" + op + " " + expressionString(&exp.In.Left)
+		for _, value := range exp.In.List {
+			s += " " + expressionString(value)
+		}
+		if exp.In.Select != nil {
+			s += " " + exp.In.Select.String()
+		}
+		return s + ")"
+	case IsNullKind:
+		op := "is-null"
+		if exp.IsNull.Not {
+			op = "is-not-null"
+		}
+		return "(" + op + " " + expressionString(&exp.IsNull.Operand) + ")"
+	}
+	return "?"
+}
+
+func TestParse_expression(t *testing.T) {
+	tests := []struct {
+		source string
+		exp    string
+		ok     bool
+	}{
+		{source: "1 + 2 * 3", exp: "(+ 1 (* 2 3))", ok: true},
+		{source: "(1 + 2) * 3", exp: "(* (+ 1 2) 3)", ok: true},
+		{source: "1 - 2 - 3", exp: "(- (- 1 2) 3)", ok: true},
+		{source: "8 / 4 % 3", exp: "(% (/ 8 4) 3)", ok: true},
+		{source: "-a * b", exp: "(* (- a) b)", ok: true},
+		{source: "- - 1", exp: "(- (- 1))", ok: true},
+		{source: "a + 1 >= b * 2", exp: "(>= (+ a 1) (* b 2))", ok: true},
+		{source: "a < 1 or b <= 2 and c > 3", exp: "(or (< a 1) (and (<= b 2) (> c 3)))", ok: true},
+		{source: "not a = 1 and b <> 'x'", exp: "(and (not (= a 1)) (<> b x))", ok: true},
+		{source: "not (a = 1 or b = 2)", exp: "(not (or (= a 1) (= b 2)))", ok: true},
+		{source: "a = 1 or b = 2 or c = 3", exp: "(or (or (= a 1) (= b 2)) (= c 3))", ok: true},
+		{source: "android > 1", exp: "(> android 1)", ok: true},
+		{source: "a in (1, 2) and b not in (3)", exp: "(and (in a 1 2) (not-in b 3))", ok: true},
+		{source: "a + 1 in (2) = true", exp: "(= (in (+ a 1) 2) true)", ok: true},
+		{source: "not a in (1)", exp: "(not (in a 1))", ok: true},
+		{source: "a is null or b = null", exp: "(or (is-null a) (= b null))", ok: true},
+		{source: "not a + 1 is not null", exp: "(not (is-not-null (+ a 1)))", ok: true},
+		// false tests
+		{source: "(1 + 2", ok: false},
+		{source: "1 +", ok: false},
+		{source: "not", ok: false},
+		{source: "a in ()", ok: false},
+		{source: "a in 1", ok: false},
+		{source: "a not 1", ok: false},
+		{source: "a is 1", ok: false},
+		{source: "a is not", ok: false},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse("select 1 from t where " + test.source + ";")
+		assert.Equal(t, test.ok, err == nil, test.source)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, test.exp, expressionString(ast.Statements[0].SelectStatement.Where), test.source)
+	}
+}
+
+func TestParse_update(t *testing.T) {
+	tests := []struct {
+		source string
+		set    []string
+		where  string
+		ok     bool
+	}{
+		{
+			source: "update t set a = 1;",
+			set:    []string{"a=1"},
+			ok:     true,
+		},
+		{
+			source: "update t set a = a + 1, b = 'x' where a > 2 and b <> 'y';",
+			set:    []string{"a=(+ a 1)", "b=x"},
+			where:  "(and (> a 2) (<> b y))",
+			ok:     true,
+		},
+		// false tests
+		{
+			source: "update t;",
+			ok:     false,
+		},
+		{
+			source: "update t set a;",
+			ok:     false,
+		},
+		{
+			source: "update t set a = 1,;",
+			ok:     false,
+		},
+		{
+			source: "update set a = 1;",
+			ok:     false,
+		},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse(test.source)
+		assert.Equal(t, test.ok, err == nil, test.source)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, UpdateKind, ast.Statements[0].Kind, test.source)
+
+		update := ast.Statements[0].UpdateStatement
+		assert.Equal(t, "t", update.Table.Value, test.source)
+		set := []string{}
+		for _, item := range update.Set {
+			set = append(set, item.Column.Value+"="+expressionString(item.Value))
+		}
+		assert.Equal(t, test.set, set, test.source)
+
+		where := ""
+		if update.Where != nil {
+			where = expressionString(update.Where)
+		}
+		assert.Equal(t, test.where, where, test.source)
+	}
+}
+
+func TestParse_delete(t *testing.T) {
+	tests := []struct {
+		source string
+		where  string
+		ok     bool
+	}{
+		{
+			source: "delete from t;",
+			ok:     true,
+		},
+		{
+			source: "delete from t where a = 1 or b < 2;",
+			where:  "(or (= a 1) (< b 2))",
+			ok:     true,
+		},
+		// false tests
+		{
+			source: "delete t;",
+			ok:     false,
+		},
+		{
+			source: "delete from where a = 1;",
+			ok:     false,
+		},
+		{
+			source: "delete from t where;",
+			ok:     false,
+		},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse(test.source)
+		assert.Equal(t, test.ok, err == nil, test.source)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, DeleteKind, ast.Statements[0].Kind, test.source)
+
+		del := ast.Statements[0].DeleteStatement
+		assert.Equal(t, "t", del.Table.Value, test.source)
+		where := ""
+		if del.Where != nil {
+			where = expressionString(del.Where)
+		}
+		assert.Equal(t, test.where, where, test.source)
+	}
+}
+
+func TestParse_createAndDropTable(t *testing.T) {
+	tests := []struct {
+		source   string
+		kind     AstKind
+		table    string
+		ifExists bool
+		ok       bool
+	}{
+		{
+			source: "create table t (a int);",
+			kind:   CreateKind,
+			table:  "t",
+			ok:     true,
+		},
+		{
+			source:   "create table if not exists t (a int);",
+			kind:     CreateKind,
+			table:    "t",
+			ifExists: true,
+			ok:       true,
+		},
+		{
+			source: "drop table t;",
+			kind:   DropTableKind,
+			table:  "t",
+			ok:     true,
+		},
+		{
+			source:   "drop table if exists t;",
+			kind:     DropTableKind,
+			table:    "t",
+			ifExists: true,
+			ok:       true,
+		},
+		// false tests
+		{
+			source: "create table if exists t (a int);",
+			ok:     false,
+		},
+		{
+			source: "create table if not t (a int);",
+			ok:     false,
+		},
+		{
+			source: "drop table if t;",
+			ok:     false,
+		},
+		{
+			source: "drop t;",
+			ok:     false,
+		},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse(test.source)
+		assert.Equal(t, test.ok, err == nil, test.source)
+		if err != nil {
+			continue
+		}
+
+		stmt := ast.Statements[0]
+		assert.Equal(t, test.kind, stmt.Kind, test.source)
+		switch stmt.Kind {
+		case CreateKind:
+			assert.Equal(t, test.table, stmt.CreateStatement.Table.Value, test.source)
+			assert.Equal(t, test.ifExists, stmt.CreateStatement.IfNotExists, test.source)
+		case DropTableKind:
+			assert.Equal(t, test.table, stmt.DropTableStatement.Table.Value, test.source)
+			assert.Equal(t, test.ifExists, stmt.DropTableStatement.IfExists, test.source)
+		}
+	}
+}
+
+func TestParse_createAndDropIndex(t *testing.T) {
+	tests := []struct {
+		source   string
+		kind     AstKind
+		index    string
+		ifExists bool
+		ok       bool
+	}{
+		{
+			source: "create index users_name on users (name);",
+			kind:   CreateIndexKind,
+			index:  "users_name on users (name)",
+			ok:     true,
+		},
+		{
+			source:   "CREATE UNIQUE INDEX IF NOT EXISTS i ON t (a, b);",
+			kind:     CreateIndexKind,
+			index:    "unique i on t (a, b)",
+			ifExists: true,
+			ok:       true,
+		},
+		{
+			source: "create index sessions_token on sessions using hash (token);",
+			kind:   CreateIndexKind,
+			index:  "sessions_token on sessions using hash (token)",
+			ok:     true,
+		},
+		{
+			source: "create index i on t using BTREE (a);",
+			kind:   CreateIndexKind,
+			index:  "i on t (a)",
+			ok:     true,
+		},
+		{
+			source: "drop index i;",
+			kind:   DropIndexKind,
+			index:  "i",
+			ok:     true,
+		},
+		{
+			source:   "drop index if exists i;",
+			kind:     DropIndexKind,
+			index:    "i",
+			ifExists: true,
+			ok:       true,
+		},
+		// false tests
+		{
+			source: "create index on t (a);",
+			ok:     false,
+		},
+		{
+			source: "create index i t (a);",
+			ok:     false,
+		},
+		{
+			source: "create index i on t;",
+			ok:     false,
+		},
+		{
+			source: "create index i on t ();",
+			ok:     false,
+		},
+		{
+			source: "create unique i on t (a);",
+			ok:     false,
+		},
+		{
+			source: "create index i on t using gist (a);",
+			ok:     false,
+		},
+		{
+			source: "create index i on t (a) using hash;",
+			ok:     false,
+		},
+		{
+			source: "drop index if i;",
+			ok:     false,
+		},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse(test.source)
+		assert.Equal(t, test.ok, err == nil, test.source)
+		if err != nil {
+			continue
+		}
+
+		stmt := ast.Statements[0]
+		assert.Equal(t, test.kind, stmt.Kind, test.source)
+		switch stmt.Kind {
+		case CreateIndexKind:
+			create := stmt.CreateIndexStatement
+			index := create.Name.Value + " on " + create.Table.Value
+			if create.Method == HashIndex {
+				index += " using hash"
+			}
+			index += columnNamesString(create.Columns)
+			if create.Unique {
+				index = "unique " + index
+			}
+			assert.Equal(t, test.index, index, test.source)
+			assert.Equal(t, test.ifExists, create.IfNotExists, test.source)
+		case DropIndexKind:
+			assert.Equal(t, test.index, stmt.DropIndexStatement.Name.Value, test.source)
+			assert.Equal(t, test.ifExists, stmt.DropIndexStatement.IfExists, test.source)
+		}
+	}
+}
+
+// 把约束转换成方便比较的字符串
+func constraintString(c *Constraint) string {
+	s := ""
+	if c.Name != nil {
+		s = c.Name.Value + ": "
+	}
+	switch c.Kind {
+	case NotNullConstraint:
+		return s + "not-null"
+	case UniqueConstraint:
+		return s + "unique" + columnNamesString(c.Columns)
+	case PrimaryKeyConstraint:
+		return s + "primary-key" + columnNamesString(c.Columns)
+	case CheckConstraint:
+		return s + "check " + expressionString(c.Check)
+	case ForeignKeyConstraint:
+		actions := map[ReferentialAction]string{
+			RestrictAction: "restrict",
+			CascadeAction:  "cascade",
+			SetNullAction:  "set-null",
+		}
+		ref := c.References
+		return s + "foreign-key" + columnNamesString(c.Columns) + " references " + ref.Table.Value + columnNamesString(ref.Columns) +
+			" delete " + actions[ref.OnDelete] + " update " + actions[ref.OnUpdate]
+	}
+	return "?"
+}
+
+// 把列名转换成 " (a, b)", 没有列名时是空字符串
+func columnNamesString(columns []*lexer.Token) string {
+	if len(columns) == 0 {
+		return ""
+	}
+	names := []string{}
+	for _, column := range columns {
+		names = append(names, column.Value)
+	}
+	return " (" + strings.Join(names, ", ") + ")"
+}
+
+func TestParse_constraints(t *testing.T) {
+	tests := []struct {
+		source  string
+		dflts   []string
+		columns [][]string // 每一列的约束
+		table   []string   // 表约束
+		ok      bool
+	}{
+		{
+			source:  "create table t (a int not null, b text);",
+			dflts:   []string{"", ""},
+			columns: [][]string{{"not-null"}, {}},
+			table:   []string{},
+			ok:      true,
+		},
+		{
+			source:  "create table t (a int unique not null default 1, b int default 0 check (b >= 0) constraint b_small check (b < 10));",
+			dflts:   []string{"1", "0"},
+			columns: [][]string{{"unique", "not-null"}, {"check (>= b 0)", "b_small: check (< b 10)"}},
+			table:   []string{},
+			ok:      true,
+		},
+		{
+			source:  "create table t (a int, unique (a, b), b int, constraint positive check (a > 0 or b > 0));",
+			dflts:   []string{"", ""},
+			columns: [][]string{{}, {}},
+			table:   []string{"unique (a, b)", "positive: check (or (> a 0) (> b 0))"},
+			ok:      true,
+		},
+		{
+			source:  "create table t (a int default null not null);",
+			dflts:   []string{"null"},
+			columns: [][]string{{"not-null"}},
+			table:   []string{},
+			ok:      true,
+		},
+		{
+			source:  "create table t (a int primary key, b int references u on delete cascade, c int constraint c_fk references u (x) on update set null on delete restrict);",
+			dflts:   []string{"", "", ""},
+			columns: [][]string{{"primary-key"}, {"foreign-key references u delete cascade update restrict"}, {"c_fk: foreign-key references u (x) delete restrict update set-null"}},
+			table:   []string{},
+			ok:      true,
+		},
+		{
+			source:  "create table t (a int, b int, primary key (a, b), foreign key (b, a) references u (x, y) on update cascade);",
+			dflts:   []string{"", ""},
+			columns: [][]string{{}, {}},
+			table:   []string{"primary-key (a, b)", "foreign-key (b, a) references u (x, y) delete restrict update cascade"},
+			ok:      true,
+		},
+		// false tests
+		{
+			source: "create table t (a int not);",
+			ok:     false,
+		},
+		{
+			source: "create table t (a int primary);",
+			ok:     false,
+		},
+		{
+			source: "create table t (a int, primary key a);",
+			ok:     false,
+		},
+		{
+			source: "create table t (a int foreign key references u);",
+			ok:     false,
+		},
+		{
+			source: "create table t (a int, foreign key (a) u);",
+			ok:     false,
+		},
+		{
+			source: "create table t (a int references u on delete);",
+			ok:     false,
+		},
+		{
+			source: "create table t (a int references u on delete cascade on delete restrict);",
+			ok:     false,
+		},
+		{
+			source: "create table t (a int references u on update set);",
+			ok:     false,
+		},
+		{
+			source: "create table t (a int unique (a));",
+			ok:     false,
+		},
+		{
+			source: "create table t (a int, not null);",
+			ok:     false,
+		},
+		{
+			source: "create table t (a int, unique a);",
+			ok:     false,
+		},
+		{
+			source: "create table t (a int check a > 0);",
+			ok:     false,
+		},
+		{
+			source: "create table t (a int constraint not null);",
+			ok:     false,
+		},
+		{
+			source: "create table t (a int default 1 default 2);",
+			ok:     false,
+		},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse(test.source)
+		assert.Equal(t, test.ok, err == nil, test.source)
+		if err != nil {
+			continue
+		}
+
+		crt := ast.Statements[0].CreateStatement
+		dflts := []string{}
+		columns := [][]string{}
+		for _, col := range *crt.Cols {
+			dflt := ""
+			if col.Default != nil {
+				dflt = expressionString(col.Default)
+			}
+			dflts = append(dflts, dflt)
+
+			constraints := []string{}
+			for _, c := range col.Constraints {
+				constraints = append(constraints, constraintString(c))
+			}
+			columns = append(columns, constraints)
+		}
+		table := []string{}
+		for _, c := range crt.Constraints {
+			table = append(table, constraintString(c))
+		}
+		assert.Equal(t, test.dflts, dflts, test.source)
+		assert.Equal(t, test.columns, columns, test.source)
+		assert.Equal(t, test.table, table, test.source)
+	}
+}
+
+func TestParse_alterTable(t *testing.T) {
+	tests := []struct {
+		source  string
+		action  AlterTableAction
+		column  string
+		dflt    string
+		name    string
+		newName string
+		ok      bool
+	}{
+		{
+			source: "alter table t add column c int;",
+			action: AddColumnAction,
+			column: "c",
+			ok:     true,
+		},
+		{
+			source: "alter table t add c text default 'x';",
+			action: AddColumnAction,
+			column: "c",
+			dflt:   "x",
+			ok:     true,
+		},
+		{
+			source: "alter table t add column c int default 1 + 2;",
+			action: AddColumnAction,
+			column: "c",
+			dflt:   "(+ 1 2)",
+			ok:     true,
+		},
+		{
+			source: "alter table t add column c int not null default 0;",
+			action: AddColumnAction,
+			column: "c",
+			dflt:   "0",
+			ok:     true,
+		},
+		{
+			source: "alter table t drop column c;",
+			action: DropColumnAction,
+			name:   "c",
+			ok:     true,
+		},
+		{
+			source: "alter table t drop c;",
+			action: DropColumnAction,
+			name:   "c",
+			ok:     true,
+		},
+		{
+			source:  "alter table t rename column a to b;",
+			action:  RenameColumnAction,
+			name:    "a",
+			newName: "b",
+			ok:      true,
+		},
+		{
+			source:  "alter table t rename a to b;",
+			action:  RenameColumnAction,
+			name:    "a",
+			newName: "b",
+			ok:      true,
+		},
+		{
+			source:  "alter table t rename to u;",
+			action:  RenameTableAction,
+			newName: "u",
+			ok:      true,
+		},
+		// false tests
+		{
+			source: "alter table t add column c;",
+			ok:     false,
+		},
+		{
+			source: "alter table t add column c int default;",
+			ok:     false,
+		},
+		{
+			source: "alter table t add column c int unique (c);",
+			ok:     false,
+		},
+		{
+			source: "alter table t rename a b;",
+			ok:     false,
+		},
+		{
+			source: "alter table t rename to;",
+			ok:     false,
+		},
+		{
+			source: "alter table t;",
+			ok:     false,
+		},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse(test.source)
+		assert.Equal(t, test.ok, err == nil, test.source)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, AlterTableKind, ast.Statements[0].Kind, test.source)
+
+		alter := ast.Statements[0].AlterTableStatement
+		assert.Equal(t, "t", alter.Table.Value, test.source)
+		assert.Equal(t, test.action, alter.Action, test.source)
+		if alter.Column != nil {
+			assert.Equal(t, test.column, alter.Column.Name.Value, test.source)
+			dflt := ""
+			if alter.Column.Default != nil {
+				dflt = expressionString(alter.Column.Default)
+			}
+			assert.Equal(t, test.dflt, dflt, test.source)
+		}
+		if alter.Name != nil {
+			assert.Equal(t, test.name, alter.Name.Value, test.source)
+		}
+		if alter.NewName != nil {
+			assert.Equal(t, test.newName, alter.NewName.Value, test.source)
+		}
+	}
+}
+
+func TestParse_orderBy(t *testing.T) {
+	tests := []struct {
+		source  string
+		orderBy []string
+		ok      bool
+	}{
+		{
+			source:  "select a from t;",
+			orderBy: []string{},
+			ok:      true,
+		},
+		{
+			source:  "select a from t order by a;",
+			orderBy: []string{"a asc"},
+			ok:      true,
+		},
+		{
+			source:  "select a from t where a > 1 order by a desc, b + 1 asc, c;",
+			orderBy: []string{"a desc", "(+ b 1) asc", "c asc"},
+			ok:      true,
+		},
+		{
+			source:  "select a from t order by a nulls first, b desc nulls last;",
+			orderBy: []string{"a asc nulls first", "b desc nulls last"},
+			ok:      true,
+		},
+		// false tests
+		{
+			source: "select a from t order a;",
+			ok:     false,
+		},
+		{
+			source: "select a from t order by;",
+			ok:     false,
+		},
+		{
+			source: "select a from t order by a nulls;",
+			ok:     false,
+		},
+		{
+			source: "select a from t order by a,;",
+			ok:     false,
+		},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse(test.source)
+		assert.Equal(t, test.ok, err == nil, test.source)
+		if err != nil {
+			continue
+		}
+
+		orderBy := []string{}
+		for _, item := range ast.Statements[0].SelectStatement.OrderBy {
+			s := expressionString(item.Exp) + " asc"
+			if item.Desc {
+				s = expressionString(item.Exp) + " desc"
+			}
+			switch item.Nulls {
+			case NullsFirstOrder:
+				s += " nulls first"
+			case NullsLastOrder:
+				s += " nulls last"
+			}
+			orderBy = append(orderBy, s)
+		}
+		assert.Equal(t, test.orderBy, orderBy, test.source)
+	}
+}
+
+func TestParse_limitOffset(t *testing.T) {
+	tests := []struct {
+		source string
+		limit  string
+		offset string
+		ok     bool
+	}{
+		{
+			source: "select a from t limit 10;",
+			limit:  "10",
+			ok:     true,
+		},
+		{
+			source: "select a from t order by a desc limit 10 offset 2 * 5;",
+			limit:  "10",
+			offset: "(* 2 5)",
+			ok:     true,
+		},
+		{
+			source: "select a from t where a > 1 offset 3;",
+			offset: "3",
+			ok:     true,
+		},
+		// false tests
+		{
+			source: "select a from t limit;",
+			ok:     false,
+		},
+		{
+			source: "select a from t limit 1 offset;",
+			ok:     false,
+		},
+		{
+			source: "select a from t offset 1 limit 1;",
+			ok:     false,
+		},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse(test.source)
+		assert.Equal(t, test.ok, err == nil, test.source)
+		if err != nil {
+			continue
+		}
+
+		slct := ast.Statements[0].SelectStatement
+		limit, offset := "", ""
+		if slct.Limit != nil {
+			limit = expressionString(slct.Limit)
+		}
+		if slct.Offset != nil {
+			offset = expressionString(slct.Offset)
+		}
+		assert.Equal(t, test.limit, limit, test.source)
+		assert.Equal(t, test.offset, offset, test.source)
+	}
+}
+
+func TestParse_groupBy(t *testing.T) {
+	tests := []struct {
+		source  string
+		items   []string
+		groupBy []string
+		having  string
+		ok      bool
+	}{
+		{
+			source: "select count(*), sum(a + 1), max(b) from t;",
+			items:  []string{"count(*)", "sum((+ a 1))", "max(b)"},
+			ok:     true,
+		},
+		{
+			source:  "select a, count(b) from t where b > 1 group by a;",
+			items:   []string{"a", "count(b)"},
+			groupBy: []string{"a"},
+			ok:      true,
+		},
+		{
+			source:  "select a % 2, b, avg(c) from t group by a % 2, b having avg(c) > 1 and count(*) > 2 order by b;",
+			items:   []string{"(% a 2)", "b", "avg(c)"},
+			groupBy: []string{"(% a 2)", "b"},
+			having:  "(and (> avg(c) 1) (> count(*) 2))",
+			ok:      true,
+		},
+		{
+			source: "select f() + 1 from t;",
+			items:  []string{"(+ f() 1)"},
+			ok:     true,
+		},
+		// false tests
+		{
+			source: "select a from t group a;",
+			ok:     false,
+		},
+		{
+			source: "select a from t group by;",
+			ok:     false,
+		},
+		{
+			source: "select a from t group by a having;",
+			ok:     false,
+		},
+		{
+			source: "select count(* from t;",
+			ok:     false,
+		},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse(test.source)
+		assert.Equal(t, test.ok, err == nil, test.source)
+		if err != nil {
+			continue
+		}
+
+		slct := ast.Statements[0].SelectStatement
+		items := []string{}
+		for _, item := range slct.Item {
+			items = append(items, expressionString(item.Exp))
+		}
+		assert.Equal(t, test.items, items, test.source)
+
+		groupBy := []string{}
+		for _, exp := range slct.GroupBy {
+			groupBy = append(groupBy, expressionString(exp))
+		}
+		if test.groupBy == nil {
+			test.groupBy = []string{}
+		}
+		assert.Equal(t, test.groupBy, groupBy, test.source)
+
+		having := ""
+		if slct.Having != nil {
+			having = expressionString(slct.Having)
+		}
+		assert.Equal(t, test.having, having, test.source)
+	}
+}
+
+// 把FROM里的一项转成字符串, 方便比较, 比如 (left users u (= u.id o.uid) orders o)
+func tableReferenceString(ref *TableReference) string {
+	if ref.Kind == DerivedTableKind {
+		return "(" + ref.Select.String() + ") " + ref.Alias.Value
+	}
+	if ref.Kind == TableNameKind {
+		if ref.Alias != nil {
+			return ref.Table.Value + " " + ref.Alias.Value
+		}
+		return ref.Table.Value
+	}
+
+	joinTypes := []string{"inner", "left", "right", "full", "cross"}
+	s := "(" + joinTypes[ref.Join.Type] + " " + tableReferenceString(ref.Join.Left)
+	if ref.Join.On != nil {
+		s += " " + expressionString(ref.Join.On)
+	}
+	return s + " " + tableReferenceString(ref.Join.Right) + ")"
+}
+
+func TestParse_from(t *testing.T) {
+	tests := []struct {
+		source string
+		from   []string
+		ok     bool
+	}{
+		{
+			source: "select a from t;",
+			from:   []string{"t"},
+			ok:     true,
+		},
+		{
+			source: "select u.id, o.total from users u, orders as o where u.id = o.uid;",
+			from:   []string{"users u", "orders o"},
+			ok:     true,
+		},
+		{
+			source: "select a from users join orders on users.id = orders.uid;",
+			from:   []string{"(inner users (= users.id orders.uid) orders)"},
+			ok:     true,
+		},
+		{
+			source: "select a from users u inner join orders o on u.id = o.uid and o.total > 10 left outer join items i on i.oid = o.id;",
+			from:   []string{"(left (inner users u (and (= u.id o.uid) (> o.total 10)) orders o) (= i.oid o.id) items i)"},
+			ok:     true,
+		},
+		{
+			source: "select a from a right join b on a.x = b.x full join c on b.y = c.y, d cross join e;",
+			from:   []string{"(full (right a (= a.x b.x) b) (= b.y c.y) c)", "(cross d e)"},
+			ok:     true,
+		},
+		{
+			source: "select a from t left join s on true order by a;",
+			from:   []string{"(left t true s)"},
+			ok:     true,
+		},
+		{
+			source: "select a from (select a from t where a > 1) as s join t on s.a = t.a;",
+			from:   []string{"(inner (select a from t where a > 1) s (= s.a t.a) t)"},
+			ok:     true,
+		},
+		// false tests
+		{
+			source: "select a from users join orders;",
+			ok:     false,
+		},
+		{
+			source: "select a from users cross join orders on true;",
+			ok:     false,
+		},
+		{
+			source: "select a from users left orders on true;",
+			ok:     false,
+		},
+		{
+			source: "select a from users as;",
+			ok:     false,
+		},
+		{
+			source: "select a from users,;",
+			ok:     false,
+		},
+		{
+			source: "select u. from users u;",
+			ok:     false,
+		},
+		{
+			source: "select a from (select a from t);",
+			ok:     false,
+		},
+		{
+			source: "select a from (t) s;",
+			ok:     false,
+		},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse(test.source)
+		assert.Equal(t, test.ok, err == nil, test.source)
+		if err != nil {
+			continue
+		}
+
+		from := []string{}
+		for _, ref := range ast.Statements[0].SelectStatement.From {
+			from = append(from, tableReferenceString(ref))
+		}
+		assert.Equal(t, test.from, from, test.source)
+	}
+}
+
+func TestParse_explain(t *testing.T) {
+	tests := []struct {
+		source string
+		ok     bool
+	}{
+		{
+			source: "explain select a from t;",
+			ok:     true,
+		},
+		{
+			source: "EXPLAIN select a from t join s on t.id = s.id where a > 1;",
+			ok:     true,
+		},
+		// false tests
+		{
+			source: "explain;",
+			ok:     false,
+		},
+		{
+			source: "explain insert into t values (1);",
+			ok:     false,
+		},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse(test.source)
+		assert.Equal(t, test.ok, err == nil, test.source)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, ExplainKind, ast.Statements[0].Kind, test.source)
+		assert.NotNil(t, ast.Statements[0].ExplainStatement.Select, test.source)
+	}
+}
+
+func TestParse_analyze(t *testing.T) {
+	tests := []struct {
+		source string
+		table  string
+		ok     bool
+	}{
+		{
+			source: "analyze;",
+			ok:     true,
+		},
+		{
+			source: "ANALYZE users;",
+			table:  "users",
+			ok:     true,
+		},
+		// false tests
+		{
+			source: "analyze users orders;",
+			ok:     false,
+		},
+		{
+			source: "analyze table users;",
+			ok:     false,
+		},
+		{
+			source: "analyze 1;",
+			ok:     false,
+		},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse(test.source)
+		assert.Equal(t, test.ok, err == nil, test.source)
+		if err != nil {
+			continue
+		}
+
+		stmt := ast.Statements[0]
+		assert.Equal(t, AnalyzeKind, stmt.Kind, test.source)
+		table := ""
+		if stmt.AnalyzeStatement.Table != nil {
+			table = stmt.AnalyzeStatement.Table.Value
+		}
+		assert.Equal(t, test.table, table, test.source)
+	}
+}
+
+func TestExpression_String(t *testing.T) {
+	tests := []struct {
+		source string
+		value  string
+	}{
+		{
+			source: "a",
+			value:  "a",
+		},
+		{
+			source: "t.a = 'it''s'",
+			value:  "t.a = 'it''s'",
+		},
+		{
+			source: "(a + b) * c - (d - e)",
+			value:  "(a + b) * c - (d - e)",
+		},
+		{
+			source: "a + b * c",
+			value:  "a + b * c",
+		},
+		{
+			source: "not (a or b) and -x > 1",
+			value:  "not (a or b) and -x > 1",
+		},
+		{
+			source: "count(*) > max(a, 1)",
+			value:  "count(*) > max(a, 1)",
+		},
+		{
+			source: "x = (a in (1, 2)) and not b in (3)",
+			value:  "x = (a in (1, 2)) and not b in (3)",
+		},
+		{
+			source: "x = (a is NULL) and (b + 1) is not null",
+			value:  "x = (a is null) and b + 1 is not null",
+		},
+		{
+			source: "not exists (select * from s where s.id = t.id) or a not in (select distinct b from s order by b desc limit 1)",
+			value:  "not exists (select * from s where s.id = t.id) or a not in (select distinct b from s order by b desc limit 1)",
+		},
+		{
+			source: "(select count(*) as c from s join r on s.id = r.id group by s.a having count(*) > 1 union all select 1)",
+			value:  "(select count(*) as c from s join r on s.id = r.id group by s.a having count(*) > 1 union all select 1)",
+		},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse("select " + test.source + " from t;")
+		assert.Nil(t, err, test.source)
+		assert.Equal(t, test.value, ast.Statements[0].SelectStatement.Item[0].Exp.String(), test.source)
+	}
+}
+
+func TestParse_selectItems(t *testing.T) {
+	tests := []struct {
+		source  string
+		items   []string
+		aliases []string
+		from    int
+		ok      bool
+	}{
+		{
+			source:  "select 1 + 2;",
+			items:   []string{"(+ 1 2)"},
+			aliases: []string{""},
+			from:    0,
+			ok:      true,
+		},
+		{
+			source:  "select a as x, b y, count(*) as n, c from t;",
+			items:   []string{"a", "b", "count(*)", "c"},
+			aliases: []string{"x", "y", "n", ""},
+			from:    1,
+			ok:      true,
+		},
+		{
+			source:  "select t.a * 2 as double from t u where a > 1;",
+			items:   []string{"(* t.a 2)"},
+			aliases: []string{"double"},
+			from:    1,
+			ok:      true,
+		},
+		{
+			source:  "select 'x' as s order by s limit 1;",
+			items:   []string{"x"},
+			aliases: []string{"s"},
+			from:    0,
+			ok:      true,
+		},
+		// false tests
+		{
+			source: "select a as from t;",
+			ok:     false,
+		},
+		{
+			source: "select a as 1 from t;",
+			ok:     false,
+		},
+		{
+			source: "select a b c from t;",
+			ok:     false,
+		},
+		{
+			source: "select a, from t;",
+			ok:     false,
+		},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse(test.source)
+		assert.Equal(t, test.ok, err == nil, test.source)
+		if err != nil {
+			continue
+		}
+
+		slct := ast.Statements[0].SelectStatement
+		items := []string{}
+		aliases := []string{}
+		for _, item := range slct.Item {
+			items = append(items, expressionString(item.Exp))
+			alias := ""
+			if item.As != nil {
+				alias = item.As.Value
+			}
+			aliases = append(aliases, alias)
+		}
+		assert.Equal(t, test.items, items, test.source)
+		assert.Equal(t, test.aliases, aliases, test.source)
+		assert.Equal(t, test.from, len(slct.From), test.source)
+	}
+}
+
+func TestParse_selectAsterisk(t *testing.T) {
+	tests := []struct {
+		source string
+		items  []string
+		ok     bool
+	}{
+		{
+			source: "select * from t;",
+			items:  []string{"*"},
+			ok:     true,
+		},
+		{
+			source: "select u.*, o.id, * from users u join orders o on u.id = o.uid;",
+			items:  []string{"u.*", "o.id", "*"},
+			ok:     true,
+		},
+		{
+			source: "select a * b, count(*) from t;",
+			items:  []string{"(* a b)", "count(*)"},
+			ok:     true,
+		},
+		{
+			source: "select t. * from t;",
+			items:  []string{"t.*"},
+			ok:     true,
+		},
+		// false tests
+		{
+			source: "select * as x from t;",
+			ok:     false,
+		},
+		{
+			source: "select *, from t;",
+			ok:     false,
+		},
+		{
+			source: "select * * from t;",
+			ok:     false,
+		},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse(test.source)
+		assert.Equal(t, test.ok, err == nil, test.source)
+		if err != nil {
+			continue
+		}
+
+		items := []string{}
+		for _, item := range ast.Statements[0].SelectStatement.Item {
+			switch {
+			case item.Asterisk && item.Table != nil:
+				items = append(items, item.Table.Value+".*")
+			case item.Asterisk:
+				items = append(items, "*")
+			default:
+				items = append(items, expressionString(item.Exp))
+			}
+		}
+		assert.Equal(t, test.items, items, test.source)
+	}
+}
+
+// 把查询转换成字符串, 方便比较集合操作的结构, 比如 (union-all t (intersect s r))
+// 不带集合操作的查询只显示FROM的第一张表, DISTINCT 的查询前面加上 distinct-
+func selectString(slct *SelectStatement) string {
+	if slct.Compound == nil {
+		s := "?"
+		if len(slct.From) > 0 {
+			s = slct.From[0].Table.Value
+		}
+		if slct.Distinct {
+			s = "distinct-" + s
+		}
+		return s
+	}
+
+	ops := []string{"union", "intersect", "except"}
+	op := ops[slct.Compound.Operator]
+	if slct.Compound.All {
+		op += "-all"
+	}
+	return "(" + op + " " + selectString(slct.Compound.Left) + " " + selectString(slct.Compound.Right) + ")"
+}
+
+func TestParse_setOperation(t *testing.T) {
+	tests := []struct {
+		source  string
+		tree    string
+		orderBy int
+		limit   bool
+		ok      bool
+	}{
+		{
+			source: "select distinct a from t;",
+			tree:   "distinct-t",
+			ok:     true,
+		},
+		{
+			source: "select a from t union select b from s;",
+			tree:   "(union t s)",
+			ok:     true,
+		},
+		{
+			source: "select a from t union all select b from s except select c from r;",
+			tree:   "(except (union-all t s) r)",
+			ok:     true,
+		},
+		{
+			// INTERSECT 先结合
+			source: "select a from t union select b from s intersect all select c from r;",
+			tree:   "(union t (intersect-all s r))",
+			ok:     true,
+		},
+		{
+			source: "select a from t intersect select b from s intersect select c from r;",
+			tree:   "(intersect (intersect t s) r)",
+			ok:     true,
+		},
+		{
+			// ORDER BY 和 LIMIT 作用于整个结果
+			source:  "select distinct a from t where a > 1 except select b from s group by b order by a desc limit 1;",
+			tree:    "(except distinct-t s)",
+			orderBy: 1,
+			limit:   true,
+			ok:      true,
+		},
+		// false tests
+		{
+			source: "select a from t union;",
+			ok:     false,
+		},
+		{
+			source: "select a from t union all;",
+			ok:     false,
+		},
+		{
+			source: "select a from t order by a union select b from s;",
+			ok:     false,
+		},
+		{
+			source: "select distinct from t;",
+			ok:     false,
+		},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse(test.source)
+		assert.Equal(t, test.ok, err == nil, test.source)
+		if err != nil {
+			continue
+		}
+
+		slct := ast.Statements[0].SelectStatement
+		assert.Equal(t, test.tree, selectString(slct), test.source)
+		assert.Equal(t, test.orderBy, len(slct.OrderBy), test.source)
+		assert.Equal(t, test.limit, slct.Limit != nil, test.source)
+	}
+}
+
+func TestParse_subquery(t *testing.T) {
+	tests := []struct {
+		source string
+		exp    string
+		ok     bool
+	}{
+		{
+			source: "select (select max(id) from t) from s;",
+			exp:    "(select max(id) from t)",
+			ok:     true,
+		},
+		{
+			source: "select (select b from t where t.a = s.a limit 1) + 1 from s;",
+			exp:    "(+ (select b from t where t.a = s.a limit 1) 1)",
+			ok:     true,
+		},
+		{
+			source: "select exists (select 1 from t where t.a = s.a) from s;",
+			exp:    "(exists select 1 from t where t.a = s.a)",
+			ok:     true,
+		},
+		{
+			source: "select not exists (select * from t) from s;",
+			exp:    "(not (exists select * from t))",
+			ok:     true,
+		},
+		{
+			source: "select a in (select a from t union select b from r) from s;",
+			exp:    "(in a select a from t union select b from r)",
+			ok:     true,
+		},
+		{
+			source: "select a not in (select a from (select a from t) as x) from s;",
+			exp:    "(not-in a select a from (select a from t) as x)",
+			ok:     true,
+		},
+		// false tests
+		{
+			source: "select (select) from s;",
+			ok:     false,
+		},
+		{
+			source: "select (select a from t from s;",
+			ok:     false,
+		},
+		{
+			source: "select exists (1) from s;",
+			ok:     false,
+		},
+		{
+			source: "select exists select 1 from s;",
+			ok:     false,
+		},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse(test.source)
+		assert.Equal(t, test.ok, err == nil, test.source)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, test.exp, expressionString(ast.Statements[0].SelectStatement.Item[0].Exp), test.source)
+	}
+}
+
+func TestParse_with(t *testing.T) {
+	tests := []struct {
+		source    string
+		recursive bool
+		ctes      []string
+		ok        bool
+	}{
+		{
+			source: "with t as (select a from s) select a from t;",
+			ctes:   []string{"t as (select a from s)"},
+			ok:     true,
+		},
+		{
+			source: "WITH a AS (select 1), b (x, y) AS (select 1, 2 from a) select x from b order by x;",
+			ctes:   []string{"a as (select 1)", "b (x, y) as (select 1, 2 from a)"},
+			ok:     true,
+		},
+		{
+			source:    "with recursive n (i) as (select 1 union all select i + 1 from n where i < 5) select i from n;",
+			recursive: true,
+			ctes:      []string{"n (i) as (select 1 union all select i + 1 from n where i < 5)"},
+			ok:        true,
+		},
+		{
+			source: "explain with t as (select a from s) select a from t;",
+			ctes:   []string{"t as (select a from s)"},
+			ok:     true,
+		},
+		// false tests
+		{
+			source: "with t as (select a from s);",
+			ok:     false,
+		},
+		{
+			source: "with t (select a from s) select a from t;",
+			ok:     false,
+		},
+		{
+			source: "with t as select a from s select a from t;",
+			ok:     false,
+		},
+		{
+			source: "with t () as (select a from s) select a from t;",
+			ok:     false,
+		},
+		{
+			source: "with select a from s;",
+			ok:     false,
+		},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse(test.source)
+		assert.Equal(t, test.ok, err == nil, test.source)
+		if err != nil {
+			continue
+		}
+
+		slct := ast.Statements[0].SelectStatement
+		if ast.Statements[0].Kind == ExplainKind {
+			slct = ast.Statements[0].ExplainStatement.Select
+		} else {
+			assert.Equal(t, SelectKind, ast.Statements[0].Kind, test.source)
+		}
+		assert.Equal(t, test.recursive, slct.With.Recursive, test.source)
+
+		ctes := []string{}
+		for _, cte := range slct.With.Ctes {
+			ctes = append(ctes, cte.String())
+		}
+		assert.Equal(t, test.ctes, ctes, test.source)
+	}
+}
+
+func TestParse_insert(t *testing.T) {
+	tests := []struct {
+		source  string
+		columns []string
+		values  [][]string
+		slct    bool
+		ok      bool
+	}{
+		{
+			source: "insert into t values (1, 'a');",
+			values: [][]string{{"1", "a"}},
+			ok:     true,
+		},
+		{
+			source:  "insert into t (b, a) values (1 + 2, 'x'), (3, 'y');",
+			columns: []string{"b", "a"},
+			values:  [][]string{{"(+ 1 2)", "x"}, {"3", "y"}},
+			ok:      true,
+		},
+		{
+			source:  "insert into t (a) select b from s where b > 1;",
+			columns: []string{"a"},
+			slct:    true,
+			ok:      true,
+		},
+		{
+			source: "insert into t with x as (select 1) select * from x;",
+			slct:   true,
+			ok:     true,
+		},
+		// false tests
+		{
+			source: "insert into t values (1), ;",
+			ok:     false,
+		},
+		{
+			source: "insert into t () values (1);",
+			ok:     false,
+		},
+		{
+			source: "insert into t (a values (1);",
+			ok:     false,
+		},
+		{
+			source: "insert into t (a);",
+			ok:     false,
+		},
+		{
+			source: "insert into t values 1;",
+			ok:     false,
+		},
+	}
+
+	for _, test := range tests {
+		ast, err := Parse(test.source)
+		assert.Equal(t, test.ok, err == nil, test.source)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, InsertKind, ast.Statements[0].Kind, test.source)
+		insert := ast.Statements[0].InsertStatement
+
+		var columns []string
+		for _, col := range insert.Columns {
+			columns = append(columns, col.Value)
+		}
+		assert.Equal(t, test.columns, columns, test.source)
+
+		var values [][]string
+		for _, row := range insert.Values {
+			r := []string{}
+			for _, exp := range row {
+				r = append(r, expressionString(exp))
+			}
+			values = append(values, r)
+		}
+		assert.Equal(t, test.values, values, test.source)
+		assert.Equal(t, test.slct, insert.Select != nil, test.source)
+	}
+}